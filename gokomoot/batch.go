@@ -0,0 +1,240 @@
+package gokomoot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// formatExtensions maps output formats to the file extension used for
+// derived file names and for inferring the format from an output path
+var formatExtensions = map[string]string{
+	FormatGPX:        ".gpx",
+	FormatSVGProfile: ".svg",
+	FormatHTML:       ".html",
+	FormatProtobuf:   ".pb",
+	FormatKML:        ".kml",
+	FormatCSV:        ".csv",
+	FormatGeoJSON:    ".geojson",
+	FormatTCX:        ".tcx",
+	FormatPolyline:   ".polyline",
+}
+
+// FormatForPath infers the output format from the file extension of path,
+// such as kml for track.kml. The extension is matched case-insensitively.
+func FormatForPath(path string) (string, error) {
+	extension := strings.ToLower(filepath.Ext(path))
+	if extension == "" {
+		return "", fmt.Errorf("no file extension in %q to infer the output format from", path)
+	}
+	for format, formatExtension := range formatExtensions {
+		if extension == formatExtension {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown output file extension %q", extension)
+}
+
+// maxSlugLength bounds the tour name part of derived file names
+const maxSlugLength = 60
+
+// ConvertBatch converts each tour URL into outputDir, deriving file names from
+// the tour name and ID. URLs are normalized with ResolveTourURL first and up to
+// Configuration.Concurrency tours are converted at a time. A failing tour
+// doesn't stop the batch: the paths of all written files are returned in input
+// order, together with the joined errors of the failed ones. Canceling ctx
+// stops the batch early; the tours not converted by then fail with its error
+// and the files of the finished ones are still returned.
+func (c *Converter) ConvertBatch(ctx context.Context, urls []string, outputDir string) ([]string, error) {
+	concurrency := c.config.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	paths := make([][]string, len(urls))
+	errs := make([]error, len(urls))
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	done := 0
+	finish := func(tourURL string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		done++
+		c.reporter.OnTourDone(tourURL, done, len(urls), err)
+	}
+	for i, tourURL := range urls {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			errs[i] = fmt.Errorf("%s: %w", tourURL, ctx.Err())
+			finish(tourURL, errs[i])
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			written, err := c.convertWithTimeout(ctx, tourURL, outputDir)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", tourURL, err)
+			}
+			paths[i] = written
+			finish(tourURL, errs[i])
+		}()
+	}
+	wg.Wait()
+
+	var written []string
+	failed, canceled := 0, 0
+	for i := range urls {
+		switch {
+		case errs[i] == nil:
+			written = append(written, paths[i]...)
+		case ctx.Err() != nil && errors.Is(errs[i], ctx.Err()):
+			canceled++
+		default:
+			failed++
+		}
+	}
+
+	verb := "Converted"
+	if c.config.DryRun {
+		verb = "Checked"
+	}
+	summary := fmt.Sprintf("%s %d of %d tours, %d failed", verb, len(urls)-failed-canceled, len(urls), failed)
+	if canceled > 0 {
+		summary += fmt.Sprintf(", %d canceled", canceled)
+	}
+	c.logger.Println(summary)
+	return written, errors.Join(errs...)
+}
+
+// ErrTourTimeout is wrapped by the error of a tour ConvertBatch gave up on
+// after Configuration.TourTimeout
+var ErrTourTimeout = errors.New("tour timed out")
+
+// convertWithTimeout runs convertInto under its own TourTimeout deadline
+func (c *Converter) convertWithTimeout(ctx context.Context, tourURL, outputDir string) ([]string, error) {
+	if c.config.TourTimeout <= 0 {
+		return c.convertInto(ctx, tourURL, outputDir)
+	}
+
+	tourCtx, cancel := context.WithTimeout(ctx, c.config.TourTimeout)
+	defer cancel()
+	written, err := c.convertInto(tourCtx, tourURL, outputDir)
+	if err != nil && ctx.Err() == nil && errors.Is(tourCtx.Err(), context.DeadlineExceeded) {
+		return written, fmt.Errorf("%w after %v: %w", ErrTourTimeout, c.config.TourTimeout, err)
+	}
+	return written, err
+}
+
+// convertInto converts a single tour into outputDir and returns the paths
+// written
+func (c *Converter) convertInto(ctx context.Context, tourURL, outputDir string) ([]string, error) {
+	resolved, err := ResolveTourURL(tourURL)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := c.openTourCache(resolved, outputDir)
+	komootResp, err := c.fetchCachedTour(ctx, resolved, cache)
+	if errors.Is(err, ErrUnchanged) {
+		c.logger.Printf("Tour unchanged since the last run, skipping %s\n", resolved)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(outputDir, tourFileName(&komootResp.Page.Embedded.Tour, c.config.Format))
+	written, err := c.convertTour(ctx, komootResp, path)
+	if err != nil {
+		return written, err
+	}
+	c.saveTourCache(cache, written)
+	return written, nil
+}
+
+// tourFileName derives a file name like "havel-loop-123456.gpx" from the tour
+// name and ID, falling back to whichever of the two is present. Both come from
+// the tour page, so they are sanitized to keep the file inside the output
+// directory.
+func tourFileName(tour *KomootTour, format string) string {
+	parts := make([]string, 0, 2)
+	if slug := slugify(tour.Name); slug != "" {
+		parts = append(parts, slug)
+	}
+	if id := sanitizeFilename(string(tour.ID)); id != "" {
+		parts = append(parts, id)
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "tour")
+	}
+
+	extension, ok := formatExtensions[format]
+	if !ok {
+		extension = formatExtensions[FormatGPX]
+	}
+	return strings.Join(parts, "-") + extension
+}
+
+// sanitizeFilename makes name safe to use as a file name: path separators,
+// control characters and characters Windows rejects become dashes, runs of
+// whitespace collapse to one space, leading dots are dropped so the name is
+// neither hidden nor "." or "..", and the result is cut to maxSlugLength
+// bytes. It returns "" when nothing usable is left.
+func sanitizeFilename(name string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range name {
+		switch {
+		case unicode.IsSpace(r):
+			space = true
+			continue
+		case r == '/' || r == '\\' || unicode.IsControl(r) || strings.ContainsRune(`<>:"|?*`, r):
+			r = '-'
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteRune(r)
+		space = false
+	}
+
+	sanitized := strings.TrimLeft(b.String(), ". ")
+	if len(sanitized) > maxSlugLength {
+		sanitized = strings.ToValidUTF8(sanitized[:maxSlugLength], "")
+	}
+	return strings.TrimRight(sanitized, ". ")
+}
+
+// slugify lowercases name and replaces every run of characters other than
+// letters and digits with a single dash
+func slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+
+	slug := b.String()
+	if len(slug) > maxSlugLength {
+		slug = strings.TrimRight(strings.ToValidUTF8(slug[:maxSlugLength], ""), "-")
+	}
+	return slug
+}
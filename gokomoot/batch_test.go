@@ -0,0 +1,329 @@
+package gokomoot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func tourPageHTML(t *testing.T, payload string) string {
+	t.Helper()
+
+	encodedPayload, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	return `<script>kmtBoot.setProps(` + string(encodedPayload) + `);</script>`
+}
+
+func TestConvertBatchContinuesPastFailures(t *testing.T) {
+	pages := map[string]string{
+		"/tour/1": tourPageHTML(t, `{"page":{"_embedded":{"tour":{"id":1,"name":"Morning Loop","_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35}]}}}}}}`),
+		"/tour/3": tourPageHTML(t, `{"page":{"_embedded":{"tour":{"id":3,"_embedded":{"coordinates":{"items":[{"lat":51.6,"lng":-0.13,"alt":40}]}}}}}}`),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, page)
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.APIBaseURL = server.URL
+	outputDir := t.TempDir()
+	urls := []string{server.URL + "/tour/1", server.URL + "/tour/2", server.URL + "/tour/3"}
+
+	written, err := NewConverter(config).ConvertBatch(context.Background(), urls, outputDir)
+	if err == nil || !strings.Contains(err.Error(), urls[1]) {
+		t.Fatalf("ConvertBatch() error = %v, want error for %s", err, urls[1])
+	}
+	if strings.Contains(err.Error(), urls[0]) || strings.Contains(err.Error(), urls[2]) {
+		t.Fatalf("ConvertBatch() error = %v, want only the failed tour", err)
+	}
+
+	want := []string{filepath.Join(outputDir, "morning-loop-1.gpx"), filepath.Join(outputDir, "3.gpx")}
+	if len(written) != len(want) || written[0] != want[0] || written[1] != want[1] {
+		t.Fatalf("ConvertBatch() = %v, want %v", written, want)
+	}
+	for _, path := range written {
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("os.Stat(%q) error = %v", path, err)
+		}
+	}
+}
+
+func TestConvertBatchDryRunWritesNothing(t *testing.T) {
+	pages := map[string]string{
+		"/tour/1": tourPageHTML(t, `{"page":{"_embedded":{"tour":{"id":1,"name":"Morning Loop","_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35},{"lat":51.501,"lng":-0.12,"alt":36}]}}}}}}`),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, page)
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	config := DefaultConfig()
+	config.APIBaseURL = server.URL
+	config.DryRun = true
+	config.Logger = log.New(&buf, "", 0)
+	outputDir := t.TempDir()
+	urls := []string{server.URL + "/tour/1", server.URL + "/tour/2"}
+
+	written, err := NewConverter(config).ConvertBatch(context.Background(), urls, outputDir)
+	if err == nil || !strings.Contains(err.Error(), urls[1]) {
+		t.Fatalf("ConvertBatch() error = %v, want error for %s", err, urls[1])
+	}
+	if len(written) != 0 {
+		t.Fatalf("ConvertBatch() = %v, want no files", written)
+	}
+	if entries, err := os.ReadDir(outputDir); err != nil || len(entries) != 0 {
+		t.Fatalf("os.ReadDir() = %v, %v, want an empty directory", entries, err)
+	}
+	for _, want := range []string{"Dry run: Morning Loop, 2 points, 0.11 km", "Checked 1 of 2 tours, 1 failed"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("log = %q, want %q", buf.String(), want)
+		}
+	}
+}
+
+func TestConvertBatchReturnsPartialResultsWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	page := tourPageHTML(t, `{"page":{"_embedded":{"tour":{"id":1,"name":"Morning Loop","_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35}]}}}}}}`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tour/1" {
+			// Interrupted while the second tour is being fetched
+			cancel()
+			<-r.Context().Done()
+			return
+		}
+		fmt.Fprint(w, page)
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	config := DefaultConfig()
+	config.APIBaseURL = server.URL
+	config.Concurrency = 1
+	config.Logger = log.New(&buf, "", 0)
+	outputDir := t.TempDir()
+	urls := []string{server.URL + "/tour/1", server.URL + "/tour/2", server.URL + "/tour/3"}
+
+	written, err := NewConverter(config).ConvertBatch(ctx, urls, outputDir)
+	if want := filepath.Join(outputDir, "morning-loop-1.gpx"); len(written) != 1 || written[0] != want {
+		t.Fatalf("ConvertBatch() = %v, want [%s]", written, want)
+	}
+	if errs := err.(interface{ Unwrap() []error }).Unwrap(); len(errs) != 2 || !errors.Is(errs[0], context.Canceled) || !errors.Is(errs[1], context.Canceled) {
+		t.Fatalf("ConvertBatch() error = %v, want the other two tours canceled", err)
+	}
+	if entries, err := os.ReadDir(outputDir); err != nil || len(entries) != 1 {
+		t.Fatalf("os.ReadDir() = %v, %v, want only the finished tour", entries, err)
+	}
+	if want := "Converted 1 of 3 tours, 0 failed, 2 canceled"; !strings.Contains(buf.String(), want) {
+		t.Fatalf("log = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestTourFileName(t *testing.T) {
+	tests := []struct {
+		tour   KomootTour
+		format string
+		want   string
+	}{
+		{KomootTour{ID: "42", Name: "Havelufer – Tegeler See!"}, FormatGPX, "havelufer-tegeler-see-42.gpx"},
+		{KomootTour{Name: "  Only name  "}, FormatSVGProfile, "only-name.svg"},
+		{KomootTour{ID: "7"}, FormatHTML, "7.html"},
+		{KomootTour{}, FormatProtobuf, "tour.pb"},
+		{KomootTour{ID: "9", Name: strings.Repeat("ab ", 40)}, FormatGPX, strings.TrimSuffix(strings.Repeat("ab-", 20), "-") + "-9.gpx"},
+		{KomootTour{ID: "5", Name: "../../etc/passwd"}, FormatGPX, "etc-passwd-5.gpx"},
+		{KomootTour{ID: "6", Name: "Gipfel 🏔️ Tour"}, FormatGPX, "gipfel-tour-6.gpx"},
+		{KomootTour{ID: "8", Name: "🚴‍♀️"}, FormatGPX, "8.gpx"},
+		{KomootTour{ID: "../../x", Name: ".hidden"}, FormatGPX, "hidden--..-x.gpx"},
+		{KomootTour{ID: ".."}, FormatGPX, "tour.gpx"},
+	}
+	for _, tt := range tests {
+		if got := tourFileName(&tt.tour, tt.format); got != tt.want {
+			t.Fatalf("tourFileName(%+v, %q) = %q, want %q", tt.tour, tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := map[string]string{
+		"Morning Loop":          "Morning Loop",
+		"a/b\\c":                "a-b-c",
+		"../../etc/passwd":      "-..-etc-passwd",
+		"..":                    "",
+		".hidden":               "hidden",
+		"line\nbreak\t tab":     "line break tab",
+		"Gipfel 🏔️":             "Gipfel 🏔️",
+		`what?<>:"|*`:           "what-------",
+		"  trailing dot. ":      "trailing dot",
+		strings.Repeat("é", 40): strings.Repeat("é", 30),
+	}
+	for name, want := range tests {
+		if got := sanitizeFilename(name); got != want {
+			t.Fatalf("sanitizeFilename(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestFormatForPath(t *testing.T) {
+	tests := map[string]string{
+		"track.gpx":                 FormatGPX,
+		"out/Track.KML":             FormatKML,
+		"tour.geojson":              FormatGeoJSON,
+		"points.csv":                FormatCSV,
+		"s3://bucket/profile.svg":   FormatSVGProfile,
+		"/tmp/tours/viewer.v2.html": FormatHTML,
+	}
+	for path, want := range tests {
+		got, err := FormatForPath(path)
+		if err != nil || got != want {
+			t.Fatalf("FormatForPath(%q) = %q, %v, want %q", path, got, err, want)
+		}
+	}
+
+	for _, path := range []string{"track.txt", "track", "dir.kml/track"} {
+		if _, err := FormatForPath(path); err == nil {
+			t.Fatalf("FormatForPath(%q) error = nil, want error", path)
+		}
+	}
+}
+
+func TestConvertBatchBoundsConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}()
+
+		time.Sleep(20 * time.Millisecond)
+		id := strings.TrimPrefix(r.URL.Path, "/tour/")
+		fmt.Fprint(w, tourPageHTML(t, `{"page":{"_embedded":{"tour":{"id":`+id+`,"_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35}]}}}}}}`))
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.Concurrency = 2
+	outputDir := t.TempDir()
+	var urls, want []string
+	for id := 1; id <= 6; id++ {
+		urls = append(urls, fmt.Sprintf("%s/tour/%d", server.URL, id))
+		want = append(want, filepath.Join(outputDir, fmt.Sprintf("%d.gpx", id)))
+	}
+
+	written, err := NewConverter(config).ConvertBatch(context.Background(), urls, outputDir)
+	if err != nil {
+		t.Fatalf("ConvertBatch() error = %v", err)
+	}
+	if !slices.Equal(written, want) {
+		t.Fatalf("ConvertBatch() = %v, want %v", written, want)
+	}
+	if maxInFlight > 2 {
+		t.Fatalf("max concurrent requests = %d, want at most 2", maxInFlight)
+	}
+}
+
+func TestConvertBatchBoundsConcurrencyPerHost(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := map[string]int{}, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := strings.Cut(r.Host, ":")
+		mu.Lock()
+		inFlight[host]++
+		maxInFlight = max(maxInFlight, inFlight[host])
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			inFlight[host]--
+			mu.Unlock()
+		}()
+
+		time.Sleep(20 * time.Millisecond)
+		id := strings.TrimPrefix(r.URL.Path, "/tour/")
+		fmt.Fprint(w, tourPageHTML(t, `{"page":{"_embedded":{"tour":{"id":`+id+`,"_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35}]}}}}}}`))
+	}))
+	defer server.Close()
+
+	// Both hosts reach the same server, which tells them apart by Host
+	otherHost := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	config := DefaultConfig()
+	config.Verbosity = VerbosityQuiet
+	config.Concurrency = 4
+	config.ConcurrencyPerHost = 1
+	urls := []string{server.URL + "/tour/1", server.URL + "/tour/2", server.URL + "/tour/3", otherHost + "/tour/4"}
+
+	written, err := NewConverter(config).ConvertBatch(context.Background(), urls, t.TempDir())
+	if err != nil || len(written) != len(urls) {
+		t.Fatalf("ConvertBatch() = %v, %v, want %d files", written, err, len(urls))
+	}
+	if maxInFlight > 1 {
+		t.Fatalf("max concurrent requests per host = %d, want 1", maxInFlight)
+	}
+}
+
+func TestConvertBatchStopsWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	urls := []string{"https://www.komoot.com/tour/1", "https://www.komoot.com/tour/2"}
+	written, err := NewConverter(DefaultConfig()).ConvertBatch(ctx, urls, t.TempDir())
+	if len(written) != 0 || !errors.Is(err, context.Canceled) {
+		t.Fatalf("ConvertBatch() = %v, %v, want no files and context.Canceled", written, err)
+	}
+}
+
+func TestConvertBatchTimesOutSlowTour(t *testing.T) {
+	page := tourPageHTML(t, `{"page":{"_embedded":{"tour":{"id":1,"_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35}]}}}}}}`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/tour/2" {
+			<-r.Context().Done()
+			return
+		}
+		fmt.Fprint(w, page)
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.APIBaseURL = server.URL
+	config.TourTimeout = 100 * time.Millisecond
+	config.Logger = log.New(io.Discard, "", 0)
+	urls := []string{server.URL + "/tour/1", server.URL + "/tour/2"}
+
+	written, err := NewConverter(config).ConvertBatch(context.Background(), urls, t.TempDir())
+	if !errors.Is(err, ErrTourTimeout) || !strings.Contains(err.Error(), urls[1]) {
+		t.Fatalf("ConvertBatch() error = %v, want ErrTourTimeout for %s", err, urls[1])
+	}
+	if len(written) != 1 {
+		t.Fatalf("ConvertBatch() wrote %v, want the fast tour", written)
+	}
+}
@@ -0,0 +1,236 @@
+package gokomoot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// PayloadDecoder extracts the tour JSON from one variant of the markup Komoot
+// embeds it in. Komoot serves different variants to different users and
+// regions and changes them over time; Configuration.PayloadDecoders adds
+// variants without changes to this package.
+type PayloadDecoder interface {
+	// Name identifies the variant in logs and errors
+	Name() string
+	// Decode returns the JSON data of a page in this variant. It returns an
+	// error wrapping ErrMarkerNotFound when the page isn't in this variant at
+	// all, so the next decoder is tried without reporting this one.
+	Decode(htmlContent []byte) ([]byte, error)
+}
+
+// bootPropsMarker is a PayloadDecoder for a variant recognized by the start
+// marker in front of the boot props
+type bootPropsMarker struct {
+	name   string
+	start  string
+	decode func(rest []byte) ([]byte, error)
+}
+
+func (m bootPropsMarker) Name() string { return m.name }
+
+func (m bootPropsMarker) Decode(htmlContent []byte) ([]byte, error) {
+	startIdx := bytes.Index(htmlContent, []byte(m.start))
+	if startIdx == -1 {
+		return nil, ErrMarkerNotFound
+	}
+	return m.decode(bytes.TrimLeft(htmlContent[startIdx+len(m.start):], " \t\r\n"))
+}
+
+// bootPropsMarkers lists the known boot props variants, most common first
+var bootPropsMarkers = []PayloadDecoder{
+	bootPropsMarker{name: "setProps string", start: `kmtBoot.setProps(`, decode: decodeBootPropsString},
+	bootPropsMarker{name: "setProps object", start: `kmtBoot.setProps(`, decode: decodeBootPropsObject},
+	bootPropsMarker{name: "script tag", start: `<script id="kmtBoot" type="application/json">`, decode: decodeBootPropsScript},
+}
+
+// ErrMarkerNotFound is returned when a page has none of the boot props
+// markers, which usually means it isn't a Komoot tour page
+var ErrMarkerNotFound = errors.New("start marker not found in HTML content")
+
+// extractJSONFromHTML extracts JSON data embedded in the HTML content
+func extractJSONFromHTML(htmlContent []byte) ([]byte, error) {
+	data, _, err := extractBootProps(htmlContent)
+	return data, err
+}
+
+// extractBootProps tries the given decoders and then each of
+// bootPropsMarkers, and returns the JSON data of the first one that matches,
+// along with the decoder's name
+func extractBootProps(htmlContent []byte, decoders ...PayloadDecoder) ([]byte, string, error) {
+	var errs []error
+	for _, decoder := range slices.Concat(decoders, bootPropsMarkers) {
+		data, err := decoder.Decode(htmlContent)
+		if err == nil {
+			return data, decoder.Name(), nil
+		}
+		if !errors.Is(err, ErrMarkerNotFound) {
+			errs = append(errs, fmt.Errorf("%s: %w", decoder.Name(), err))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil, "", ErrMarkerNotFound
+	}
+	return nil, "", errors.Join(errs...)
+}
+
+// decodeBootPropsString decodes boot props passed as a JSON string literal,
+// kmtBoot.setProps("{\"page\":...}")
+func decodeBootPropsString(rest []byte) ([]byte, error) {
+	literal, err := extractJSONStringLiteral(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := unquoteJSONString(literal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode boot JSON string: %w", err)
+	}
+
+	return data, nil
+}
+
+// decodeBootPropsObject decodes boot props passed as an object literal,
+// kmtBoot.setProps({"page":...})
+func decodeBootPropsObject(rest []byte) ([]byte, error) {
+	if len(rest) == 0 || rest[0] != '{' {
+		return nil, fmt.Errorf("kmtBoot.setProps argument is not a JSON object")
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(bytes.NewReader(rest)).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed to decode boot JSON object: %w", err)
+	}
+
+	return raw, nil
+}
+
+// decodeBootPropsScript decodes boot props embedded as the body of a JSON
+// script tag
+func decodeBootPropsScript(rest []byte) ([]byte, error) {
+	body, _, ok := bytes.Cut(rest, []byte("</script>"))
+	if !ok {
+		return nil, fmt.Errorf("unterminated boot props script tag")
+	}
+
+	body = bytes.TrimSpace(body)
+	if !json.Valid(body) {
+		return nil, fmt.Errorf("boot props script tag does not contain valid JSON")
+	}
+
+	return body, nil
+}
+
+// extractJSONStringLiteral returns the quoted string literal at the start of
+// input. It scans from the opening quote and skips escaped characters, so a
+// quote, ");" or backslash inside the string doesn't end it early. The literal
+// is unescaped in a single pass by unquoteJSONString afterwards.
+func extractJSONStringLiteral(input []byte) ([]byte, error) {
+	if len(input) == 0 || input[0] != '"' {
+		return nil, fmt.Errorf("kmtBoot.setProps argument is not a JSON string literal")
+	}
+
+	escaped := false
+	for idx := 1; idx < len(input); idx++ {
+		switch {
+		case escaped:
+			escaped = false
+		case input[idx] == '\\':
+			escaped = true
+		case input[idx] == '"':
+			return input[:idx+1], nil
+		}
+	}
+
+	return nil, fmt.Errorf("unterminated kmtBoot.setProps JSON string literal")
+}
+
+// unquoteJSONString unescapes a quoted JSON string literal straight into a
+// byte slice. json.Unmarshal would go through a string, costing another copy
+// of what is by far the largest value on the page.
+func unquoteJSONString(literal []byte) ([]byte, error) {
+	if len(literal) < 2 || literal[0] != '"' || literal[len(literal)-1] != '"' {
+		return nil, fmt.Errorf("not a JSON string literal")
+	}
+	literal = literal[1 : len(literal)-1]
+
+	out := make([]byte, 0, len(literal))
+	for len(literal) > 0 {
+		idx := bytes.IndexByte(literal, '\\')
+		if idx == -1 {
+			out = append(out, literal...)
+			break
+		}
+		out = append(out, literal[:idx]...)
+		literal = literal[idx:]
+		if len(literal) < 2 {
+			return nil, fmt.Errorf("truncated escape sequence")
+		}
+
+		switch literal[1] {
+		case '"', '\\', '/':
+			out = append(out, literal[1])
+		case 'b':
+			out = append(out, '\b')
+		case 'f':
+			out = append(out, '\f')
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'u':
+			r, size, err := unquoteJSONRune(literal)
+			if err != nil {
+				return nil, err
+			}
+			out = utf8.AppendRune(out, r)
+			literal = literal[size:]
+			continue
+		default:
+			return nil, fmt.Errorf("invalid escape sequence %q", literal[:2])
+		}
+		literal = literal[2:]
+	}
+
+	return out, nil
+}
+
+// unquoteJSONRune decodes the \uXXXX escape at the start of input, combining
+// a UTF-16 surrogate pair when one follows, and returns the rune and the
+// number of bytes consumed
+func unquoteJSONRune(input []byte) (rune, int, error) {
+	r, err := parseJSONHex(input)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !utf16.IsSurrogate(r) {
+		return r, 6, nil
+	}
+
+	if low, err := parseJSONHex(input[6:]); err == nil {
+		if combined := utf16.DecodeRune(r, low); combined != utf8.RuneError {
+			return combined, 12, nil
+		}
+	}
+	return utf8.RuneError, 6, nil
+}
+
+// parseJSONHex parses the code unit of a \uXXXX escape at the start of input
+func parseJSONHex(input []byte) (rune, error) {
+	if len(input) < 6 || input[0] != '\\' || input[1] != 'u' {
+		return 0, fmt.Errorf("truncated unicode escape")
+	}
+	value, err := strconv.ParseUint(string(input[2:6]), 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid unicode escape %q", input[:6])
+	}
+	return rune(value), nil
+}
@@ -0,0 +1,188 @@
+package gokomoot
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestExtractBootPropsVariants(t *testing.T) {
+	payload := `{"page":{"_embedded":{"tour":{"name":"Variant"}}}}`
+	tests := map[string]struct {
+		html   string
+		marker string
+	}{
+		"string literal": {
+			html:   `<script>kmtBoot.setProps("{\"page\":{\"_embedded\":{\"tour\":{\"name\":\"Variant\"}}}}");</script>`,
+			marker: "setProps string",
+		},
+		"object literal": {
+			html:   `<script>kmtBoot.setProps( ` + payload + `);</script>`,
+			marker: "setProps object",
+		},
+		"script tag": {
+			html:   `<script id="kmtBoot" type="application/json">` + "\n" + payload + "\n</script>",
+			marker: "script tag",
+		},
+	}
+	for name, tt := range tests {
+		data, marker, err := extractBootProps([]byte(tt.html))
+		if err != nil {
+			t.Fatalf("%s: extractBootProps() error = %v", name, err)
+		}
+		if string(data) != payload || marker != tt.marker {
+			t.Fatalf("%s: extractBootProps() = %q, %q, want %q, %q", name, data, marker, payload, tt.marker)
+		}
+	}
+}
+
+func TestExtractBootPropsFallsThroughBrokenVariant(t *testing.T) {
+	html := `<script>kmtBoot.setProps(undefined);</script>` +
+		`<script id="kmtBoot" type="application/json">{"page":{}}</script>`
+
+	data, marker, err := extractBootProps([]byte(html))
+	if err != nil {
+		t.Fatalf("extractBootProps() error = %v", err)
+	}
+	if string(data) != `{"page":{}}` || marker != "script tag" {
+		t.Fatalf("extractBootProps() = %q, %q, want script tag data", data, marker)
+	}
+}
+
+func TestExtractBootPropsReportsEachFailedVariant(t *testing.T) {
+	_, _, err := extractBootProps([]byte(`<script>kmtBoot.setProps(undefined);</script>`))
+	if err == nil {
+		t.Fatal("extractBootProps() error = nil, want error")
+	}
+	for _, want := range []string{"setProps string", "setProps object"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("extractBootProps() error = %v, want mention of %q", err, want)
+		}
+	}
+}
+
+// windowTourDecoder is a PayloadDecoder for a made-up variant assigning the
+// boot props to window.__TOUR__
+type windowTourDecoder struct{}
+
+func (windowTourDecoder) Name() string { return "window tour" }
+
+func (windowTourDecoder) Decode(htmlContent []byte) ([]byte, error) {
+	_, rest, ok := strings.Cut(string(htmlContent), "window.__TOUR__ = ")
+	if !ok {
+		return nil, ErrMarkerNotFound
+	}
+	body, _, _ := strings.Cut(rest, ";</script>")
+	return []byte(body), nil
+}
+
+func TestExtractBootPropsTriesPayloadDecodersFirst(t *testing.T) {
+	payload := `{"page":{}}`
+	tests := map[string]struct {
+		html   string
+		marker string
+	}{
+		"custom variant": {
+			html:   `<script>window.__TOUR__ = ` + payload + `;</script><script>kmtBoot.setProps({"page":null});</script>`,
+			marker: "window tour",
+		},
+		"fallback": {
+			html:   `<script>kmtBoot.setProps(` + payload + `);</script>`,
+			marker: "setProps object",
+		},
+	}
+	for name, tt := range tests {
+		data, marker, err := extractBootProps([]byte(tt.html), windowTourDecoder{})
+		if err != nil {
+			t.Fatalf("%s: extractBootProps() error = %v", name, err)
+		}
+		if string(data) != payload || marker != tt.marker {
+			t.Fatalf("%s: extractBootProps() = %q, %q, want %q, %q", name, data, marker, payload, tt.marker)
+		}
+	}
+
+	_, _, err := extractBootProps([]byte(`<p>not a tour</p>`), windowTourDecoder{})
+	if !errors.Is(err, ErrMarkerNotFound) {
+		t.Fatalf("extractBootProps() error = %v, want ErrMarkerNotFound", err)
+	}
+}
+
+func TestExtractJSONFromHTMLKeepsQuoteAndBackslashInStrings(t *testing.T) {
+	name := `Lake "); loop \ via C:\tours\ and \"quoted\"`
+	tour, err := json.Marshal(map[string]any{"page": map[string]any{"_embedded": map[string]any{"tour": map[string]any{"name": name}}}})
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	literal, err := json.Marshal(string(tour))
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	html := `<script>kmtBoot.setProps(` + string(literal) + `);</script><script>other("x");</script>`
+	data, err := extractJSONFromHTML([]byte(html))
+	if err != nil {
+		t.Fatalf("extractJSONFromHTML() error = %v", err)
+	}
+
+	var response KomootResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if got := response.Page.Embedded.Tour.Name; got != name {
+		t.Fatalf("tour name = %q, want %q", got, name)
+	}
+}
+
+func TestUnquoteJSONStringMatchesUnmarshal(t *testing.T) {
+	for _, input := range []string{
+		"plain",
+		`quote " backslash \ slash /`,
+		"control \b\f\n\r\t characters",
+		"umlaut ü, emoji 🚲, <script> & more",
+		"",
+	} {
+		literal, err := json.Marshal(input)
+		if err != nil {
+			t.Fatalf("json.Marshal() error = %v", err)
+		}
+		literal = []byte(strings.ReplaceAll(string(literal), "/", `\/`))
+
+		got, err := unquoteJSONString(literal)
+		if err != nil {
+			t.Fatalf("unquoteJSONString(%s) error = %v", literal, err)
+		}
+		if string(got) != input {
+			t.Fatalf("unquoteJSONString(%s) = %q, want %q", literal, got, input)
+		}
+	}
+}
+
+func TestUnquoteJSONStringRejectsBadEscapes(t *testing.T) {
+	for _, literal := range []string{`"\x"`, `"\u12"`, `"\u12zz"`, `"trailing \"`, `unquoted`} {
+		if _, err := unquoteJSONString([]byte(literal)); err == nil {
+			t.Fatalf("unquoteJSONString(%s) error = nil, want error", literal)
+		}
+	}
+}
+
+func BenchmarkParseTourPage(b *testing.B) {
+	literal, err := json.Marshal(string(syntheticTourJSON(200000)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	html := []byte(`<html><body><script>kmtBoot.setProps(` + string(literal) + `);</script></body></html>`)
+	config := DefaultConfig()
+	config.Logger = log.New(io.Discard, "", 0)
+	converter := NewConverter(config)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := converter.parseTourPage(html); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
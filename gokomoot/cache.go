@@ -0,0 +1,155 @@
+package gokomoot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// ErrUnchanged is returned by fetches that found the tour unchanged since
+// its outputs were last written, when Configuration.CacheDir is set. Convert
+// and ConvertBatch skip such tours instead of failing.
+var ErrUnchanged = errors.New("tour unchanged")
+
+// cacheValidators are the HTTP validators of a tour page response, sent back
+// with the next request to make it conditional
+type cacheValidators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+// cacheEntry is the sidecar file recorded for a tour and destination after
+// its outputs were written
+type cacheEntry struct {
+	Validators cacheValidators `json:"validators"`
+	// Hash is the SHA-256 of the tour data, for pages without validators
+	Hash    string   `json:"hash"`
+	Outputs []string `json:"outputs"`
+}
+
+// tourCache tracks the cache state of one tour conversion
+type tourCache struct {
+	path string
+	// previous is the entry of the last run, nil when there is none or
+	// one of its outputs is gone
+	previous *cacheEntry
+	// validators and hash describe the response of this run
+	validators cacheValidators
+	hash       string
+}
+
+// openTourCache loads the cache entry for converting tourURL to destination
+// with the current output settings, so a run with another format or
+// transformation doesn't skip the tour. It returns nil when caching is off,
+// as it is for dry runs.
+func (c *Converter) openTourCache(tourURL, destination string) *tourCache {
+	if c.config.CacheDir == "" || c.config.DryRun {
+		return nil
+	}
+
+	key := sha256.Sum256([]byte(tourURL + "\n" + destination + "\n" + c.outputSettings()))
+	cache := &tourCache{path: filepath.Join(c.config.CacheDir, hex.EncodeToString(key[:16])+".json")}
+	data, err := os.ReadFile(cache.path)
+	if err != nil {
+		return cache
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		c.logger.Printf("Ignoring unreadable cache file %s: %v\n", cache.path, err)
+		return cache
+	}
+	for _, output := range entry.Outputs {
+		filename, isFile := localFile(output)
+		if !isFile {
+			return cache
+		}
+		if _, err := os.Stat(filename); err != nil {
+			return cache
+		}
+	}
+	cache.previous = &entry
+	return cache
+}
+
+// outputSettings describes the configuration that shapes the written output:
+// everything but the fields for fetching, logging and hooks, which are
+// cleared. The clip bounds are printed by value rather than by address.
+func (c *Converter) outputSettings() string {
+	settings := c.config
+	settings.UserAgent, settings.RotateUserAgent, settings.SessionCookie = "", false, ""
+	settings.HTTPTimeout, settings.TourTimeout, settings.MaxBackoff = 0, 0, 0
+	settings.MaxRetries, settings.RetryInterval, settings.RetryBudget = 0, 0, 0
+	settings.RequestsPerSecond, settings.Concurrency, settings.ConcurrencyPerHost = 0, 0, 0
+	settings.DNSCacheTTL, settings.Proxy, settings.HTTPClient = 0, nil, nil
+	settings.MaxIdleConnsPerHost, settings.IdleConnTimeout, settings.ForceAttemptHTTP2 = 0, 0, false
+	settings.Middlewares, settings.OnRetry, settings.PayloadDecoders = nil, nil, nil
+	settings.Verbosity, settings.Logger, settings.Reporter = 0, nil, nil
+	settings.Destinations, settings.CacheDir, settings.Overwrite = nil, "", false
+
+	var bounds Bounds
+	if settings.ClipBounds != nil {
+		bounds, settings.ClipBounds = *settings.ClipBounds, nil
+	}
+	return fmt.Sprintf("%#v %#v", settings, bounds)
+}
+
+// setConditionalHeaders makes req conditional on the validators of the last
+// run
+func (t *tourCache) setConditionalHeaders(req *http.Request) {
+	if t == nil || t.previous == nil {
+		return
+	}
+	if etag := t.previous.Validators.ETag; etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := t.previous.Validators.LastModified; lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+}
+
+// recordValidators keeps the validators of a successful response
+func (t *tourCache) recordValidators(resp *http.Response) {
+	if t == nil {
+		return
+	}
+	t.validators = cacheValidators{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+}
+
+// unchanged hashes the tour data and reports whether it matches the last run
+func (t *tourCache) unchanged(komootResp *KomootResponse) bool {
+	if t == nil {
+		return false
+	}
+	data, err := json.Marshal(komootResp.Page.Embedded.Tour)
+	if err != nil {
+		return false
+	}
+	sum := sha256.Sum256(data)
+	t.hash = hex.EncodeToString(sum[:])
+	return t.previous != nil && t.previous.Hash == t.hash
+}
+
+// saveTourCache records the outputs written for a tour so the next run can
+// skip it while it is unchanged. Failing to save only costs that skip, so
+// it is logged rather than returned.
+func (c *Converter) saveTourCache(cache *tourCache, outputs []string) {
+	if cache == nil {
+		return
+	}
+
+	data, err := json.Marshal(cacheEntry{Validators: cache.validators, Hash: cache.hash, Outputs: outputs})
+	if err == nil {
+		err = os.MkdirAll(c.config.CacheDir, 0o755)
+	}
+	if err == nil {
+		err = os.WriteFile(cache.path, data, 0o644)
+	}
+	if err != nil {
+		c.logger.Printf("Warning: failed to update cache file %s: %v\n", cache.path, err)
+	}
+}
@@ -0,0 +1,118 @@
+package gokomoot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConvertSkipsTourNotModified(t *testing.T) {
+	page := tourPageHTML(t, `{"page":{"_embedded":{"tour":{"id":1,"name":"Loop","_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35}]}}}}}}`)
+	var conditional []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conditional = append(conditional, r.Header.Get("If-None-Match"))
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, page)
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.CacheDir = t.TempDir()
+	config.Verbosity = VerbosityQuiet
+	converter := NewConverter(config)
+	outputPath := filepath.Join(t.TempDir(), "loop.gpx")
+
+	// The second run must not write: without -overwrite it would fail on the
+	// existing file.
+	for run := range 2 {
+		if err := converter.Convert(context.Background(), server.URL+"/tour/1", outputPath); err != nil {
+			t.Fatalf("Convert() run %d error = %v", run+1, err)
+		}
+	}
+	if len(conditional) != 2 || conditional[0] != "" || conditional[1] != `"v1"` {
+		t.Fatalf("If-None-Match headers = %q, want none and then \"v1\"", conditional)
+	}
+
+	// A deleted output is written again, unconditionally.
+	if err := os.Remove(outputPath); err != nil {
+		t.Fatalf("os.Remove() error = %v", err)
+	}
+	if err := converter.Convert(context.Background(), server.URL+"/tour/1", outputPath); err != nil {
+		t.Fatalf("Convert() after removing the output error = %v", err)
+	}
+	if _, err := os.Stat(outputPath); err != nil || conditional[2] != "" {
+		t.Fatalf("output %v, If-None-Match %q, want the output rewritten unconditionally", err, conditional[2])
+	}
+}
+
+func TestConvertBatchSkipsTourWithSameHash(t *testing.T) {
+	name := "Loop"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, tourPageHTML(t, `{"page":{"_embedded":{"tour":{"id":1,"name":"`+name+`","_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35}]}}}}}}`))
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.CacheDir = t.TempDir()
+	config.Verbosity = VerbosityQuiet
+	converter := NewConverter(config)
+	outputDir := t.TempDir()
+	urls := []string{server.URL + "/tour/1"}
+
+	if written, err := converter.ConvertBatch(context.Background(), urls, outputDir); err != nil || len(written) != 1 {
+		t.Fatalf("ConvertBatch() = %v, %v, want one file", written, err)
+	}
+	if written, err := converter.ConvertBatch(context.Background(), urls, outputDir); err != nil || len(written) != 0 {
+		t.Fatalf("ConvertBatch() of an unchanged tour = %v, %v, want nothing written", written, err)
+	}
+
+	name = "Longer Loop"
+	if written, err := converter.ConvertBatch(context.Background(), urls, outputDir); err != nil || len(written) != 1 || filepath.Base(written[0]) != "longer-loop-1.gpx" {
+		t.Fatalf("ConvertBatch() of a changed tour = %v, %v, want longer-loop-1.gpx", written, err)
+	}
+}
+
+func TestConvertBatchRewritesTourWithOtherSettings(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, tourPageHTML(t, `{"page":{"_embedded":{"tour":{"id":1,"name":"Loop","_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35},{"lat":51.501,"lng":-0.12,"alt":36}]}}}}}}`))
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.CacheDir = t.TempDir()
+	config.Verbosity = VerbosityQuiet
+	config.Overwrite = true
+	outputDir := t.TempDir()
+	urls := []string{server.URL + "/tour/1"}
+
+	if written, err := NewConverter(config).ConvertBatch(context.Background(), urls, outputDir); err != nil || len(written) != 1 {
+		t.Fatalf("ConvertBatch() = %v, %v, want one file", written, err)
+	}
+
+	// Neither another format nor another transformation counts as unchanged,
+	// while settings that don't shape the output, such as the retries, do.
+	for name, change := range map[string]func(*Configuration){
+		"format":   func(c *Configuration) { c.Format = FormatGeoJSON },
+		"simplify": func(c *Configuration) { c.SimplifyTolerance = 5 },
+		"clip":     func(c *Configuration) { c.ClipBounds = &Bounds{MinLat: 51, MinLon: -1, MaxLat: 52, MaxLon: 0} },
+	} {
+		changed := config
+		change(&changed)
+		if written, err := NewConverter(changed).ConvertBatch(context.Background(), urls, outputDir); err != nil || len(written) != 1 {
+			t.Fatalf("ConvertBatch() with another %s = %v, %v, want one file", name, written, err)
+		}
+	}
+	retries := config
+	retries.MaxRetries = 7
+	if written, err := NewConverter(retries).ConvertBatch(context.Background(), urls, outputDir); err != nil || len(written) != 0 {
+		t.Fatalf("ConvertBatch() with other retries = %v, %v, want nothing written", written, err)
+	}
+}
@@ -0,0 +1,57 @@
+package gokomoot
+
+// contains reports whether p lies inside b, counting the edges as inside
+func (b Bounds) contains(p Point) bool {
+	return p.Lat >= b.MinLat && p.Lat <= b.MaxLat && p.Lon >= b.MinLon && p.Lon <= b.MaxLon
+}
+
+// ClipToBounds returns a copy of the GPX with only the track points and
+// waypoints inside bounds. A segment that leaves the box and comes back is
+// split into one segment per stretch inside it, and tracks left without
+// points are dropped, so the result holds no empty segments or tracks. The
+// metadata bounds are recomputed and the whole-track distance is dropped.
+func (g *GPX) ClipToBounds(bounds Bounds) *GPX {
+	clipped := *g
+	clipped.Tracks = nil
+	for _, track := range g.Tracks {
+		var segments []Segment
+		for _, segment := range track.Segments {
+			var inside []Point
+			for _, point := range segment.Points {
+				if bounds.contains(point) {
+					inside = append(inside, point)
+					continue
+				}
+				if len(inside) > 0 {
+					segments = append(segments, Segment{Points: inside})
+					inside = nil
+				}
+			}
+			if len(inside) > 0 {
+				segments = append(segments, Segment{Points: inside})
+			}
+		}
+		if len(segments) > 0 {
+			clipped.Tracks = append(clipped.Tracks, Track{Name: track.Name, Type: track.Type, Segments: segments})
+		}
+	}
+
+	clipped.Waypoints = nil
+	for _, waypoint := range g.Waypoints {
+		if bounds.contains(Point{Lat: waypoint.Lat, Lon: waypoint.Lon}) {
+			clipped.Waypoints = append(clipped.Waypoints, waypoint)
+		}
+	}
+
+	if g.Metadata != nil {
+		metadata := *g.Metadata
+		if metadata.Extensions != nil {
+			extensions := *metadata.Extensions
+			extensions.Distance = ""
+			metadata.Extensions = &extensions
+		}
+		clipped.Metadata = &metadata
+	}
+	clipped.setBounds()
+	return &clipped
+}
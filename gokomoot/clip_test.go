@@ -0,0 +1,53 @@
+package gokomoot
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClipToBoundsSplitsAtExits(t *testing.T) {
+	gpx := &GPX{
+		Version:  "1.1",
+		Metadata: &Metadata{Name: "Tour", Extensions: &MetadataExtensions{Distance: "1000.0"}},
+		Tracks: []Track{
+			{Name: "Tour", Type: "hike", Segments: []Segment{{Points: []Point{
+				{Lat: 0, Lon: 0}, {Lat: 1, Lon: 1}, {Lat: 5, Lon: 5}, {Lat: 2, Lon: 2}, {Lat: 2, Lon: 3},
+			}}}},
+			{Name: "Elsewhere", Segments: []Segment{{Points: []Point{{Lat: 9, Lon: 9}}}}},
+		},
+		Waypoints: []Waypoint{{Lat: 1, Lon: 2, Name: "inside"}, {Lat: 8, Lon: 8, Name: "outside"}},
+	}
+
+	clipped := gpx.ClipToBounds(Bounds{MinLat: 1, MinLon: 1, MaxLat: 3, MaxLon: 3})
+
+	if len(clipped.Tracks) != 1 || clipped.Tracks[0].Type != "hike" {
+		t.Fatalf("ClipToBounds() tracks = %#v, want only the first track", clipped.Tracks)
+	}
+	segments := clipped.Tracks[0].Segments
+	if len(segments) != 2 || len(segments[0].Points) != 1 || len(segments[1].Points) != 2 {
+		t.Fatalf("ClipToBounds() segments = %#v, want [1,1] then [2,2] [2,3]", segments)
+	}
+	if len(clipped.Waypoints) != 1 || clipped.Waypoints[0].Name != "inside" {
+		t.Fatalf("ClipToBounds() waypoints = %#v, want only the inside one", clipped.Waypoints)
+	}
+	if bounds := clipped.Metadata.Bounds; bounds == nil || *bounds != (Bounds{MinLat: 1, MinLon: 1, MaxLat: 2, MaxLon: 3}) {
+		t.Fatalf("ClipToBounds() bounds = %#v, want the clipped extent", bounds)
+	}
+	if clipped.Metadata.Extensions.Distance != "" || gpx.Metadata.Extensions.Distance != "1000.0" {
+		t.Fatal("ClipToBounds() kept the stale distance or changed the original metadata")
+	}
+	if len(gpx.Tracks) != 2 || len(gpx.Tracks[0].Segments[0].Points) != 5 {
+		t.Fatal("ClipToBounds() modified the input GPX")
+	}
+}
+
+func TestProcessGPXFailsWhenNothingIsInsideBounds(t *testing.T) {
+	config := DefaultConfig()
+	config.ClipBounds = &Bounds{MinLat: -10, MinLon: -10, MaxLat: -9, MaxLon: -9}
+	gpx := &GPX{Tracks: []Track{{Segments: []Segment{{Points: []Point{{Lat: 1, Lon: 1}}}}}}}
+
+	_, err := NewConverter(config).processGPX(gpx, 0)
+	if err == nil || !strings.Contains(err.Error(), "no track points inside") {
+		t.Fatalf("processGPX() error = %v, want no points inside error", err)
+	}
+}
@@ -0,0 +1,223 @@
+package gokomoot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// collectionPathPattern matches the numeric ID in a collection URL path, with
+// or without a locale prefix and the collection's name
+var collectionPathPattern = regexp.MustCompile(`^(/[a-z]{2}-[a-z]{2})?/collection/(\d+)(/[^/]*)?/?$`)
+
+// ParseCollectionPath returns the ID of the collection a Komoot URL path
+// points to. ok is false when path is not a collection page.
+func ParseCollectionPath(path string) (id string, ok bool) {
+	match := collectionPathPattern.FindStringSubmatch(path)
+	if match == nil {
+		return "", false
+	}
+	return match[2], true
+}
+
+// ErrCollection is returned when a collection URL is converted as a tour;
+// CollectionTourURLs lists the tours to convert instead
+var ErrCollection = errors.New("link is a collection, not a tour")
+
+// komootCollection is the part of a collection page's boot props that lists
+// the collection's items
+type komootCollection struct {
+	Page struct {
+		Embedded struct {
+			CollectionHal *struct {
+				Embedded struct {
+					Compilation struct {
+						Embedded struct {
+							Items []komootCollectionItem `json:"items"`
+						} `json:"_embedded"`
+					} `json:"compilation"`
+				} `json:"_embedded"`
+			} `json:"collectionHal"`
+		} `json:"_embedded"`
+	} `json:"page"`
+}
+
+// komootCollectionItem is one item of a collection, a tour or a highlight
+type komootCollectionItem struct {
+	ID   TourID `json:"id"`
+	Type string `json:"type"`
+}
+
+// komootCollectionPage is one page of a collection's items from the API
+type komootCollectionPage struct {
+	Embedded struct {
+		Items []komootCollectionItem `json:"items"`
+	} `json:"_embedded"`
+	Page struct {
+		TotalPages int `json:"totalPages"`
+	} `json:"page"`
+}
+
+// collectionPageSize is the number of items asked for per API page
+const collectionPageSize = 100
+
+// collectionStrategy is one way of listing the tours in a collection
+type collectionStrategy struct {
+	name string
+	list func(c *Converter, ctx context.Context, collectionURL, id string) ([]string, error)
+}
+
+// collectionStrategies are tried in order until one lists the collection's
+// tours. The API pages through the whole collection while the page only
+// embeds its first items, so the API goes first.
+var collectionStrategies = []collectionStrategy{
+	{name: "api", list: (*Converter).collectionTourIDsFromAPI},
+	{name: "scrape", list: (*Converter).scrapeCollectionTourIDs},
+}
+
+// IsCollectionURL reports whether link points to a Komoot collection rather
+// than a single tour
+func IsCollectionURL(link string) bool {
+	parsedURL, err := url.Parse(link)
+	return err == nil && collectionPathPattern.MatchString(parsedURL.Path)
+}
+
+// extractCollectionTourIDs returns the IDs of the tours in the boot props of
+// a collection page, in the collection's order. Highlights and other items
+// that aren't tours are skipped.
+func extractCollectionTourIDs(jsonData []byte) ([]string, error) {
+	var collection komootCollection
+	if err := json.Unmarshal(jsonData, &collection); err != nil {
+		return nil, fmt.Errorf("failed to parse collection JSON data: %w", err)
+	}
+	if collection.Page.Embedded.CollectionHal == nil {
+		return nil, errors.New("page data has no collection")
+	}
+
+	ids := collectionTourIDs(collection.Page.Embedded.CollectionHal.Embedded.Compilation.Embedded.Items)
+	if len(ids) == 0 {
+		return nil, errors.New("collection contains no tours")
+	}
+	return ids, nil
+}
+
+// collectionTourIDs returns the IDs of the tours among items, skipping
+// highlights and other items that aren't tours
+func collectionTourIDs(items []komootCollectionItem) []string {
+	var ids []string
+	for _, item := range items {
+		if strings.HasPrefix(item.Type, "tour") && item.ID != "" {
+			ids = append(ids, string(item.ID))
+		}
+	}
+	return ids
+}
+
+// fetchCollectionTourIDs returns the IDs of the tours in the collection with
+// the given ID, falling back through the collection strategies allowed by
+// Configuration.Fetch when an earlier one fails
+func (c *Converter) fetchCollectionTourIDs(ctx context.Context, collectionURL, id string) ([]string, error) {
+	allowed, err := c.strategies()
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, strategy := range collectionStrategies {
+		if !slices.ContainsFunc(allowed, func(s fetchStrategy) bool { return s.name == strategy.name }) {
+			continue
+		}
+
+		ids, err := strategy.list(c, ctx, collectionURL, id)
+		if err == nil {
+			c.logger.Verbosef("Listed the collection using %s strategy\n", strategy.name)
+			return ids, nil
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %w", strategy.name, err))
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			break
+		}
+		c.logger.Printf("Listing the collection with %s strategy failed: %v\n", strategy.name, err)
+	}
+
+	return nil, fmt.Errorf("failed to list collection: %w", errors.Join(errs...))
+}
+
+// collectionTourIDsFromAPI pages through the collection's items in the
+// Komoot API and returns the IDs of its tours
+func (c *Converter) collectionTourIDsFromAPI(ctx context.Context, collectionURL, id string) ([]string, error) {
+	baseURL := fmt.Sprintf("%s/collections/%s/compilation", strings.TrimSuffix(c.config.APIBaseURL, "/"), id)
+
+	var ids []string
+	for page := 0; ; page++ {
+		apiURL := fmt.Sprintf("%s?page=%d&limit=%d", baseURL, page, collectionPageSize)
+		c.logger.Printf("Requesting collection items from %s\n", apiURL)
+		body, err := c.makeJSONRequest(ctx, apiURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download collection: %w", err)
+		}
+
+		var items komootCollectionPage
+		if err := json.Unmarshal(body, &items); err != nil {
+			return nil, fmt.Errorf("failed to parse API JSON data: %w", err)
+		}
+		ids = append(ids, collectionTourIDs(items.Embedded.Items)...)
+		if len(items.Embedded.Items) == 0 || page+1 >= items.Page.TotalPages {
+			break
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil, errors.New("collection contains no tours")
+	}
+	return ids, nil
+}
+
+// scrapeCollectionTourIDs downloads the collection page and returns the IDs
+// of the tours embedded in it
+func (c *Converter) scrapeCollectionTourIDs(ctx context.Context, collectionURL, id string) ([]string, error) {
+	c.logger.Printf("Downloading collection from %s\n", collectionURL)
+	html, err := c.makeHTTPRequest(ctx, collectionURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download collection: %w", err)
+	}
+	jsonData, _, err := extractBootProps(html, c.config.PayloadDecoders...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract JSON data: %w", err)
+	}
+	return extractCollectionTourIDs(jsonData)
+}
+
+// CollectionTourURLs downloads a collection page and returns the URLs of the
+// tours it contains, on the same host as collectionURL, ready to be passed
+// to ConvertBatch or ConvertMerged
+func (c *Converter) CollectionTourURLs(ctx context.Context, collectionURL string) ([]string, error) {
+	parsedURL, err := url.Parse(collectionURL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing URL: %w", err)
+	}
+	match := collectionPathPattern.FindStringSubmatch(parsedURL.Path)
+	if match == nil {
+		return nil, fmt.Errorf("%q is not a Komoot collection", collectionURL)
+	}
+	prefix := match[1]
+
+	ids, err := c.fetchCollectionTourIDs(ctx, collectionURL, match[2])
+	if err != nil {
+		return nil, err
+	}
+
+	urls := make([]string, len(ids))
+	for i, id := range ids {
+		tourURL := url.URL{Scheme: parsedURL.Scheme, Host: parsedURL.Host, Path: prefix + "/tour/" + id}
+		urls[i] = tourURL.String()
+	}
+	c.logger.Printf("Found %d tours in the collection\n", len(urls))
+	return urls, nil
+}
@@ -0,0 +1,165 @@
+package gokomoot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const collectionPayload = `{"page":{"_embedded":{"collectionHal":{"name":"Alpine crossing","_embedded":{"compilation":{"_embedded":{"items":[` +
+	`{"id":111,"type":"tour_planned","name":"Day 1"},` +
+	`{"id":"h9","type":"highlight_point","name":"Summit"},` +
+	`{"id":"222","type":"tour_recorded","name":"Day 2"}]}}}}}}}`
+
+func TestExtractCollectionTourIDs(t *testing.T) {
+	ids, err := extractCollectionTourIDs([]byte(collectionPayload))
+	if err != nil {
+		t.Fatalf("extractCollectionTourIDs() error = %v", err)
+	}
+	if want := []string{"111", "222"}; !slices.Equal(ids, want) {
+		t.Fatalf("extractCollectionTourIDs() = %v, want %v", ids, want)
+	}
+
+	for payload, want := range map[string]string{
+		`{"page":{"_embedded":{"tour":{"id":1}}}}`: "no collection",
+		`{"page":{"_embedded":{"collectionHal":{"_embedded":{"compilation":{"_embedded":{"items":[{"id":"h9","type":"highlight_point"}]}}}}}}}`: "no tours",
+		`{"page":`: "failed to parse",
+	} {
+		if _, err := extractCollectionTourIDs([]byte(payload)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("extractCollectionTourIDs(%s) error = %v, want %q", payload, err, want)
+		}
+	}
+}
+
+func TestParseCollectionPath(t *testing.T) {
+	tests := map[string]string{
+		"/collection/77":                       "77",
+		"/de-de/collection/77/alpine-crossing": "77",
+		"/collection/77/alpine-crossing/":      "77",
+		"/collection/abc":                      "",
+		"/collection/77/alpine-crossing/extra": "",
+		"/tour/77":                             "",
+	}
+	for path, want := range tests {
+		if got, ok := ParseCollectionPath(path); got != want || ok != (want != "") {
+			t.Fatalf("ParseCollectionPath(%q) = %q, %t, want %q", path, got, ok, want)
+		}
+	}
+}
+
+func TestCollectionTourURLs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/de-de/collection/77/alpine-crossing" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, tourPageHTML(t, collectionPayload))
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.Verbosity = VerbosityQuiet
+	config.APIBaseURL = server.URL + "/v007"
+	urls, err := NewConverter(config).CollectionTourURLs(context.Background(), server.URL+"/de-de/collection/77/alpine-crossing")
+	if err != nil {
+		t.Fatalf("CollectionTourURLs() error = %v", err)
+	}
+	if want := []string{server.URL + "/de-de/tour/111", server.URL + "/de-de/tour/222"}; !slices.Equal(urls, want) {
+		t.Fatalf("CollectionTourURLs() = %v, want %v", urls, want)
+	}
+}
+
+func TestCollectionTourURLsPagesThroughAPI(t *testing.T) {
+	pages := []string{
+		`{"_embedded":{"items":[{"id":111,"type":"tour_planned"},{"id":"h9","type":"highlight_point"}]},"page":{"totalPages":2}}`,
+		`{"_embedded":{"items":[{"id":222,"type":"tour_recorded"}]},"page":{"totalPages":2}}`,
+	}
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RequestURI())
+		if r.URL.Path != "/v007/collections/77/compilation" || !strings.Contains(r.Header.Get("Accept"), "application/hal+json") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/hal+json;charset=utf-8")
+		switch r.URL.Query().Get("page") {
+		case "0":
+			fmt.Fprint(w, pages[0])
+		case "1":
+			fmt.Fprint(w, pages[1])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.Verbosity = VerbosityQuiet
+	config.APIBaseURL = server.URL + "/v007"
+	urls, err := NewConverter(config).CollectionTourURLs(context.Background(), server.URL+"/collection/77/alpine-crossing")
+	if err != nil {
+		t.Fatalf("CollectionTourURLs() error = %v", err)
+	}
+	if want := []string{server.URL + "/tour/111", server.URL + "/tour/222"}; !slices.Equal(urls, want) {
+		t.Fatalf("CollectionTourURLs() = %v, want %v", urls, want)
+	}
+	if want := []string{"/v007/collections/77/compilation?page=0&limit=100", "/v007/collections/77/compilation?page=1&limit=100"}; !slices.Equal(requests, want) {
+		t.Fatalf("requests = %v, want %v", requests, want)
+	}
+}
+
+func TestCollectionTourURLsRejectsHTMLFromAPI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, "<html>Please log in</html>")
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.Verbosity = VerbosityQuiet
+	config.APIBaseURL = server.URL + "/v007"
+	config.Fetch = FetchAPI
+	_, err := NewConverter(config).CollectionTourURLs(context.Background(), server.URL+"/collection/77")
+	if err == nil || !strings.Contains(err.Error(), `expected JSON`) || !strings.Contains(err.Error(), "text/html") {
+		t.Fatalf("CollectionTourURLs() error = %v, want an error naming the HTML content type", err)
+	}
+}
+
+func TestCollectionTourURLsHonorsFetchMode(t *testing.T) {
+	var apiRequests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v007/") {
+			apiRequests++
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, tourPageHTML(t, collectionPayload))
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.Verbosity = VerbosityQuiet
+	config.APIBaseURL = server.URL + "/v007"
+	config.Fetch = FetchHTML
+	if _, err := NewConverter(config).CollectionTourURLs(context.Background(), server.URL+"/collection/77"); err != nil || apiRequests != 0 {
+		t.Fatalf("CollectionTourURLs() with -fetch html error = %v, %d API requests, want page only", err, apiRequests)
+	}
+
+	config.Fetch = FetchAPI
+	if _, err := NewConverter(config).CollectionTourURLs(context.Background(), server.URL+"/collection/77"); err == nil || apiRequests != 1 {
+		t.Fatalf("CollectionTourURLs() with -fetch api error = %v, %d API requests, want API failure", err, apiRequests)
+	}
+}
+
+func TestFetchGPXRejectsCollections(t *testing.T) {
+	config := DefaultConfig()
+	config.Verbosity = VerbosityQuiet
+	if _, err := NewConverter(config).FetchGPX(context.Background(), "https://www.komoot.com/collection/77"); !errors.Is(err, ErrCollection) {
+		t.Fatalf("FetchGPX() error = %v, want ErrCollection", err)
+	}
+}
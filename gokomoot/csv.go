@@ -0,0 +1,52 @@
+package gokomoot
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// csvCoordinateDecimals is the number of decimals written for latitude and
+// longitude, about 1 cm of precision
+const csvCoordinateDecimals = 7
+
+// writeCSV writes the points of the first track as lat,lon,ele,time rows
+// under a header row. The ele and time columns are empty for points without
+// an elevation or time.
+func writeCSV(gpx *GPX, w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"lat", "lon", "ele", "time"}); err != nil {
+		return fmt.Errorf("error writing CSV header: %w", err)
+	}
+
+	if len(gpx.Tracks) > 0 {
+		for _, segment := range gpx.Tracks[0].Segments {
+			for _, point := range segment.Points {
+				elevation, pointTime := "", ""
+				if !point.NoElevation {
+					elevation = strconv.FormatFloat(point.Elevation, 'f', -1, 64)
+				}
+				if point.Time != nil {
+					pointTime = point.Time.UTC().Format(time.RFC3339Nano)
+				}
+				record := []string{
+					strconv.FormatFloat(point.Lat, 'f', csvCoordinateDecimals, 64),
+					strconv.FormatFloat(point.Lon, 'f', csvCoordinateDecimals, 64),
+					elevation,
+					pointTime,
+				}
+				if err := writer.Write(record); err != nil {
+					return fmt.Errorf("error writing CSV row: %w", err)
+				}
+			}
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing CSV: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package gokomoot
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWriteCSV(t *testing.T) {
+	start := time.Date(2021, 6, 5, 7, 30, 0, 500000000, time.UTC)
+	gpx := &GPX{Tracks: []Track{
+		{Segments: []Segment{
+			{Points: []Point{{Lat: 52.516839, Lon: 13.25041, Elevation: 50.4, Time: &start}}},
+			{Points: []Point{{Lat: -33.5, Lon: 151, Elevation: -1}}},
+		}},
+		{Name: "preview", Segments: []Segment{{Points: []Point{{Lat: 1, Lon: 2}}}}},
+	}}
+
+	var buf bytes.Buffer
+	if err := writeCSV(gpx, &buf); err != nil {
+		t.Fatalf("writeCSV() error = %v", err)
+	}
+
+	want := "lat,lon,ele,time\n" +
+		"52.5168390,13.2504100,50.4,2021-06-05T07:30:00.5Z\n" +
+		"-33.5000000,151.0000000,-1,\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("writeCSV() = %q, want %q", got, want)
+	}
+}
+
+func TestWriteCSVWithoutTracksWritesHeader(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeCSV(&GPX{}, &buf); err != nil {
+		t.Fatalf("writeCSV() error = %v", err)
+	}
+	if got := buf.String(); got != "lat,lon,ele,time\n" {
+		t.Fatalf("writeCSV() = %q, want header only", got)
+	}
+}
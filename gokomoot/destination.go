@@ -0,0 +1,211 @@
+package gokomoot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DestinationResolver opens the writer for an output destination. Resolvers
+// are registered per URL scheme in Configuration.Destinations, so remote
+// targets such as s3:// or http:// can be added without touching the
+// converter.
+type DestinationResolver interface {
+	// Open returns a writer for target, the destination with its scheme
+	// prefix removed. The converter closes the writer once encoding
+	// succeeded; a failed Close fails the conversion.
+	Open(target string) (io.WriteCloser, error)
+}
+
+// DestinationResolverFunc adapts a function to the DestinationResolver
+// interface
+type DestinationResolverFunc func(target string) (io.WriteCloser, error)
+
+// Open calls f(target)
+func (f DestinationResolverFunc) Open(target string) (io.WriteCloser, error) {
+	return f(target)
+}
+
+// aborter is implemented by writers that can discard what was written when
+// encoding fails, instead of committing it on Close
+type aborter interface {
+	Abort() error
+}
+
+// ErrOutputExists is returned when an output file already exists and
+// Configuration.Overwrite is not set
+var ErrOutputExists = errors.New("output file already exists")
+
+// Built-in destination schemes
+const (
+	SchemeFile   = "file"
+	SchemeStdout = "stdout"
+)
+
+// builtinDestinations are the resolvers available without configuration
+var builtinDestinations = map[string]DestinationResolver{
+	SchemeFile:   DestinationResolverFunc(openFileDestination),
+	SchemeStdout: DestinationResolverFunc(openStdoutDestination),
+}
+
+// parseDestination splits a destination into its scheme and target. "-" and
+// "stdout:" write to standard output, "scheme://target" selects a registered
+// resolver and anything else is a file path.
+func parseDestination(destination string) (scheme, target string) {
+	if destination == "-" || destination == SchemeStdout+":" {
+		return SchemeStdout, ""
+	}
+	if scheme, target, ok := strings.Cut(destination, "://"); ok && scheme != "" {
+		return strings.ToLower(scheme), target
+	}
+	return SchemeFile, destination
+}
+
+// localFile returns the file path for destinations written to the local file
+// system, which is where follow-up steps like the round-trip check and setting
+// the modification time can operate
+func localFile(destination string) (string, bool) {
+	scheme, target := parseDestination(destination)
+	return target, scheme == SchemeFile
+}
+
+// openDestination resolves destination with the configured resolvers,
+// falling back to the built-ins
+func (c *Converter) openDestination(destination string) (io.WriteCloser, error) {
+	scheme, target := parseDestination(destination)
+	resolver, ok := c.config.Destinations[scheme]
+	if !ok && scheme == SchemeFile {
+		return createAtomicFile(target, c.config.Overwrite)
+	}
+	if !ok {
+		resolver, ok = builtinDestinations[scheme]
+	}
+	if !ok {
+		return nil, fmt.Errorf("no destination resolver for scheme %q", scheme)
+	}
+	return resolver.Open(target)
+}
+
+// atomicFile writes to a temporary file that replaces the target on Close,
+// so a failed write never leaves a partial file behind
+type atomicFile struct {
+	*os.File
+	target    string
+	overwrite bool
+}
+
+// openFileDestination creates an atomic writer for filename that replaces
+// any existing file
+func openFileDestination(filename string) (io.WriteCloser, error) {
+	return createAtomicFile(filename, true)
+}
+
+// createAtomicFile creates an atomic writer for filename. Unless overwrite is
+// set, an existing file is refused up front and again when moving the
+// temporary file into place, in case it appeared in the meantime.
+func createAtomicFile(filename string, overwrite bool) (io.WriteCloser, error) {
+	if !overwrite {
+		if _, err := os.Lstat(filename); err == nil {
+			return nil, fmt.Errorf("%w: %s", ErrOutputExists, filename)
+		}
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("error creating temporary file: %w", err)
+	}
+	return &atomicFile{File: file, target: filename, overwrite: overwrite}, nil
+}
+
+// Close closes the temporary file and moves it into place
+func (f *atomicFile) Close() error {
+	if err := f.File.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("error closing output file: %w", err)
+	}
+	if !f.overwrite {
+		return f.link()
+	}
+	if err := os.Rename(f.Name(), f.target); err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("error moving output file into place: %w", err)
+	}
+	return nil
+}
+
+// link moves the temporary file into place without replacing an existing
+// file. A hard link fails if the target exists, unlike a rename; file systems
+// without hard links fall back to the rename after the check on open.
+func (f *atomicFile) link() error {
+	err := os.Link(f.Name(), f.target)
+	if errors.Is(err, fs.ErrExist) {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("%w: %s", ErrOutputExists, f.target)
+	}
+	if err != nil {
+		if err := os.Rename(f.Name(), f.target); err != nil {
+			_ = os.Remove(f.Name())
+			return fmt.Errorf("error moving output file into place: %w", err)
+		}
+		return nil
+	}
+	return os.Remove(f.Name())
+}
+
+// Abort closes and removes the temporary file
+func (f *atomicFile) Abort() error {
+	_ = f.File.Close()
+	return os.Remove(f.Name())
+}
+
+// nopCloser wraps a writer that must stay open, such as standard output
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// openStdoutDestination writes to standard output
+func openStdoutDestination(string) (io.WriteCloser, error) {
+	return nopCloser{os.Stdout}, nil
+}
+
+// writeTo opens destination and writes the output of encode to it, aborting
+// the write when encoding fails
+func (c *Converter) writeTo(destination string, encode func(w io.Writer) error) error {
+	w, err := c.openDestination(destination)
+	if err != nil {
+		return err
+	}
+
+	if err := encode(w); err != nil {
+		if a, ok := w.(aborter); ok {
+			_ = a.Abort()
+		} else {
+			_ = w.Close()
+		}
+		return err
+	}
+
+	return w.Close()
+}
+
+// contextWriter fails writes once ctx is canceled. Encoders write through a
+// buffer, so long outputs are checked every few kilobytes and a canceled
+// conversion stops promptly instead of finishing the whole file.
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (cw contextWriter) Write(p []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cw.w.Write(p)
+}
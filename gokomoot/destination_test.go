@@ -0,0 +1,198 @@
+package gokomoot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseDestination(t *testing.T) {
+	tests := map[string][2]string{
+		"-":                          {SchemeStdout, ""},
+		"stdout:":                    {SchemeStdout, ""},
+		"route.gpx":                  {SchemeFile, "route.gpx"},
+		"/tmp/route.gpx":             {SchemeFile, "/tmp/route.gpx"},
+		`C:\tours\route.gpx`:         {SchemeFile, `C:\tours\route.gpx`},
+		"file:///tmp/route.gpx":      {SchemeFile, "/tmp/route.gpx"},
+		"S3://bucket/tours/1.gpx":    {"s3", "bucket/tours/1.gpx"},
+		"https://example.com/upload": {"https", "example.com/upload"},
+	}
+	for input, want := range tests {
+		scheme, target := parseDestination(input)
+		if scheme != want[0] || target != want[1] {
+			t.Fatalf("parseDestination(%q) = %q, %q, want %q, %q", input, scheme, target, want[0], want[1])
+		}
+	}
+}
+
+type bufferCloser struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *bufferCloser) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestConvertFromHTMLUsesCustomDestination(t *testing.T) {
+	var target string
+	buffer := &bufferCloser{}
+	config := DefaultConfig()
+	config.Destinations = map[string]DestinationResolver{
+		"mem": DestinationResolverFunc(func(t string) (io.WriteCloser, error) {
+			target = t
+			return buffer, nil
+		}),
+	}
+
+	if err := NewConverter(config).ConvertFromHTML(context.Background(), capturedKomootHTML(t), "mem://tours/route.gpx"); err != nil {
+		t.Fatalf("ConvertFromHTML() error = %v", err)
+	}
+	if target != "tours/route.gpx" {
+		t.Fatalf("resolver target = %q, want %q", target, "tours/route.gpx")
+	}
+	if !buffer.closed || !strings.Contains(buffer.String(), "<gpx") {
+		t.Fatalf("destination closed = %t, content = %q, want closed GPX document", buffer.closed, buffer.String())
+	}
+}
+
+func TestOpenDestinationRejectsUnknownScheme(t *testing.T) {
+	_, err := NewConverter(DefaultConfig()).openDestination("s3://bucket/route.gpx")
+	if err == nil || !strings.Contains(err.Error(), `"s3"`) {
+		t.Fatalf("openDestination() error = %v, want unknown scheme error", err)
+	}
+}
+
+func TestWriteToAbortsFileOnEncodeError(t *testing.T) {
+	dir := t.TempDir()
+	outputPath := filepath.Join(dir, "route.gpx")
+	encodeErr := errors.New("encode failed")
+
+	err := NewConverter(DefaultConfig()).writeTo(outputPath, func(w io.Writer) error {
+		_, _ = io.WriteString(w, "partial")
+		return encodeErr
+	})
+	if !errors.Is(err, encodeErr) {
+		t.Fatalf("writeTo() error = %v, want %v", err, encodeErr)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("output directory has %d entries, want none", len(entries))
+	}
+}
+
+func TestWriteToRefusesExistingFile(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "route.gpx")
+	if err := os.WriteFile(outputPath, []byte("keep"), 0o644); err != nil {
+		t.Fatalf("os.WriteFile() error = %v", err)
+	}
+
+	err := NewConverter(DefaultConfig()).writeTo(outputPath, func(w io.Writer) error {
+		_, err := io.WriteString(w, "new")
+		return err
+	})
+	if !errors.Is(err, ErrOutputExists) {
+		t.Fatalf("writeTo() error = %v, want ErrOutputExists", err)
+	}
+	if content, _ := os.ReadFile(outputPath); string(content) != "keep" {
+		t.Fatalf("output file = %q, want it untouched", content)
+	}
+
+	config := DefaultConfig()
+	config.Overwrite = true
+	err = NewConverter(config).writeTo(outputPath, func(w io.Writer) error {
+		_, err := io.WriteString(w, "new")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("writeTo() with Overwrite error = %v", err)
+	}
+	if content, _ := os.ReadFile(outputPath); string(content) != "new" {
+		t.Fatalf("output file = %q, want it replaced", content)
+	}
+}
+
+func TestWriteToRefusesFileCreatedWhileWriting(t *testing.T) {
+	dir := t.TempDir()
+	outputPath := filepath.Join(dir, "route.gpx")
+
+	err := NewConverter(DefaultConfig()).writeTo(outputPath, func(w io.Writer) error {
+		if err := os.WriteFile(outputPath, []byte("other"), 0o644); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, "new")
+		return err
+	})
+	if !errors.Is(err, ErrOutputExists) {
+		t.Fatalf("writeTo() error = %v, want ErrOutputExists", err)
+	}
+	if content, _ := os.ReadFile(outputPath); string(content) != "other" {
+		t.Fatalf("output file = %q, want the other writer's content", content)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("output directory has %d entries, want the temporary file removed", len(entries))
+	}
+}
+
+// cancelingWriter cancels the conversion on its first write and counts the
+// writes that reach it
+type cancelingWriter struct {
+	cancel context.CancelFunc
+	writes int
+}
+
+func (w *cancelingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	w.cancel()
+	return len(p), nil
+}
+
+func (w *cancelingWriter) Close() error { return nil }
+
+func TestWriteOutputStopsWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	writer := &cancelingWriter{cancel: cancel}
+	config := DefaultConfig()
+	config.Destinations = map[string]DestinationResolver{
+		"mem": DestinationResolverFunc(func(string) (io.WriteCloser, error) { return writer, nil }),
+	}
+
+	points := make([]Point, 100000)
+	for i := range points {
+		points[i] = Point{Lat: 52.5, Lon: 13.4 + float64(i)*1e-6, Elevation: 40}
+	}
+	gpx := &GPX{Version: "1.1", Tracks: []Track{{Segments: []Segment{{Points: points}}}}}
+
+	err := NewConverter(config).writeOutput(ctx, gpx, "mem://route.gpx")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("writeOutput() error = %v, want context.Canceled", err)
+	}
+	if writer.writes != 1 {
+		t.Fatalf("destination saw %d writes, want encoding to stop after the first", writer.writes)
+	}
+}
+
+func TestWriteOutputChecksContextFirst(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	outputPath := filepath.Join(t.TempDir(), "route.gpx")
+
+	err := NewConverter(DefaultConfig()).writeOutput(ctx, &GPX{Version: "1.1"}, outputPath)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("writeOutput() error = %v, want context.Canceled", err)
+	}
+	if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+		t.Fatalf("os.Stat() error = %v, want no output file", err)
+	}
+}
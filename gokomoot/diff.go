@@ -0,0 +1,106 @@
+package gokomoot
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// DiffResult summarizes the differences between two tours
+type DiffResult struct {
+	DistanceA float64 // meters
+	DistanceB float64 // meters
+	PointsA   int
+	PointsB   int
+	// MaxDeviation is the largest distance in meters from any point of one
+	// track to the nearest point of the other
+	MaxDeviation float64
+}
+
+// DistanceDelta returns how much longer tour B is than tour A in meters
+func (d DiffResult) DistanceDelta() float64 {
+	return d.DistanceB - d.DistanceA
+}
+
+// PointCountDelta returns how many more points tour B has than tour A
+func (d DiffResult) PointCountDelta() int {
+	return d.PointsB - d.PointsA
+}
+
+// String returns a concise human-readable summary of the differences
+func (d DiffResult) String() string {
+	return fmt.Sprintf("Distance: %.2f km vs %.2f km (%+.2f km)\nPoints: %d vs %d (%+d)\nMax deviation: %.1f m\n",
+		d.DistanceA/1000, d.DistanceB/1000, d.DistanceDelta()/1000,
+		d.PointsA, d.PointsB, d.PointCountDelta(),
+		d.MaxDeviation)
+}
+
+// DiffGPX compares two tours. The maximum deviation is taken in both
+// directions so a detour present in only one of the tracks is always caught,
+// however different the point counts are.
+func DiffGPX(a, b *GPX) DiffResult {
+	pointsA, pointsB := a.allPoints(), b.allPoints()
+	result := DiffResult{
+		DistanceA: a.TotalDistance(DistanceOptions{}),
+		DistanceB: b.TotalDistance(DistanceOptions{}),
+		PointsA:   len(pointsA),
+		PointsB:   len(pointsB),
+	}
+	if len(pointsA) == 0 || len(pointsB) == 0 {
+		return result
+	}
+
+	result.MaxDeviation = math.Max(maxNearestDistance(pointsA, pointsB), maxNearestDistance(pointsB, pointsA))
+	return result
+}
+
+// allPoints returns copies of all track points in order
+func (g *GPX) allPoints() []Point {
+	var points []Point
+	g.eachPoint(func(p *Point) {
+		points = append(points, *p)
+	})
+	return points
+}
+
+// maxNearestDistance returns the largest distance from a point in from to its
+// nearest point in to
+func maxNearestDistance(from, to []Point) float64 {
+	sorted := append([]Point(nil), to...)
+	sortPointsByLat(sorted)
+
+	maxDistance := 0.0
+	for _, point := range from {
+		maxDistance = math.Max(maxDistance, nearestDistance(point, sorted))
+	}
+	return maxDistance
+}
+
+// sortPointsByLat sorts points by ascending latitude
+func sortPointsByLat(points []Point) {
+	sort.Slice(points, func(i, j int) bool { return points[i].Lat < points[j].Lat })
+}
+
+// nearestDistance returns the distance from point to the nearest point in
+// sorted, which must be ordered by latitude. The search walks outwards from
+// the point's latitude and stops once the latitude difference alone exceeds
+// the best distance found.
+func nearestDistance(point Point, sorted []Point) float64 {
+	const metersPerDegree = EarthRadius * math.Pi / 180
+
+	start := sort.Search(len(sorted), func(i int) bool { return sorted[i].Lat >= point.Lat })
+	best := math.Inf(1)
+	for i := start; i < len(sorted); i++ {
+		if (sorted[i].Lat-point.Lat)*metersPerDegree > best {
+			break
+		}
+		best = math.Min(best, haversineDistance(point, sorted[i]))
+	}
+	for i := start - 1; i >= 0; i-- {
+		if (point.Lat-sorted[i].Lat)*metersPerDegree > best {
+			break
+		}
+		best = math.Min(best, haversineDistance(point, sorted[i]))
+	}
+	return best
+}
@@ -0,0 +1,66 @@
+package gokomoot
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestDiffGPX(t *testing.T) {
+	planned := &GPX{Tracks: []Track{{Segments: []Segment{{Points: []Point{
+		{Lat: 52.5, Lon: 13.4},
+		{Lat: 52.51, Lon: 13.4},
+		{Lat: 52.52, Lon: 13.4},
+	}}}}}}
+	recorded := &GPX{Tracks: []Track{{Segments: []Segment{{Points: []Point{
+		{Lat: 52.5, Lon: 13.4},
+		{Lat: 52.505, Lon: 13.4},
+		{Lat: 52.51, Lon: 13.401},
+		{Lat: 52.515, Lon: 13.4},
+		{Lat: 52.52, Lon: 13.4},
+	}}}}}}
+
+	result := DiffGPX(planned, recorded)
+
+	if result.PointsA != 3 || result.PointsB != 5 || result.PointCountDelta() != 2 {
+		t.Fatalf("point counts = %d, %d, want 3, 5", result.PointsA, result.PointsB)
+	}
+	if result.DistanceDelta() <= 0 {
+		t.Fatalf("DistanceDelta() = %f, want recorded detour to be longer", result.DistanceDelta())
+	}
+	// The 0.005° midpoints are about 556 m from the nearest planned point.
+	if math.Abs(result.MaxDeviation-556) > 2 {
+		t.Fatalf("MaxDeviation = %f, want about 556", result.MaxDeviation)
+	}
+	if summary := result.String(); !strings.Contains(summary, "Points: 3 vs 5 (+2)") {
+		t.Fatalf("String() = %q, want point summary", summary)
+	}
+}
+
+func TestDiffGPXHandlesEmptyTrack(t *testing.T) {
+	tour := &GPX{Tracks: []Track{{Segments: []Segment{{Points: []Point{{Lat: 52.5, Lon: 13.4}}}}}}}
+
+	result := DiffGPX(tour, &GPX{})
+
+	if result.PointsA != 1 || result.PointsB != 0 || result.MaxDeviation != 0 {
+		t.Fatalf("DiffGPX() = %#v, want counts only", result)
+	}
+}
+
+func TestNearestDistanceMatchesBruteForce(t *testing.T) {
+	var points []Point
+	for i := 0; i < 200; i++ {
+		points = append(points, Point{Lat: 52 + math.Sin(float64(i))*0.05, Lon: 13 + math.Cos(float64(i)*0.7)*0.05})
+	}
+	sorted := append([]Point(nil), points...)
+	sortPointsByLat(sorted)
+
+	query := Point{Lat: 52.01, Lon: 13.02}
+	want := math.Inf(1)
+	for _, point := range points {
+		want = math.Min(want, haversineDistance(query, point))
+	}
+	if got := nearestDistance(query, sorted); got != want {
+		t.Fatalf("nearestDistance() = %f, want %f", got, want)
+	}
+}
@@ -0,0 +1,121 @@
+package gokomoot
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// DistanceOptions calibrates how track distance is computed. Each leg between
+// consecutive points is the haversine great-circle distance on a sphere of
+// EarthRadius meters; with Elevation set, the elevation change is added as
+// the other side of a right triangle, sqrt(d² + Δele²).
+type DistanceOptions struct {
+	// EarthRadius is the sphere radius in meters, the mean radius of
+	// 6371000 m when zero
+	EarthRadius float64
+	// Elevation includes elevation changes in the distance (3D instead of 2D)
+	Elevation bool
+}
+
+// greatCircleDistance returns the haversine distance between two points in
+// meters on a sphere with the given radius
+func greatCircleDistance(a, b Point, radius float64) float64 {
+	lat1 := a.Lat * math.Pi / 180
+	lat2 := b.Lat * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * radius * math.Asin(math.Sqrt(h))
+}
+
+// TotalDistance returns the length of all track segments in meters. Gaps
+// between segments are not counted.
+func (g *GPX) TotalDistance(opts DistanceOptions) float64 {
+	radius := opts.EarthRadius
+	if radius <= 0 {
+		radius = EarthRadius
+	}
+
+	total := 0.0
+	for _, track := range g.Tracks {
+		for _, segment := range track.Segments {
+			for i := 1; i < len(segment.Points); i++ {
+				a, b := segment.Points[i-1], segment.Points[i]
+				leg := greatCircleDistance(a, b, radius)
+				if opts.Elevation && !a.NoElevation && !b.NoElevation {
+					leg = math.Hypot(leg, b.Elevation-a.Elevation)
+				}
+				total += leg
+			}
+		}
+	}
+	return total
+}
+
+// TotalDistance3D returns the length of all track segments in meters
+// including elevation changes, TotalDistance with DistanceOptions.Elevation
+func (g *GPX) TotalDistance3D() float64 {
+	return g.TotalDistance(DistanceOptions{Elevation: true})
+}
+
+// recordDistance stores the track distance in the metadata extensions and
+// logs how it compares to the distance Komoot reports. With
+// MatchKomootDistance the computed distance is scaled to Komoot's figure.
+func (c *Converter) recordDistance(gpx *GPX, reported float64) {
+	if !c.config.EmitDistance && !c.config.MatchKomootDistance {
+		return
+	}
+
+	distance := gpx.TotalDistance(c.config.Distance)
+	if reported > 0 && distance > 0 {
+		scale := reported / distance
+		c.logger.Printf("Computed distance %.0f m, Komoot reports %.0f m (scale factor %.4f)\n", distance, reported, scale)
+		if c.config.MatchKomootDistance {
+			distance *= scale
+		}
+	} else if c.config.MatchKomootDistance {
+		c.logger.Println("Komoot did not report a distance, keeping the computed one")
+	}
+
+	if gpx.Metadata == nil {
+		gpx.Metadata = &Metadata{}
+	}
+	if gpx.Metadata.Extensions == nil {
+		gpx.Metadata.Extensions = &MetadataExtensions{}
+	}
+	gpx.Metadata.Extensions.Distance = strconv.FormatFloat(distance, 'f', 1, 64)
+}
+
+// reportedDistanceTolerance is how far, as a fraction of Komoot's reported
+// distance, the distance of the decoded track may be off before it counts as
+// incomplete
+const reportedDistanceTolerance = 0.1
+
+// ErrDistanceMismatch is wrapped by the error for a track whose distance is
+// far from the distance Komoot reports, which usually means the coordinates
+// were cut short while extracting them
+var ErrDistanceMismatch = errors.New("track distance doesn't match Komoot's")
+
+// checkReportedDistance compares the distance of the decoded track to the
+// reported distance in meters. A difference beyond reportedDistanceTolerance
+// is logged as a warning, or returned as an error with Strict.
+func (c *Converter) checkReportedDistance(gpx *GPX, reported float64) error {
+	if reported <= 0 {
+		c.logger.Verbosef("Komoot did not report a distance to check the track against\n")
+		return nil
+	}
+
+	distance := gpx.TotalDistance(DistanceOptions{})
+	if math.Abs(distance-reported) <= reported*reportedDistanceTolerance {
+		return nil
+	}
+	err := fmt.Errorf("%w: %.0f m from %d points, Komoot reports %.0f m", ErrDistanceMismatch, distance, gpx.pointCount(), reported)
+	if c.config.Strict {
+		return err
+	}
+	c.logger.Printf("Warning: %v; the track may be incomplete\n", err)
+	return nil
+}
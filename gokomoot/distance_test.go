@@ -0,0 +1,131 @@
+package gokomoot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestTotalDistanceOptions(t *testing.T) {
+	gpx := &GPX{Tracks: []Track{{Segments: []Segment{
+		{Points: []Point{{Lat: 0, Lon: 0, Elevation: 0}, {Lat: 0.001, Lon: 0, Elevation: 100}}},
+		{Points: []Point{{Lat: 1, Lon: 1}}},
+	}}}}
+
+	flat := gpx.TotalDistance(DistanceOptions{})
+	if math.Abs(flat-111.195) > 0.01 {
+		t.Fatalf("TotalDistance(2D) = %f, want about 111.195", flat)
+	}
+
+	if got, want := gpx.TotalDistance(DistanceOptions{Elevation: true}), math.Hypot(flat, 100); math.Abs(got-want) > 1e-9 {
+		t.Fatalf("TotalDistance(3D) = %f, want %f", got, want)
+	}
+
+	if got, want := gpx.TotalDistance(DistanceOptions{EarthRadius: 2 * EarthRadius}), 2*flat; math.Abs(got-want) > 1e-9 {
+		t.Fatalf("TotalDistance(radius) = %f, want %f", got, want)
+	}
+}
+
+func TestTotalDistance3D(t *testing.T) {
+	gpx := &GPX{Tracks: []Track{{Segments: []Segment{
+		{Points: []Point{{Lat: 0, Lon: 0, Elevation: 0}, {Lat: 0.001, Lon: 0, Elevation: 100}}},
+	}}}}
+
+	if got, want := gpx.TotalDistance3D(), gpx.TotalDistance(DistanceOptions{Elevation: true}); got != want {
+		t.Fatalf("TotalDistance3D() = %f, want %f", got, want)
+	}
+	if got := gpx.TotalDistance3D(); got <= gpx.TotalDistance(DistanceOptions{}) {
+		t.Fatalf("TotalDistance3D() = %f, want more than the 2D distance", got)
+	}
+}
+
+func TestBuildGPXLogsDistanceWhenVerbose(t *testing.T) {
+	var buf bytes.Buffer
+	config := DefaultConfig()
+	config.Verbosity = VerbosityVerbose
+	config.Logger = log.New(&buf, "", 0)
+	var komootResp KomootResponse
+	payload := `{"page":{"_embedded":{"tour":{"_embedded":{"coordinates":{"items":[{"lat":0,"lng":0,"alt":0},{"lat":0.001,"lng":0,"alt":100}]}}}}}}`
+	if err := json.Unmarshal([]byte(payload), &komootResp); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	if _, err := NewConverter(config).buildGPX(context.Background(), &komootResp); err != nil {
+		t.Fatalf("buildGPX() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), "Track distance: 0.11 km, 0.15 km with elevation") {
+		t.Fatalf("log = %q, want track distance", buf.String())
+	}
+}
+
+func TestRecordDistance(t *testing.T) {
+	gpx := &GPX{Tracks: []Track{{Segments: []Segment{
+		{Points: []Point{{Lat: 0, Lon: 0}, {Lat: 0.001, Lon: 0}}},
+	}}}}
+
+	config := DefaultConfig()
+	config.EmitDistance = true
+	converter := NewConverter(config)
+	converter.recordDistance(gpx, 120)
+	if got := gpx.Metadata.Extensions.Distance; got != "111.2" {
+		t.Fatalf("distance extension = %q, want %q", got, "111.2")
+	}
+
+	config.MatchKomootDistance = true
+	converter = NewConverter(config)
+	converter.recordDistance(gpx, 120)
+	if got := gpx.Metadata.Extensions.Distance; got != "120.0" {
+		t.Fatalf("matched distance extension = %q, want %q", got, "120.0")
+	}
+}
+
+func TestRecordDistanceDisabled(t *testing.T) {
+	gpx := &GPX{Tracks: []Track{{Segments: []Segment{
+		{Points: []Point{{Lat: 0, Lon: 0}, {Lat: 0.001, Lon: 0}}},
+	}}}}
+
+	NewConverter(DefaultConfig()).recordDistance(gpx, 120)
+	if gpx.Metadata != nil {
+		t.Fatalf("metadata = %#v, want nil without distance options", gpx.Metadata)
+	}
+}
+
+func TestBuildGPXChecksReportedDistance(t *testing.T) {
+	// The two points are about 111 m apart.
+	tests := []struct {
+		reported float64
+		strict   bool
+		wantErr  bool
+		wantLog  string
+	}{
+		{115, true, false, ""},
+		{0, true, false, ""},
+		{2000, false, false, "Warning: track distance doesn't match Komoot's: 111 m from 2 points, Komoot reports 2000 m"},
+		{2000, true, true, ""},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		config := DefaultConfig()
+		config.Strict = tt.strict
+		config.Logger = log.New(&buf, "", 0)
+		var komootResp KomootResponse
+		payload := `{"page":{"_embedded":{"tour":{"distance":` + strconv.FormatFloat(tt.reported, 'f', -1, 64) + `,"_embedded":{"coordinates":{"items":[{"lat":0,"lng":0,"alt":0},{"lat":0.001,"lng":0,"alt":100}]}}}}}}`
+		if err := json.Unmarshal([]byte(payload), &komootResp); err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+
+		_, err := NewConverter(config).buildGPX(context.Background(), &komootResp)
+		if tt.wantErr != errors.Is(err, ErrDistanceMismatch) || (!tt.wantErr && err != nil) {
+			t.Fatalf("buildGPX() with %.0f m reported, strict %t error = %v, want mismatch error %t", tt.reported, tt.strict, err, tt.wantErr)
+		}
+		if !strings.Contains(buf.String(), tt.wantLog) || (tt.wantLog == "" && strings.Contains(buf.String(), "Warning")) {
+			t.Fatalf("log = %q, want %q", buf.String(), tt.wantLog)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package gokomoot
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// dnsCache is a dialer that memoizes resolved host addresses for a TTL so
+// batch runs against the same host skip repeated lookups
+type dnsCache struct {
+	ttl    time.Duration
+	dialer *net.Dialer
+	lookup func(ctx context.Context, host string) ([]string, error)
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]dnsCacheEntry
+}
+
+type dnsCacheEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// newDNSCache creates a DNS cache backed by the default resolver
+func newDNSCache(ttl time.Duration) *dnsCache {
+	return &dnsCache{
+		ttl:     ttl,
+		dialer:  &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		lookup:  net.DefaultResolver.LookupHost,
+		now:     time.Now,
+		entries: make(map[string]dnsCacheEntry),
+	}
+}
+
+// resolve returns the cached addresses for host, looking them up on a miss
+// or after the entry expired
+func (d *dnsCache) resolve(ctx context.Context, host string) ([]string, error) {
+	d.mu.Lock()
+	entry, ok := d.entries[host]
+	d.mu.Unlock()
+	if ok && d.now().Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := d.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	d.entries[host] = dnsCacheEntry{addrs: addrs, expires: d.now().Add(d.ttl)}
+	d.mu.Unlock()
+	return addrs, nil
+}
+
+// DialContext dials address using cached host addresses, falling back to
+// normal resolution when the cached lookup fails
+func (d *dnsCache) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) != nil {
+		return d.dialer.DialContext(ctx, network, address)
+	}
+
+	addrs, err := d.resolve(ctx, host)
+	if err != nil {
+		return d.dialer.DialContext(ctx, network, address)
+	}
+
+	var lastErr error
+	for _, addr := range addrs {
+		conn, err := d.dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,65 @@
+package gokomoot
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDNSCacheReusesLookupUntilExpiry(t *testing.T) {
+	lookups := 0
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := newDNSCache(time.Minute)
+	cache.now = func() time.Time { return now }
+	cache.lookup = func(ctx context.Context, host string) ([]string, error) {
+		lookups++
+		return []string{"192.0.2.1"}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		addrs, err := cache.resolve(context.Background(), "www.komoot.com")
+		if err != nil {
+			t.Fatalf("resolve() error = %v", err)
+		}
+		if len(addrs) != 1 || addrs[0] != "192.0.2.1" {
+			t.Fatalf("resolve() = %v, want [192.0.2.1]", addrs)
+		}
+	}
+	if lookups != 1 {
+		t.Fatalf("lookups = %d, want 1 while cached", lookups)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := cache.resolve(context.Background(), "www.komoot.com"); err != nil {
+		t.Fatalf("resolve() error = %v", err)
+	}
+	if lookups != 2 {
+		t.Fatalf("lookups = %d, want 2 after expiry", lookups)
+	}
+}
+
+func BenchmarkDNSCacheResolve(b *testing.B) {
+	// Simulate a resolver round trip; real lookups are usually slower.
+	slowLookup := func(ctx context.Context, host string) ([]string, error) {
+		time.Sleep(100 * time.Microsecond)
+		return []string{"192.0.2.1"}, nil
+	}
+
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := slowLookup(context.Background(), "www.komoot.com"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		cache := newDNSCache(time.Hour)
+		cache.lookup = slowLookup
+		for i := 0; i < b.N; i++ {
+			if _, err := cache.resolve(context.Background(), "www.komoot.com"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,156 @@
+package gokomoot
+
+import (
+	"fmt"
+	"sort"
+)
+
+// elevationBand returns the index of the band containing elevation. A point
+// exactly on a boundary belongs to the band above it.
+func elevationBand(bands []float64, elevation float64) int {
+	return sort.Search(len(bands), func(i int) bool { return bands[i] > elevation })
+}
+
+// ClassifyByElevation groups all track points by elevation band. The
+// ascending boundaries in bands split elevations into len(bands)+1 bands; a
+// point exactly on a boundary is placed in the higher band. Points without
+// elevation belong to no band and are left out.
+func (g *GPX) ClassifyByElevation(bands []float64) [][]Point {
+	classified := make([][]Point, len(bands)+1)
+	g.eachPoint(func(p *Point) {
+		if p.NoElevation {
+			return
+		}
+		band := elevationBand(bands, p.Elevation)
+		classified[band] = append(classified[band], *p)
+	})
+	return classified
+}
+
+// splitByElevationBands replaces the first track with one track per
+// elevation band. Each contiguous run of points within a band becomes its own
+// segment so separate portions aren't joined by a straight line. Points
+// without elevation are left out, as in ClassifyByElevation, without ending
+// the run they are in.
+func (g *GPX) splitByElevationBands(bands []float64) {
+	if len(g.Tracks) == 0 {
+		return
+	}
+
+	bandTracks := make([]Track, len(bands)+1)
+	for i := range bandTracks {
+		bandTracks[i].Name = elevationBandName(bands, i)
+		bandTracks[i].Type = g.Tracks[0].Type
+	}
+
+	for _, segment := range g.Tracks[0].Segments {
+		previous := -1
+		for _, point := range segment.Points {
+			if point.NoElevation {
+				continue
+			}
+			band := elevationBand(bands, point.Elevation)
+			track := &bandTracks[band]
+			if band != previous {
+				track.Segments = append(track.Segments, Segment{})
+				previous = band
+			}
+			last := &track.Segments[len(track.Segments)-1]
+			last.Points = append(last.Points, point)
+		}
+	}
+
+	tracks := make([]Track, 0, len(bandTracks)+len(g.Tracks)-1)
+	for _, track := range bandTracks {
+		if len(track.Segments) > 0 {
+			tracks = append(tracks, track)
+		}
+	}
+	g.Tracks = append(tracks, g.Tracks[1:]...)
+}
+
+// elevationBandName describes band i of the given boundaries
+func elevationBandName(bands []float64, i int) string {
+	switch {
+	case len(bands) == 0:
+		return "all elevations"
+	case i == 0:
+		return fmt.Sprintf("below %g m", bands[0])
+	case i == len(bands):
+		return fmt.Sprintf("%g m and above", bands[i-1])
+	default:
+		return fmt.Sprintf("%g-%g m", bands[i-1], bands[i])
+	}
+}
+
+// InterpolateElevation fills in the elevation of points marked NoElevation,
+// interpolating linearly by distance between the nearest points with
+// elevation before and after them in the same track and holding the first or
+// last known elevation flat at the ends. Points at 0 m count as known. Tracks
+// without any elevation are left as they are. It returns the number of points
+// filled in.
+func (g *GPX) InterpolateElevation() int {
+	filled := 0
+	for ti := range g.Tracks {
+		var points []*Point
+		for si := range g.Tracks[ti].Segments {
+			for pi := range g.Tracks[ti].Segments[si].Points {
+				points = append(points, &g.Tracks[ti].Segments[si].Points[pi])
+			}
+		}
+
+		// Distance along the track, to weight the interpolation
+		along := make([]float64, len(points))
+		for i := 1; i < len(points); i++ {
+			along[i] = along[i-1] + greatCircleDistance(*points[i-1], *points[i], EarthRadius)
+		}
+
+		previous := -1
+		for i, point := range points {
+			if point.NoElevation {
+				continue
+			}
+			for j := previous + 1; j < i; j++ {
+				elevation := point.Elevation
+				if previous >= 0 && along[i] > along[previous] {
+					fraction := (along[j] - along[previous]) / (along[i] - along[previous])
+					elevation = points[previous].Elevation + fraction*(point.Elevation-points[previous].Elevation)
+				} else if previous >= 0 {
+					elevation = points[previous].Elevation
+				}
+				points[j].Elevation, points[j].NoElevation = elevation, false
+				filled++
+			}
+			previous = i
+		}
+		if previous == -1 {
+			continue
+		}
+		for _, point := range points[previous+1:] {
+			point.Elevation, point.NoElevation = points[previous].Elevation, false
+			filled++
+		}
+	}
+	return filled
+}
+
+// StripElevation removes the elevation of every track point and waypoint, so
+// no output format writes one
+func (g *GPX) StripElevation() {
+	g.eachPoint(func(p *Point) {
+		p.Elevation, p.NoElevation = 0, true
+	})
+	for i := range g.Waypoints {
+		g.Waypoints[i].Elevation = 0
+	}
+}
+
+// hasElevation reports whether any of the points has an elevation
+func hasElevation(points []Point) bool {
+	for _, point := range points {
+		if !point.NoElevation {
+			return true
+		}
+	}
+	return false
+}
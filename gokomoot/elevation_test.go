@@ -0,0 +1,159 @@
+package gokomoot
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func elevationTestGPX(elevations ...float64) *GPX {
+	points := make([]Point, len(elevations))
+	for i, elevation := range elevations {
+		points[i] = Point{Lat: 46.5, Lon: 8 + float64(i)*0.001, Elevation: elevation}
+	}
+	return &GPX{Tracks: []Track{{Name: "Alps", Segments: []Segment{{Points: points}}}}}
+}
+
+func TestClassifyByElevationBoundaryGoesUp(t *testing.T) {
+	gpx := elevationTestGPX(500, 1000, 1500, 2000, 2500)
+
+	classified := gpx.ClassifyByElevation([]float64{1000, 2000})
+
+	wantCounts := []int{1, 2, 2}
+	for band, want := range wantCounts {
+		if len(classified[band]) != want {
+			t.Fatalf("band %d point count = %d, want %d", band, len(classified[band]), want)
+		}
+	}
+	if classified[1][0].Elevation != 1000 || classified[2][0].Elevation != 2000 {
+		t.Fatalf("boundary points = %v, %v, want them in the higher band", classified[1][0], classified[2][0])
+	}
+}
+
+func TestSplitByElevationBandsKeepsRunsSeparate(t *testing.T) {
+	gpx := elevationTestGPX(900, 1100, 1200, 800, 1300)
+	gpx.Tracks[0].Type = "hike"
+
+	gpx.splitByElevationBands([]float64{1000})
+
+	if len(gpx.Tracks) != 2 {
+		t.Fatalf("track count = %d, want 2", len(gpx.Tracks))
+	}
+	low, high := gpx.Tracks[0], gpx.Tracks[1]
+	if low.Name != "below 1000 m" || high.Name != "1000 m and above" {
+		t.Fatalf("track names = %q, %q", low.Name, high.Name)
+	}
+	if low.Type != "hike" || high.Type != "hike" {
+		t.Fatalf("track types = %q, %q, want hike", low.Type, high.Type)
+	}
+	if len(low.Segments) != 2 || len(high.Segments) != 2 {
+		t.Fatalf("segment counts = %d, %d, want 2 runs per band", len(low.Segments), len(high.Segments))
+	}
+	if len(high.Segments[0].Points) != 2 {
+		t.Fatalf("first high run point count = %d, want 2", len(high.Segments[0].Points))
+	}
+}
+
+func TestSplitByElevationBandsOmitsEmptyBands(t *testing.T) {
+	gpx := elevationTestGPX(100, 200)
+
+	gpx.splitByElevationBands([]float64{1000, 2000})
+
+	if len(gpx.Tracks) != 1 || gpx.Tracks[0].Name != "below 1000 m" {
+		t.Fatalf("tracks = %#v, want only the lowest band", gpx.Tracks)
+	}
+}
+
+func TestElevationBandsSkipPointsWithoutElevation(t *testing.T) {
+	gpx := elevationTestGPX(1500, 0, 1600)
+	gpx.Tracks[0].Segments[0].Points[1].NoElevation = true
+
+	classified := gpx.ClassifyByElevation([]float64{100})
+	if len(classified[0]) != 0 || len(classified[1]) != 2 {
+		t.Fatalf("band point counts = %d, %d, want 0, 2", len(classified[0]), len(classified[1]))
+	}
+
+	gpx.splitByElevationBands([]float64{100})
+	if len(gpx.Tracks) != 1 || gpx.Tracks[0].Name != "100 m and above" || len(gpx.Tracks[0].Segments) != 1 || len(gpx.Tracks[0].Segments[0].Points) != 2 {
+		t.Fatalf("tracks = %#v, want one run of the two points with elevation", gpx.Tracks)
+	}
+}
+
+func TestInterpolateElevation(t *testing.T) {
+	gpx := elevationTestGPX(0, 100, 0, 0, 400, 0, 0, 0)
+	for _, i := range []int{0, 2, 3, 5, 6} {
+		gpx.Tracks[0].Segments[0].Points[i].NoElevation = true
+	}
+	gpx.Tracks[0].Segments = append(gpx.Tracks[0].Segments, Segment{Points: []Point{{Lat: 46.5, Lon: 8.007, NoElevation: true}}})
+	gpx.Tracks = append(gpx.Tracks, Track{Segments: []Segment{{Points: []Point{{Lat: 46, Lon: 8, NoElevation: true}}}}})
+
+	if filled := gpx.InterpolateElevation(); filled != 6 {
+		t.Fatalf("InterpolateElevation() = %d, want 6", filled)
+	}
+
+	// The last point of the first segment is a known 0 m, which the missing
+	// points before it slope down to and the next segment holds flat.
+	want := []float64{100, 100, 200, 300, 400, 400 * 2 / 3.0, 400 / 3.0, 0, 0}
+	var got []Point
+	for _, segment := range gpx.Tracks[0].Segments {
+		got = append(got, segment.Points...)
+	}
+	for i, point := range got {
+		if point.NoElevation || math.Abs(point.Elevation-want[i]) > 1e-6 {
+			t.Fatalf("point %d elevation = %v (missing %t), want %v", i, point.Elevation, point.NoElevation, want[i])
+		}
+	}
+	if !gpx.Tracks[1].Segments[0].Points[0].NoElevation {
+		t.Fatal("InterpolateElevation() filled in a track without any elevation")
+	}
+}
+
+func TestStripElevation(t *testing.T) {
+	payload := `{"page":{"_embedded":{"tour":{"_embedded":{
+		"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35},{"lat":51.501,"lng":-0.12,"alt":36}]},
+		"highlights":{"items":[{"name":"Hilltop","mid_point":{"lat":51.51,"lng":-0.121,"alt":80}}]}}}}}}`
+	var response KomootResponse
+	if err := json.Unmarshal([]byte(payload), &response); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	config := DefaultConfig()
+	config.Verbosity = VerbosityQuiet
+	config.StripElevation = true
+	converter := NewConverter(config)
+	gpx, err := converter.jsonToGPX(&response)
+	if err != nil {
+		t.Fatalf("jsonToGPX() error = %v", err)
+	}
+	if gpx, err = converter.processGPX(gpx, 0); err != nil {
+		t.Fatalf("processGPX() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := encodeGPX(gpx, &buf); err != nil {
+		t.Fatalf("encodeGPX() error = %v", err)
+	}
+	if strings.Contains(buf.String(), "<ele>") {
+		t.Fatalf("GPX output has elevations:\n%s", buf.String())
+	}
+	if problems, err := ValidateGPX(&buf); err != nil || len(problems) != 0 {
+		t.Fatalf("ValidateGPX() = %v, %v, want no problems", problems, err)
+	}
+
+	buf.Reset()
+	if err := writeGeoJSON(gpx, &buf, ""); err != nil {
+		t.Fatalf("writeGeoJSON() error = %v", err)
+	}
+	if want := "[[-0.12,51.5],[-0.12,51.501]]"; !strings.Contains(buf.String(), want) {
+		t.Fatalf("GeoJSON output missing %s:\n%s", want, buf.String())
+	}
+
+	buf.Reset()
+	if err := writeKML(gpx, &buf, ""); err != nil {
+		t.Fatalf("writeKML() error = %v", err)
+	}
+	if want := "<coordinates>-0.12,51.5 -0.12,51.501</coordinates>"; !strings.Contains(buf.String(), want) || strings.Contains(buf.String(), "altitudeMode") {
+		t.Fatalf("KML output missing %s or has an altitude mode:\n%s", want, buf.String())
+	}
+}
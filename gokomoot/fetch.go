@@ -0,0 +1,199 @@
+package gokomoot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// fetchStrategy is one way of obtaining a tour's data from its page URL
+type fetchStrategy struct {
+	name  string
+	fetch func(c *Converter, ctx context.Context, tourURL string, cache *tourCache) (*KomootResponse, error)
+}
+
+// fetchStrategies are tried in order until one returns the tour data
+var fetchStrategies = []fetchStrategy{
+	{name: "scrape", fetch: (*Converter).scrapeTour},
+	{name: "api", fetch: (*Converter).fetchTourFromAPI},
+}
+
+// Fetch modes select which of fetchStrategies Configuration.Fetch allows
+const (
+	// FetchAuto scrapes the tour page and falls back to the API
+	FetchAuto = "auto"
+	// FetchHTML only scrapes the tour page
+	FetchHTML = "html"
+	// FetchAPI only requests the tour from the Komoot API
+	FetchAPI = "api"
+)
+
+// FetchModes lists the supported fetch modes
+var FetchModes = []string{FetchAuto, FetchHTML, FetchAPI}
+
+// strategies returns the fetch strategies allowed by Configuration.Fetch
+func (c *Converter) strategies() ([]fetchStrategy, error) {
+	var name string
+	switch c.config.Fetch {
+	case FetchAuto, "":
+		return fetchStrategies, nil
+	case FetchHTML:
+		name = "scrape"
+	case FetchAPI:
+		name = "api"
+	default:
+		return nil, fmt.Errorf("unknown fetch mode %q", c.config.Fetch)
+	}
+
+	for _, strategy := range fetchStrategies {
+		if strategy.name == name {
+			return []fetchStrategy{strategy}, nil
+		}
+	}
+	return nil, fmt.Errorf("no %s fetch strategy", name)
+}
+
+// tourPathPattern matches the tour kind and numeric ID in a tour URL path,
+// with or without a locale prefix like /de-de
+var tourPathPattern = regexp.MustCompile(`^(/[a-z]{2}-[a-z]{2})?/(tour|smarttour)/(\d+)/?$`)
+
+// ParseTourPath returns the kind, tour or smarttour, and the ID of the tour a
+// Komoot URL path points to. ok is false when path is not a tour page.
+func ParseTourPath(path string) (kind string, id TourID, ok bool) {
+	match := tourPathPattern.FindStringSubmatch(path)
+	if match == nil {
+		return "", "", false
+	}
+	return match[2], TourID(match[3]), true
+}
+
+// fetchTour obtains the tour data, falling back through the fetch strategies
+// allowed by Configuration.Fetch when an earlier one fails
+func (c *Converter) fetchTour(ctx context.Context, tourURL string) (*KomootResponse, error) {
+	return c.fetchCachedTour(ctx, tourURL, nil)
+}
+
+// fetchCachedTour is fetchTour for a tour with a cache entry. It returns
+// ErrUnchanged when the page is not modified or the tour data hashes the same
+// as on the last run.
+func (c *Converter) fetchCachedTour(ctx context.Context, tourURL string, cache *tourCache) (*KomootResponse, error) {
+	if IsCollectionURL(tourURL) {
+		return nil, ErrCollection
+	}
+	strategies, err := c.strategies()
+	if err != nil {
+		return nil, err
+	}
+
+	c.reporter.OnDownloadStart(tourURL)
+	var errs []error
+	for _, strategy := range strategies {
+		komootResp, err := strategy.fetch(c, ctx, tourURL, cache)
+		if errors.Is(err, ErrUnchanged) {
+			return nil, err
+		}
+		if err == nil && cache.unchanged(komootResp) {
+			return nil, ErrUnchanged
+		}
+		if err == nil {
+			c.logger.Printf("Fetched tour data using %s strategy\n", strategy.name)
+			if komootResp.Page.Embedded.Tour.ID == "" {
+				komootResp.Page.Embedded.Tour.ID = tourIDFromURL(tourURL)
+			}
+			return komootResp, nil
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %w", strategy.name, err))
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			break
+		}
+		c.logger.Printf("Fetching with %s strategy failed: %v\n", strategy.name, err)
+	}
+
+	return nil, fmt.Errorf("failed to fetch tour data: %w", errors.Join(errs...))
+}
+
+// scrapeTour downloads the tour page and extracts its embedded tour data
+func (c *Converter) scrapeTour(ctx context.Context, tourURL string, cache *tourCache) (*KomootResponse, error) {
+	html, err := c.makeConditionalRequest(ctx, tourURL, cache)
+	if errors.Is(err, ErrUnchanged) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to download tour data: %w", err)
+	}
+
+	return c.parseTourPage(html)
+}
+
+// fetchTourFromAPI requests the tour directly from the Komoot API using the
+// tour ID from the page URL. API responses are only compared by hash for the
+// cache, so cache is unused.
+func (c *Converter) fetchTourFromAPI(ctx context.Context, tourURL string, cache *tourCache) (*KomootResponse, error) {
+	apiURL, err := c.tourAPIURL(tourURL)
+	if err != nil {
+		return nil, err
+	}
+
+	c.logger.Printf("Requesting tour data from %s\n", apiURL)
+	body, err := c.makeHTTPRequest(ctx, apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download tour data: %w", err)
+	}
+
+	var komootResp KomootResponse
+	if err := json.Unmarshal(body, &komootResp.Page.Embedded.Tour); err != nil {
+		return nil, fmt.Errorf("failed to parse API JSON data: %w", err)
+	}
+
+	return &komootResp, nil
+}
+
+// tourIDFromURL returns the numeric tour ID in a tour URL, or "" when there
+// is none
+func tourIDFromURL(tourURL string) TourID {
+	parsedURL, err := url.Parse(tourURL)
+	if err != nil {
+		return ""
+	}
+	_, id, _ := ParseTourPath(parsedURL.Path)
+	return id
+}
+
+// tourAPIURL builds the API URL for the tour or smart tour in tourURL,
+// embedding the highlights unless waypoints are skipped
+func (c *Converter) tourAPIURL(tourURL string) (string, error) {
+	parsedURL, err := url.Parse(tourURL)
+	if err != nil {
+		return "", fmt.Errorf("error parsing URL: %w", err)
+	}
+
+	kind, id, ok := ParseTourPath(parsedURL.Path)
+	if !ok {
+		return "", fmt.Errorf("no tour ID found in URL %q", tourURL)
+	}
+
+	collection := "tours"
+	if kind == "smarttour" {
+		collection = "smart_tours"
+	}
+
+	embedded := []string{"coordinates"}
+	if !c.config.SkipWaypoints {
+		embedded = append(embedded, "highlights")
+	}
+	if c.config.SegmentBySurface {
+		embedded = append(embedded, "surfaces")
+	}
+	apiURL := fmt.Sprintf("%s/%s/%s?_embedded=%s", strings.TrimSuffix(c.config.APIBaseURL, "/"), collection, id, strings.Join(embedded, ","))
+
+	// Tours shared by link are only readable with their share token
+	if token := parsedURL.Query().Get("share_token"); token != "" {
+		apiURL += "&share_token=" + url.QueryEscape(token)
+	}
+	return apiURL, nil
+}
@@ -0,0 +1,212 @@
+package gokomoot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTourAPIURL(t *testing.T) {
+	converter := NewConverter(DefaultConfig())
+
+	tests := map[string]string{
+		"https://www.komoot.com/tour/123456":           "https://api.komoot.de/v007/tours/123456?_embedded=coordinates,highlights",
+		"https://www.komoot.com/de-de/tour/123456":     "https://api.komoot.de/v007/tours/123456?_embedded=coordinates,highlights",
+		"https://www.komoot.com/smarttour/33303609":    "https://api.komoot.de/v007/smart_tours/33303609?_embedded=coordinates,highlights",
+		"https://www.komoot.com/smarttour/e2/33303609": "",
+	}
+	for input, want := range tests {
+		got, err := converter.tourAPIURL(input)
+		if want == "" {
+			if err == nil {
+				t.Fatalf("tourAPIURL(%q) = %q, want error", input, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("tourAPIURL(%q) error = %v", input, err)
+		}
+		if got != want {
+			t.Fatalf("tourAPIURL(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestParseTourPath(t *testing.T) {
+	tests := map[string]string{
+		"/tour/123":          "tour 123",
+		"/de-de/tour/123/":   "tour 123",
+		"/smarttour/77":      "smarttour 77",
+		"/smarttour/e2/77":   "",
+		"/tour/abc":          "",
+		"/collection/123":    "",
+		"/discover/tour/123": "",
+	}
+	for path, want := range tests {
+		kind, id, ok := ParseTourPath(path)
+		got := ""
+		if ok {
+			got = kind + " " + string(id)
+		}
+		if got != want {
+			t.Fatalf("ParseTourPath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestTourAPIURLRequestsSurfaces(t *testing.T) {
+	config := DefaultConfig()
+	config.SegmentBySurface = true
+
+	got, err := NewConverter(config).tourAPIURL("https://www.komoot.com/tour/123456")
+	if want := "https://api.komoot.de/v007/tours/123456?_embedded=coordinates,highlights,surfaces"; err != nil || got != want {
+		t.Fatalf("tourAPIURL() = %q, %v, want %q", got, err, want)
+	}
+}
+
+func TestTourAPIURLForwardsShareToken(t *testing.T) {
+	config := DefaultConfig()
+	config.SkipWaypoints = true
+
+	got, err := NewConverter(config).tourAPIURL("https://www.komoot.com/tour/123456?share_token=a%2Bb&ref=wtd")
+	if want := "https://api.komoot.de/v007/tours/123456?_embedded=coordinates&share_token=a%2Bb"; err != nil || got != want {
+		t.Fatalf("tourAPIURL() = %q, %v, want %q", got, err, want)
+	}
+}
+
+func TestConvertKomootToGPXFallsBackToAPI(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		switch r.URL.Path {
+		case "/tour/42":
+			fmt.Fprint(w, "<html>new frontend without boot props</html>")
+		case "/v007/tours/42":
+			fmt.Fprint(w, `{"name":"API tour","_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35}]},"highlights":{"items":[{"name":"Viewpoint","mid_point":{"lat":51.5,"lng":-0.12}}]}}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.APIBaseURL = server.URL + "/v007"
+	outputPath := filepath.Join(t.TempDir(), "route.gpx")
+	if err := NewConverter(config).Convert(context.Background(), server.URL+"/tour/42", outputPath); err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+
+	if len(requests) != 2 || requests[1] != "/v007/tours/42" {
+		t.Fatalf("requests = %v, want page then API", requests)
+	}
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("os.ReadFile() error = %v", err)
+	}
+	if !strings.Contains(string(content), "<name>API tour</name>") {
+		t.Fatalf("GPX output missing API tour name:\n%s", content)
+	}
+	if !strings.Contains(string(content), "<name>Viewpoint</name>") {
+		t.Fatalf("GPX output missing API highlight:\n%s", content)
+	}
+}
+
+func TestFetchTourTakesTourIDFromURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name":"No id","_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35}]}}}`)
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.APIBaseURL = server.URL
+	komootResp, err := NewConverter(config).fetchTour(context.Background(), server.URL+"/de-de/tour/987")
+	if err != nil {
+		t.Fatalf("fetchTour() error = %v", err)
+	}
+	if got := komootResp.Page.Embedded.Tour.ID; got != "987" {
+		t.Fatalf("tour ID = %q, want 987", got)
+	}
+}
+
+func TestConvertKomootToGPXReportsAllStrategyErrors(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.APIBaseURL = server.URL
+	err := NewConverter(config).Convert(context.Background(), server.URL+"/tour/42", filepath.Join(t.TempDir(), "route.gpx"))
+	if err == nil || !strings.Contains(err.Error(), "scrape: ") || !strings.Contains(err.Error(), "api: ") {
+		t.Fatalf("Convert() error = %v, want both strategy errors", err)
+	}
+}
+
+func TestConvertFetchModes(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		switch r.URL.Path {
+		case "/tour/42":
+			fmt.Fprint(w, tourPageHTML(t, `{"page":{"_embedded":{"tour":{"id":42,"name":"Page tour","_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35}]}}}}}}`))
+		case "/v007/tours/42":
+			fmt.Fprint(w, `{"name":"API tour","_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35}]},"highlights":{"items":[{"name":"Viewpoint","mid_point":{"lat":51.5,"lng":-0.12}}]}}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		mode     string
+		wantPath string
+		wantName string
+	}{
+		{FetchAuto, "/tour/42", "Page tour"},
+		{FetchHTML, "/tour/42", "Page tour"},
+		{FetchAPI, "/v007/tours/42", "API tour"},
+	}
+	for _, tt := range tests {
+		requests = nil
+		config := DefaultConfig()
+		config.APIBaseURL = server.URL + "/v007"
+		config.Fetch = tt.mode
+		config.Verbosity = VerbosityQuiet
+		gpx, err := NewConverter(config).FetchGPX(context.Background(), server.URL+"/tour/42")
+		if err != nil {
+			t.Fatalf("FetchGPX() with -fetch %s error = %v", tt.mode, err)
+		}
+		if len(requests) != 1 || requests[0] != tt.wantPath || gpx.Tracks[0].Name != tt.wantName {
+			t.Fatalf("FetchGPX() with -fetch %s requested %v and got %q, want only %s and %q", tt.mode, requests, gpx.Tracks[0].Name, tt.wantPath, tt.wantName)
+		}
+	}
+
+	config := DefaultConfig()
+	config.Fetch = "ftp"
+	if _, err := NewConverter(config).FetchGPX(context.Background(), server.URL+"/tour/42"); err == nil || !strings.Contains(err.Error(), "unknown fetch mode") {
+		t.Fatalf("FetchGPX() with an unknown mode error = %v, want unknown fetch mode", err)
+	}
+}
+
+func TestFetchHTMLDoesNotFallBackToAPI(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		fmt.Fprint(w, "<html>new frontend without boot props</html>")
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.APIBaseURL = server.URL + "/v007"
+	config.Fetch = FetchHTML
+	config.Verbosity = VerbosityQuiet
+	if _, err := NewConverter(config).FetchGPX(context.Background(), server.URL+"/tour/42"); err == nil {
+		t.Fatal("FetchGPX() error = nil, want the scrape error")
+	}
+	if len(requests) != 1 {
+		t.Fatalf("requests = %v, want only the page", requests)
+	}
+}
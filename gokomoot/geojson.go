@@ -0,0 +1,65 @@
+package gokomoot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// geoJSONFeatureCollection is a GeoJSON FeatureCollection of tracks
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+// geoJSONFeature is a GeoJSON Feature holding one track
+type geoJSONFeature struct {
+	Type       string            `json:"type"`
+	Properties map[string]string `json:"properties"`
+	Geometry   geoJSONGeometry   `json:"geometry"`
+}
+
+// geoJSONGeometry is a MultiLineString with one line per track segment
+type geoJSONGeometry struct {
+	Type        string        `json:"type"`
+	Coordinates [][][]float64 `json:"coordinates"`
+}
+
+// toGeoJSON converts every track to a GeoJSON feature with [lon, lat, ele]
+// positions, or [lon, lat] for points without elevation
+func (g *GPX) toGeoJSON() geoJSONFeatureCollection {
+	collection := geoJSONFeatureCollection{Type: "FeatureCollection", Features: []geoJSONFeature{}}
+	for _, track := range g.Tracks {
+		feature := geoJSONFeature{
+			Type:       "Feature",
+			Properties: map[string]string{},
+			Geometry:   geoJSONGeometry{Type: "MultiLineString", Coordinates: [][][]float64{}},
+		}
+		if track.Name != "" {
+			feature.Properties["name"] = track.Name
+		}
+		for _, segment := range track.Segments {
+			line := make([][]float64, 0, len(segment.Points))
+			for _, point := range segment.Points {
+				position := []float64{point.Lon, point.Lat}
+				if !point.NoElevation {
+					position = append(position, point.Elevation)
+				}
+				line = append(line, position)
+			}
+			feature.Geometry.Coordinates = append(feature.Geometry.Coordinates, line)
+		}
+		collection.Features = append(collection.Features, feature)
+	}
+	return collection
+}
+
+// writeGeoJSON writes every track as a feature of a GeoJSON FeatureCollection
+func writeGeoJSON(gpx *GPX, w io.Writer, indent string) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", indent)
+	if err := encoder.Encode(gpx.toGeoJSON()); err != nil {
+		return fmt.Errorf("error writing GeoJSON: %w", err)
+	}
+	return nil
+}
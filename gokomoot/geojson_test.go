@@ -0,0 +1,31 @@
+package gokomoot
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteGeoJSON(t *testing.T) {
+	gpx := &GPX{Tracks: []Track{{Name: "Tour", Segments: []Segment{{Points: []Point{
+		{Lat: 52.5, Lon: 13.4, Elevation: 34},
+		{Lat: 52.6, Lon: 13.5, NoElevation: true},
+	}}}}}}
+
+	var buf bytes.Buffer
+	if err := writeGeoJSON(gpx, &buf, "  "); err != nil {
+		t.Fatalf("writeGeoJSON() error = %v", err)
+	}
+
+	var decoded geoJSONFeatureCollection
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if decoded.Type != "FeatureCollection" || len(decoded.Features) != 1 || decoded.Features[0].Properties["name"] != "Tour" {
+		t.Fatalf("writeGeoJSON() = %s, want one feature named Tour", buf.String())
+	}
+	line := decoded.Features[0].Geometry.Coordinates[0]
+	if len(line) != 2 || len(line[0]) != 3 || line[0][2] != 34 || len(line[1]) != 2 || line[1][0] != 13.5 {
+		t.Fatalf("coordinates = %v, want [[13.4 52.5 34] [13.5 52.6]]", line)
+	}
+}
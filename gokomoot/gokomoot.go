@@ -0,0 +1,1855 @@
+// Package gokomoot converts Komoot tours to GPX and related formats.
+//
+// A Converter downloads a tour page, decodes the embedded tour data and
+// writes it in the configured output format:
+//
+//	converter := gokomoot.NewConverter(gokomoot.DefaultConfig())
+//	err := converter.Convert(ctx, "https://www.komoot.com/tour/123", "route.gpx")
+//
+// FetchGPX returns the converted track in memory instead.
+package gokomoot
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Configuration holds application settings
+type Configuration struct {
+	UserAgent     string
+	HTTPTimeout   time.Duration
+	MaxRetries    int
+	RetryInterval time.Duration
+	MetadataTime  string
+	// RetryBudget, when positive, caps the number of retries of all
+	// requests made by the Converter together, so a flaky network fails the
+	// rest of a long batch fast instead of retrying every tour
+	RetryBudget int
+	// RequestsPerSecond, when positive, caps the rate of all requests made
+	// by the Converter together, including retries and the requests of
+	// concurrent batch workers
+	RequestsPerSecond float64
+	// Name, when set, replaces the Komoot tour name as the metadata and
+	// track name in every output format
+	Name          string
+	Keywords      []string
+	CloseLoop     bool
+	LoopThreshold float64
+	// ElevationThreshold is the minimum elevation change in meters counted
+	// as ascent or descent, filtering out GPS and DEM noise
+	ElevationThreshold      float64
+	EmitCumulativeElevation bool
+	// EmitSpeed writes the speed of every timed track point as a Garmin
+	// TrackPointExtension
+	EmitSpeed bool
+	// SimplifyTolerance, when positive, simplifies every track in place
+	// using this simplification tolerance in meters
+	SimplifyTolerance float64
+	// InterpolateElevation fills in the elevation of points without one;
+	// see GPX.InterpolateElevation
+	InterpolateElevation bool
+	// StripElevation removes all elevation from the output, after every
+	// other transformation; see GPX.StripElevation
+	StripElevation bool
+	// DedupeConsecutive removes points at the same position as the point
+	// before them; see GPX.DedupeConsecutive
+	DedupeConsecutive bool
+	// DownsampleEvery, when greater than 1, keeps only every nth point of
+	// each segment plus its last point
+	DownsampleEvery int
+	// SplitDistance, when positive, splits the tracks into parts of about
+	// this many kilometers, written to numbered outputs such as tour-1.gpx.
+	// It can't be combined with PreviewTolerance or ElevationBands.
+	SplitDistance float64
+	// PreviewTolerance, when positive, adds a simplified "preview" track
+	// using this simplification tolerance in meters
+	PreviewTolerance float64
+	// ElevationBands, when set, splits the track into one track per band
+	// between these ascending elevation boundaries in meters
+	ElevationBands []float64
+	// EmitDistance stores the track distance, computed with Distance, in
+	// the metadata extensions
+	EmitDistance bool
+	Distance     DistanceOptions
+	// MatchKomootDistance scales the stored distance to the one Komoot
+	// reports and logs the scale factor
+	MatchKomootDistance bool
+	// Format is the output format, one of the Format constants
+	Format string
+	// LeafletURL is the base URL serving leaflet.js and leaflet.css for the
+	// HTML viewer, and TileURL the map tile URL template it displays
+	LeafletURL string
+	TileURL    string
+	// DryRun downloads, converts and validates tours and logs a summary of
+	// each, but writes no output
+	DryRun bool
+	// Overwrite replaces existing output files. Without it, writing to a
+	// file that already exists fails with ErrOutputExists.
+	Overwrite bool
+	// SegmentBySurface starts a new track segment wherever Komoot's surface
+	// data changes, repeating the boundary point so segments stay connected
+	SegmentBySurface bool
+	// SkipWaypoints leaves out the tour's highlights, which are otherwise
+	// written as <wpt> waypoints
+	SkipWaypoints bool
+	// WaypointSymbols maps Komoot highlight categories to GPX waypoint
+	// symbols, overriding and extending the built-in highlightSymbols table
+	WaypointSymbols map[string]string
+	// SessionCookie, when set, is sent as the Cookie header of every request
+	// so private tours of the logged-in account can be downloaded
+	SessionCookie string
+	// RotateUserAgent sends a User-Agent picked at random from a few common
+	// browsers with each request instead of UserAgent
+	RotateUserAgent bool
+	// AcceptLanguage, when set, is sent as the Accept-Language header of
+	// every request, which picks the language of tour names and descriptions
+	AcceptLanguage string
+	// APIBaseURL is the Komoot API root used when scraping the tour page
+	// fails or Fetch is FetchAPI
+	APIBaseURL string
+	// Fetch selects how tour data is obtained: FetchAuto, FetchHTML or
+	// FetchAPI
+	Fetch string
+	// EmitLocalOffset stores the tour's local UTC offset in the metadata
+	// extensions next to the UTC metadata time
+	EmitLocalOffset bool
+	// VerifyRoundTrip re-reads the written GPX file and checks that it holds
+	// the converted points
+	VerifyRoundTrip bool
+	// SetModTime sets the output file's modification time to the tour date
+	SetModTime bool
+	// TargetSize, when positive, simplifies the track until the encoded
+	// output is at most this many bytes
+	TargetSize int64
+	// MaxPoints, when positive, simplifies the track until it has at most
+	// this many points, keeping each segment's endpoints
+	MaxPoints int
+	// ClipBounds, when set, drops the points outside the box before the
+	// other transformations; see GPX.ClipToBounds
+	ClipBounds *Bounds
+	// SegmentSize, when positive, re-segments tracks into segments of at
+	// most this many points
+	SegmentSize int
+	// DNSCacheTTL, when positive, caches resolved host addresses for this long
+	DNSCacheTTL time.Duration
+	// Proxy, when set, sends every request through this proxy; otherwise the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables apply
+	Proxy *url.URL
+	// MaxIdleConnsPerHost is how many idle connections to each host are
+	// kept for reuse; zero keeps Concurrency of them, so a batch doesn't
+	// close and reopen connections between tours
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout is how long an idle keep-alive connection is kept
+	// before it is closed; zero leaves Go's default of 90 seconds
+	IdleConnTimeout time.Duration
+	// ForceAttemptHTTP2 negotiates HTTP/2 even with the custom dialer of
+	// DNSCacheTTL or a proxy, so requests share one connection per host
+	ForceAttemptHTTP2 bool
+	// HTTPClient, when set, is used as is for every request instead of a
+	// client built from HTTPTimeout, DNSCacheTTL, Proxy, the connection
+	// settings above and Middlewares
+	HTTPClient *http.Client
+	// Verbosity selects which progress messages are logged
+	Verbosity Verbosity
+	// Logger receives the progress messages, stderr when nil
+	Logger *log.Logger
+	// Concurrency bounds how many tours ConvertBatch converts at a time
+	Concurrency int
+	// ConcurrencyPerHost bounds how many requests to the same host, such as
+	// the tour pages' host or the API's, are in flight at a time across all
+	// workers. Zero leaves only the Concurrency limit.
+	ConcurrencyPerHost int
+	// TourTimeout limits how long ConvertBatch spends on each tour, retries
+	// included, so a slow tour can't use up the whole batch's deadline. Zero
+	// means no limit beyond the context's.
+	TourTimeout time.Duration
+	// Middlewares wrap the HTTP transport in order: the first middleware is
+	// the outermost, seeing each request first and each response last
+	Middlewares []func(http.RoundTripper) http.RoundTripper
+	// Destinations maps output URL schemes to resolvers, overriding the
+	// built-in file and stdout ones; see DestinationResolver
+	Destinations map[string]DestinationResolver
+	// PayloadDecoders extract the tour data from page variants the built-in
+	// decoders don't know, and are tried before them; see PayloadDecoder
+	PayloadDecoders []PayloadDecoder
+	// MaxBackoff caps the wait between retries, including waits requested
+	// by a Retry-After header; no cap when zero
+	MaxBackoff time.Duration
+	// OnRetry, when set, is called before each retry sleep with the attempt
+	// about to be made, the error that caused the retry and the wait duration
+	OnRetry func(attempt int, err error, next time.Duration)
+	// PolylinePrecision is the number of coordinate decimals in polyline
+	// output, PolylinePrecision5 or PolylinePrecision6
+	PolylinePrecision int
+	// Strict fails conversions whose track distance is far from the distance
+	// Komoot reports, instead of only logging a warning
+	Strict bool
+	// CacheDir, when set, keeps a small record per tour and destination of
+	// what was written, so later runs send conditional requests and skip
+	// tours that haven't changed
+	CacheDir string
+	// Indent is the indentation of each nesting level in GPX, KML, TCX and
+	// GeoJSON output, such as two spaces or a tab; empty writes compact
+	// output without line breaks
+	Indent string
+	// Reporter receives progress events; by default they are logged to
+	// Logger
+	Reporter Reporter
+}
+
+// Metadata time modes select which timestamp is written to <metadata><time>
+const (
+	MetadataTimeRecord = "record"
+	MetadataTimeNow    = "now"
+	MetadataTimeNone   = "none"
+)
+
+// DefaultConfig returns default configuration values
+func DefaultConfig() Configuration {
+	return Configuration{
+		UserAgent:          "komootgpx",
+		Indent:             "  ",
+		PolylinePrecision:  PolylinePrecision5,
+		APIBaseURL:         "https://api.komoot.de/v007",
+		Fetch:              FetchAuto,
+		HTTPTimeout:        10 * time.Second,
+		MaxRetries:         3,
+		RetryInterval:      2 * time.Second,
+		MaxBackoff:         30 * time.Second,
+		MetadataTime:       MetadataTimeRecord,
+		Format:             FormatGPX,
+		LeafletURL:         "https://unpkg.com/leaflet@1.9.4/dist",
+		TileURL:            "https://tile.openstreetmap.org/{z}/{x}/{y}.png",
+		LoopThreshold:      50,
+		ElevationThreshold: 3,
+		Concurrency:        4,
+		TourTimeout:        2 * time.Minute,
+		ForceAttemptHTTP2:  true,
+	}
+}
+
+// GPX 1.1 namespaces and schema, and the GPX 1.0 namespace ReadGPX accepts
+// as well
+const (
+	GPXNamespace      = "http://www.topografix.com/GPX/1/1"
+	GPXNamespace10    = "http://www.topografix.com/GPX/1/0"
+	XSINamespace      = "http://www.w3.org/2001/XMLSchema-instance"
+	GPXSchemaLocation = GPXNamespace + " http://www.topografix.com/GPX/1/1/gpx.xsd"
+)
+
+// Models
+
+// GPX represents the root GPX element
+type GPX struct {
+	XMLName xml.Name `xml:"gpx"`
+	XMLNS   string   `xml:"xmlns,attr,omitempty"`
+	// XMLNSXSI and SchemaLocation point validators at the GPX 1.1 schema.
+	// XMLNSGPXTPX declares the gpxtpx prefix of Garmin's track point
+	// extension when points carry speeds.
+	XMLNSXSI       string     `xml:"xmlns:xsi,attr,omitempty"`
+	SchemaLocation string     `xml:"xsi:schemaLocation,attr,omitempty"`
+	XMLNSGPXTPX    string     `xml:"xmlns:gpxtpx,attr,omitempty"`
+	Version        string     `xml:"version,attr"`
+	Creator        string     `xml:"creator,attr"`
+	Metadata       *Metadata  `xml:"metadata,omitempty"`
+	Waypoints      []Waypoint `xml:"wpt"`
+	Tracks         []Track    `xml:"trk"`
+}
+
+// Metadata represents GPX metadata
+type Metadata struct {
+	Name       string              `xml:"name,omitempty"`
+	Desc       string              `xml:"desc,omitempty"`
+	Time       *time.Time          `xml:"time,omitempty"`
+	Keywords   string              `xml:"keywords,omitempty"`
+	Bounds     *Bounds             `xml:"bounds,omitempty"`
+	Extensions *MetadataExtensions `xml:"extensions,omitempty"`
+}
+
+// Bounds is the extent of the points in a GPX file, which consumers use to
+// set the initial map view
+type Bounds struct {
+	MinLat float64 `xml:"minlat,attr"`
+	MinLon float64 `xml:"minlon,attr"`
+	MaxLat float64 `xml:"maxlat,attr"`
+	MaxLon float64 `xml:"maxlon,attr"`
+}
+
+// MetadataExtensions holds optional tour data written under <metadata><extensions>
+type MetadataExtensions struct {
+	// LocalOffset is the tour's UTC offset as reported by Komoot, e.g. +02:00
+	LocalOffset string `xml:"https://github.com/mfkd/gokomoot localOffset,omitempty"`
+	// TourID is the Komoot tour ID the GPX was converted from
+	TourID string `xml:"https://github.com/mfkd/gokomoot tourId,omitempty"`
+	// Distance is the track distance in meters
+	Distance string `xml:"https://github.com/mfkd/gokomoot distance,omitempty"`
+}
+
+// Waypoint represents a GPX waypoint, a named point of interest
+type Waypoint struct {
+	Lat         float64 `xml:"lat,attr"`
+	Lon         float64 `xml:"lon,attr"`
+	Elevation   float64 `xml:"ele,omitempty"`
+	Name        string  `xml:"name,omitempty"`
+	Description string  `xml:"desc,omitempty"`
+	// Symbol is the icon GPS devices show, such as "Scenic Area"
+	Symbol string `xml:"sym,omitempty"`
+	// Type is the Komoot highlight category, such as viewpoint
+	Type string `xml:"type,omitempty"`
+}
+
+// Track represents a GPX track
+type Track struct {
+	Name string `xml:"name,omitempty"`
+	// Type is the activity, Komoot's sport such as hike or touring_bicycle
+	Type     string    `xml:"type,omitempty"`
+	Segments []Segment `xml:"trkseg"`
+}
+
+// Segment represents a track segment
+type Segment struct {
+	Points []Point `xml:"trkpt"`
+}
+
+// Point represents a track point with validation methods
+type Point struct {
+	Lat       float64
+	Lon       float64
+	Elevation float64
+	// NoElevation marks a point whose source had no altitude, as opposed to
+	// one at sea level; <ele> is left out for it and Elevation is ignored
+	NoElevation bool
+	Time        *time.Time
+	Extensions  *PointExtensions
+}
+
+// pointXML is the XML form of a Point, leaving out <ele> for points without
+// elevation
+type pointXML struct {
+	Lat        float64          `xml:"lat,attr"`
+	Lon        float64          `xml:"lon,attr"`
+	Elevation  *float64         `xml:"ele,omitempty"`
+	Time       *time.Time       `xml:"time,omitempty"`
+	Extensions *PointExtensions `xml:"extensions,omitempty"`
+}
+
+// MarshalXML encodes the point as a GPX waypoint element
+func (p Point) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	encoded := pointXML{Lat: p.Lat, Lon: p.Lon, Time: p.Time, Extensions: p.Extensions}
+	if !p.NoElevation {
+		encoded.Elevation = &p.Elevation
+	}
+	return e.EncodeElement(encoded, start)
+}
+
+// UnmarshalXML decodes a GPX waypoint element, setting NoElevation when it
+// has no <ele>
+func (p *Point) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var decoded pointXML
+	if err := d.DecodeElement(&decoded, &start); err != nil {
+		return err
+	}
+
+	*p = Point{Lat: decoded.Lat, Lon: decoded.Lon, Time: decoded.Time, Extensions: decoded.Extensions}
+	if decoded.Elevation != nil {
+		p.Elevation = *decoded.Elevation
+	} else {
+		p.NoElevation = true
+	}
+	return nil
+}
+
+// PointExtensions holds optional per-point data written under <extensions>
+type PointExtensions struct {
+	CumulativeElevation *CumulativeElevation `xml:"https://github.com/mfkd/gokomoot cumulativeElevation,omitempty"`
+	TrackPointExtension *TrackPointExtension `xml:"gpxtpx:TrackPointExtension,omitempty"`
+}
+
+// CumulativeElevation is the ascent and descent in meters from the start of
+// the track up to a point
+type CumulativeElevation struct {
+	Ascent  float64 `xml:"ascent"`
+	Descent float64 `xml:"descent"`
+}
+
+// Plausible elevation range in meters, from below the Dead Sea shore to above
+// Mount Everest
+const (
+	minElevation = -500
+	maxElevation = 9000
+)
+
+// Validate checks if the point coordinates and, when present, its elevation
+// are valid
+func (p Point) Validate() error {
+	if err := p.validateCoordinates(); err != nil {
+		return err
+	}
+	if !p.plausibleElevation() {
+		return fmt.Errorf("invalid elevation: %f", p.Elevation)
+	}
+	return nil
+}
+
+// validateCoordinates checks if the point's latitude and longitude are valid
+func (p Point) validateCoordinates() error {
+	if p.Lat < -90 || p.Lat > 90 {
+		return fmt.Errorf("invalid latitude: %f", p.Lat)
+	}
+	if p.Lon < -180 || p.Lon > 180 {
+		return fmt.Errorf("invalid longitude: %f", p.Lon)
+	}
+	return nil
+}
+
+// plausibleElevation reports whether the point has no elevation or one
+// within the plausible range
+func (p Point) plausibleElevation() bool {
+	return p.NoElevation || (p.Elevation >= minElevation && p.Elevation <= maxElevation)
+}
+
+// dropImplausibleElevation removes an elevation outside the plausible range,
+// which Komoot sends for broken altitude data, and reports whether it did
+func (p *Point) dropImplausibleElevation() bool {
+	if p.plausibleElevation() {
+		return false
+	}
+	p.Elevation, p.NoElevation = 0, true
+	return true
+}
+
+// warnImplausibleElevations logs how many implausible elevations were dropped
+func (c *Converter) warnImplausibleElevations(dropped int) {
+	if dropped > 0 {
+		c.logger.Printf("Warning: dropped %d elevations outside %d to %d m\n", dropped, minElevation, maxElevation)
+	}
+}
+
+// EarthRadius is the mean Earth radius in meters used for distance calculations
+const EarthRadius = 6371000
+
+// haversineDistance returns the great-circle distance between two points in meters
+func haversineDistance(a, b Point) float64 {
+	return greatCircleDistance(a, b, EarthRadius)
+}
+
+// endpoints returns pointers to the first and last track points of the GPX
+func (g *GPX) endpoints() (first, last *Point, ok bool) {
+	for ti := range g.Tracks {
+		for si := range g.Tracks[ti].Segments {
+			points := g.Tracks[ti].Segments[si].Points
+			if len(points) == 0 {
+				continue
+			}
+			if first == nil {
+				first = &points[0]
+			}
+			last = &points[len(points)-1]
+		}
+	}
+	return first, last, first != nil
+}
+
+// eachPoint calls fn for every track point in order
+func (g *GPX) eachPoint(fn func(p *Point)) {
+	for ti := range g.Tracks {
+		for si := range g.Tracks[ti].Segments {
+			points := g.Tracks[ti].Segments[si].Points
+			for pi := range points {
+				fn(&points[pi])
+			}
+		}
+	}
+}
+
+// elevationCounter accumulates ascent and descent, only counting a change once
+// it reaches threshold meters from the last counted elevation
+type elevationCounter struct {
+	threshold float64
+	reference float64
+	started   bool
+	ascent    float64
+	descent   float64
+}
+
+func (e *elevationCounter) add(elevation float64) {
+	if !e.started {
+		e.reference = elevation
+		e.started = true
+		return
+	}
+
+	delta := elevation - e.reference
+	switch {
+	case delta > 0 && delta >= e.threshold:
+		e.ascent += delta
+		e.reference = elevation
+	case delta < 0 && -delta >= e.threshold:
+		e.descent -= delta
+		e.reference = elevation
+	}
+}
+
+// ElevationStats returns the total ascent and descent of all track points in
+// meters. Changes smaller than threshold meters from the last counted
+// elevation are ignored so GPS and DEM noise doesn't inflate the totals.
+func (g *GPX) ElevationStats(threshold float64) (gain, loss float64) {
+	counter := elevationCounter{threshold: threshold}
+	g.eachPoint(func(p *Point) {
+		if !p.NoElevation {
+			counter.add(p.Elevation)
+		}
+	})
+	return counter.ascent, counter.descent
+}
+
+// addCumulativeElevation records the running ascent and descent on every point
+func (g *GPX) addCumulativeElevation(threshold float64) {
+	counter := elevationCounter{threshold: threshold}
+	g.eachPoint(func(p *Point) {
+		if !p.NoElevation {
+			counter.add(p.Elevation)
+		}
+		if p.Extensions == nil {
+			p.Extensions = &PointExtensions{}
+		}
+		p.Extensions.CumulativeElevation = &CumulativeElevation{
+			Ascent:  math.Round(counter.ascent*10) / 10,
+			Descent: math.Round(counter.descent*10) / 10,
+		}
+	})
+}
+
+// IsLoop reports whether the track starts and ends within threshold meters
+// of each other
+func (g *GPX) IsLoop(threshold float64) bool {
+	first, last, ok := g.endpoints()
+	if !ok || first == last {
+		return false
+	}
+	return haversineDistance(*first, *last) <= threshold
+}
+
+// CloseLoop moves the last track point onto the first one so loop tours end
+// exactly where they start, at the same elevation or, like the first point,
+// without one
+func (g *GPX) CloseLoop() {
+	first, last, ok := g.endpoints()
+	if !ok {
+		return
+	}
+	last.Lat, last.Lon, last.Elevation, last.NoElevation = first.Lat, first.Lon, first.Elevation, first.NoElevation
+}
+
+// KomootResponse represents the JSON structure from Komoot
+type KomootResponse struct {
+	Page struct {
+		Embedded struct {
+			Tour KomootTour `json:"tour"`
+		} `json:"_embedded"`
+	} `json:"page"`
+}
+
+// KomootTour represents a single tour as embedded in the tour page and as
+// returned by the Komoot API
+type KomootTour struct {
+	ID       TourID  `json:"id"`
+	Name     string  `json:"name"`
+	Date     string  `json:"date"`
+	Sport    string  `json:"sport"`
+	Distance float64 `json:"distance"`
+	Duration float64 `json:"duration"`
+	Embedded struct {
+		Coordinates *struct {
+			Items KomootCoordinates `json:"items"`
+		} `json:"coordinates"`
+		Highlights *struct {
+			Items []KomootHighlight `json:"items"`
+		} `json:"highlights"`
+		Surfaces *struct {
+			Items []KomootSection `json:"items"`
+		} `json:"surfaces"`
+	} `json:"_embedded"`
+	// ElevationUp and ElevationDown are the ascent and descent in meters
+	ElevationUp   float64 `json:"elevation_up"`
+	ElevationDown float64 `json:"elevation_down"`
+	// Constitution is the fitness the tour requires, from 1 to 5
+	Constitution int               `json:"constitution"`
+	Difficulty   *KomootDifficulty `json:"difficulty"`
+}
+
+// KomootDifficulty is Komoot's rating of how hard a tour is. Many tours,
+// recorded ones in particular, have none.
+type KomootDifficulty struct {
+	// Grade is easy, moderate or difficult
+	Grade string `json:"grade"`
+	// ExplanationTechnical and ExplanationFitness are Komoot's codes for
+	// the technical and fitness requirements, such as t2 or f3
+	ExplanationTechnical string `json:"explanation_technical"`
+	ExplanationFitness   string `json:"explanation_fitness"`
+}
+
+// KomootSection is a run of tour coordinates, given by their first and last
+// index, that share an attribute such as the surface
+type KomootSection struct {
+	From    int    `json:"from"`
+	To      int    `json:"to"`
+	Element string `json:"element"`
+}
+
+// KomootHighlight is a named point of interest along a tour
+type KomootHighlight struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	MidPoint    *KomootCoordinate `json:"mid_point"`
+	// Category is the kind of highlight, such as viewpoint or water
+	Category string `json:"category"`
+}
+
+// TourID is a Komoot tour ID, which the JSON carries as a number or a string
+type TourID string
+
+// UnmarshalJSON accepts both numeric and string tour IDs
+func (id *TourID) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*id = TourID(text)
+		return nil
+	}
+
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("invalid tour id: %s", data)
+	}
+	*id = TourID(number.String())
+	return nil
+}
+
+// KomootCoordinate is a single coordinate item. Lat and Lng are pointers so
+// an absent field can be told apart from a legitimate 0.
+type KomootCoordinate struct {
+	Lat *float64 `json:"lat"`
+	Lng *float64 `json:"lng"`
+	Alt *float64 `json:"alt"`
+	// T is the time offset from the start of the tour in milliseconds
+	T *float64 `json:"t"`
+}
+
+// KomootCoordinates is a tour's coordinate array. It decodes into a slice
+// sized up front, with the fields of all coordinates sharing one backing
+// array, so long tours don't grow the slice over and over or allocate each
+// coordinate's fields one by one.
+type KomootCoordinates []KomootCoordinate
+
+// UnmarshalJSON decodes the whole array in one pass and then points the
+// present fields into a single array of values
+func (items *KomootCoordinates) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	// Coordinates are flat objects, so counting braces gives the item count
+	decoded := make([]komootCoordinateFields, 0, bytes.Count(data, []byte("{")))
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	values := make([]float64, 4*len(decoded))
+	coordinates := make(KomootCoordinates, len(decoded))
+	for i, fields := range decoded {
+		item := &coordinates[i]
+		for j, field := range []struct {
+			value optionalFloat
+			dst   **float64
+		}{{fields.Lat, &item.Lat}, {fields.Lng, &item.Lng}, {fields.Alt, &item.Alt}, {fields.T, &item.T}} {
+			if field.value.set {
+				values[4*i+j] = field.value.value
+				*field.dst = &values[4*i+j]
+			}
+		}
+	}
+
+	*items = coordinates
+	return nil
+}
+
+// komootCoordinateFields is a coordinate as decoded, before its fields are
+// moved into the shared array of values
+type komootCoordinateFields struct {
+	Lat optionalFloat `json:"lat"`
+	Lng optionalFloat `json:"lng"`
+	Alt optionalFloat `json:"alt"`
+	T   optionalFloat `json:"t"`
+}
+
+// optionalFloat is a JSON number that records whether it was present, so an
+// absent or null field can be told apart from a legitimate 0
+type optionalFloat struct {
+	value float64
+	set   bool
+}
+
+func (f *optionalFloat) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	value, err := strconv.ParseFloat(string(data), 64)
+	if err != nil {
+		return fmt.Errorf("invalid coordinate value %s", data)
+	}
+	f.value, f.set = value, true
+	return nil
+}
+
+// Converter handles the conversion process
+type Converter struct {
+	config   Configuration
+	client   *http.Client
+	logger   *leveledLogger
+	reporter Reporter
+	retries  *retryBudget
+	limiter  *rateLimiter
+	hosts    *hostLimiter
+}
+
+// NewConverter creates a new Converter instance
+func NewConverter(config Configuration) *Converter {
+	client := config.HTTPClient
+	if client == nil {
+		client = newHTTPClient(config)
+	}
+
+	logger := config.Logger
+	if logger == nil {
+		logger = log.New(os.Stderr, "komootgpx: ", log.LstdFlags)
+	}
+
+	leveled := &leveledLogger{logger: logger, verbosity: config.Verbosity}
+	var reporter Reporter = logReporter{logger: leveled}
+	if config.Reporter != nil {
+		reporter = config.Reporter
+	}
+
+	return &Converter{
+		config:   config,
+		client:   client,
+		logger:   leveled,
+		reporter: reporter,
+		retries:  newRetryBudget(config.RetryBudget),
+		limiter:  newRateLimiter(config.RequestsPerSecond),
+		hosts:    newHostLimiter(config.ConcurrencyPerHost),
+	}
+}
+
+// newHTTPClient builds the HTTP client for the configured timeout, proxy,
+// DNS cache, connection reuse and middlewares
+func newHTTPClient(config Configuration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	if config.Proxy != nil {
+		transport.Proxy = http.ProxyURL(config.Proxy)
+	}
+	if config.DNSCacheTTL > 0 {
+		transport.DialContext = newDNSCache(config.DNSCacheTTL).DialContext
+	}
+	idle := config.MaxIdleConnsPerHost
+	if idle <= 0 {
+		idle = config.Concurrency
+	}
+	if idle > 0 {
+		transport.MaxIdleConnsPerHost = idle
+		transport.MaxIdleConns = max(transport.MaxIdleConns, idle)
+	}
+	if config.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = config.IdleConnTimeout
+	}
+	transport.ForceAttemptHTTP2 = config.ForceAttemptHTTP2
+
+	var roundTripper http.RoundTripper = transport
+	for i := len(config.Middlewares) - 1; i >= 0; i-- {
+		roundTripper = config.Middlewares[i](roundTripper)
+	}
+
+	return &http.Client{
+		Timeout:   config.HTTPTimeout,
+		Transport: roundTripper,
+	}
+}
+
+// ErrRequestTimeout is wrapped by request errors caused by the HTTP client's
+// timeout (Configuration.HTTPTimeout) running out
+var ErrRequestTimeout = errors.New("request timed out")
+
+// ErrTourNotFound is matched by the error of a request Komoot answered with
+// 404 Not Found or 410 Gone, such as for a deleted tour or a mistyped ID
+var ErrTourNotFound = errors.New("tour not found")
+
+// StatusError is the error for a response with a status other than 200 OK.
+// Use errors.As to get at the status code.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+}
+
+// Is reports whether the status means the tour doesn't exist, for
+// errors.Is(err, ErrTourNotFound)
+func (e *StatusError) Is(target error) bool {
+	return target == ErrTourNotFound && (e.StatusCode == http.StatusNotFound || e.StatusCode == http.StatusGone)
+}
+
+// requestError marks err as a request timeout when it is one
+func requestError(err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("%w: %w", ErrRequestTimeout, err)
+	}
+	return err
+}
+
+// makeHTTPRequest makes an HTTP GET request, retrying network errors, 429 and
+// 5xx responses with exponential backoff or the wait asked for by Retry-After.
+// Every attempt first waits for the rate limit, if any.
+func (c *Converter) makeHTTPRequest(ctx context.Context, url string) ([]byte, error) {
+	return c.makeConditionalRequest(ctx, url, nil)
+}
+
+// makeConditionalRequest is makeHTTPRequest conditional on the validators in
+// cache, returning ErrUnchanged for a 304 Not Modified response. The
+// validators of a successful response are recorded in cache.
+func (c *Converter) makeConditionalRequest(ctx context.Context, url string, cache *tourCache) ([]byte, error) {
+	body, _, err := c.request(ctx, url, cache, "")
+	return body, err
+}
+
+// makeJSONRequest is makeHTTPRequest for a Komoot API endpoint. It asks for
+// HAL JSON and fails when the response is something else, such as the HTML
+// of a login page, instead of leaving that to a confusing JSON error.
+func (c *Converter) makeJSONRequest(ctx context.Context, url string) ([]byte, error) {
+	body, contentType, err := c.request(ctx, url, nil, "application/hal+json, application/json")
+	if err != nil {
+		return nil, err
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+		return nil, fmt.Errorf("expected JSON from %s, got content type %q", url, contentType)
+	}
+	return body, nil
+}
+
+// request makes the requests of makeConditionalRequest, sending accept as the
+// Accept header when set, and returns the body with its content type
+func (c *Converter) request(ctx context.Context, url string, cache *tourCache, accept string) ([]byte, string, error) {
+	var lastError error
+	var wait time.Duration
+	attempts := c.config.MaxRetries
+	if attempts < 1 {
+		attempts = 1
+	}
+	start := time.Now()
+	var failures []string
+
+	// Retries keep the User-Agent; switching it to get past a 429 would
+	// dodge the rate limit instead of honoring it.
+	userAgent := c.userAgent()
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if !c.retries.take() {
+				c.logFailedAttempts(url, failures)
+				return nil, "", fmt.Errorf("%w: %w", ErrRetryBudgetExhausted, lastError)
+			}
+			c.logger.Printf("Retry attempt %d/%d in %v after %v, %v elapsed\n", attempt+1, attempts, wait, lastError, time.Since(start).Round(time.Millisecond))
+			if c.config.OnRetry != nil {
+				c.config.OnRetry(attempt+1, lastError, wait)
+			}
+			if err := sleepWithContext(ctx, wait); err != nil {
+				return nil, "", fmt.Errorf("retry canceled: %w", err)
+			}
+		}
+
+		if delay := c.limiter.reserve(time.Now()); delay > 0 {
+			c.logger.Verbosef("Rate limited, waiting %v before requesting %s\n", delay.Round(time.Millisecond), url)
+			if err := sleepWithContext(ctx, delay); err != nil {
+				return nil, "", fmt.Errorf("request canceled: %w", err)
+			}
+		}
+
+		wait = c.backoff(attempt + 1)
+		attemptStart := time.Now()
+		fail := func(err error) {
+			lastError = err
+			failures = append(failures, fmt.Sprintf("attempt %d: %v after %v", attempt+1, err, time.Since(attemptStart).Round(time.Millisecond)))
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, "", fmt.Errorf("error creating request: %w", err)
+		}
+
+		req.Header.Set("User-Agent", userAgent)
+		req.Header.Set("Accept-Encoding", "gzip, deflate")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if c.config.AcceptLanguage != "" {
+			req.Header.Set("Accept-Language", c.config.AcceptLanguage)
+		}
+		if c.config.SessionCookie != "" {
+			req.Header.Set("Cookie", c.config.SessionCookie)
+		}
+		cache.setConditionalHeaders(req)
+
+		release, err := c.hosts.acquire(ctx, req.URL.Host)
+		if err != nil {
+			return nil, "", fmt.Errorf("request canceled: %w", err)
+		}
+		resp, err := c.client.Do(req)
+		if err != nil {
+			release()
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, "", fmt.Errorf("request canceled: %w", ctxErr)
+			}
+			fail(fmt.Errorf("error making request: %w", requestError(err)))
+			continue
+		}
+
+		body, readErr := io.ReadAll(resp.Body)
+		closeErr := resp.Body.Close()
+		release()
+		if readErr != nil {
+			fail(fmt.Errorf("error reading response body: %w", requestError(readErr)))
+			continue
+		}
+		if closeErr != nil {
+			fail(fmt.Errorf("error closing response body: %w", closeErr))
+			continue
+		}
+
+		c.logger.Verbosef("Received %d bytes with status %d from %s, content type %q\n", len(body), resp.StatusCode, url, resp.Header.Get("Content-Type"))
+
+		if resp.StatusCode == http.StatusNotModified && cache != nil {
+			return nil, "", ErrUnchanged
+		}
+		if resp.StatusCode != http.StatusOK {
+			fail(&StatusError{StatusCode: resp.StatusCode})
+			if !shouldRetryStatus(resp.StatusCode) {
+				c.logFailedAttempts(url, failures)
+				return nil, "", lastError
+			}
+			if requested, ok := retryAfter(resp, time.Now()); ok {
+				wait = c.capBackoff(requested)
+			}
+			continue
+		}
+
+		decoded, err := decodeContentEncoding(resp.Header.Get("Content-Encoding"), body)
+		if err != nil {
+			fail(fmt.Errorf("error decoding response body: %w", err))
+			continue
+		}
+		cache.recordValidators(resp)
+		return decoded, resp.Header.Get("Content-Type"), nil
+	}
+
+	c.logFailedAttempts(url, failures)
+	return nil, "", fmt.Errorf("all retry attempts failed: %w", lastError)
+}
+
+// logFailedAttempts logs the outcome of each attempt of a request that
+// failed, when there was more than one
+func (c *Converter) logFailedAttempts(url string, failures []string) {
+	if len(failures) < 2 {
+		return
+	}
+	c.logger.Printf("Request to %s failed after %d attempts:\n  %s\n", url, len(failures), strings.Join(failures, "\n  "))
+}
+
+// decodeContentEncoding decompresses a gzip or deflate encoded response body.
+// Go's transport only decompresses gzip on its own when the request doesn't
+// set Accept-Encoding, so with the header set explicitly it is done here.
+func decodeContentEncoding(encoding string, body []byte) ([]byte, error) {
+	var reader io.ReadCloser
+	var err error
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		reader, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		// deflate should be zlib-wrapped, but some servers send raw deflate
+		reader, err = zlib.NewReader(bytes.NewReader(body))
+		if errors.Is(err, zlib.ErrHeader) {
+			reader, err = flate.NewReader(bytes.NewReader(body)), nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing %s body: %w", encoding, err)
+	}
+	return decoded, nil
+}
+
+func shouldRetryStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+func sleepWithContext(ctx context.Context, duration time.Duration) error {
+	if duration <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Convert downloads a tour and writes it to the outputPath destination in
+// the configured output format
+func (c *Converter) Convert(ctx context.Context, url, outputPath string) error {
+	cache := c.openTourCache(url, outputPath)
+	komootResp, err := c.fetchCachedTour(ctx, url, cache)
+	if errors.Is(err, ErrUnchanged) {
+		c.logger.Printf("Tour unchanged since the last run, skipping %s\n", url)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	written, err := c.convertTour(ctx, komootResp, outputPath)
+	if err != nil {
+		return err
+	}
+	c.saveTourCache(cache, written)
+	return nil
+}
+
+// ConvertToWriter downloads a tour and writes it to w in the configured
+// output format, without touching the file system. SplitDistance is ignored
+// since all output goes to w.
+func (c *Converter) ConvertToWriter(ctx context.Context, url string, w io.Writer) error {
+	komootResp, err := c.fetchTour(ctx, url)
+	if err != nil {
+		return err
+	}
+
+	gpx, err := c.buildGPX(ctx, komootResp)
+	if err != nil {
+		return err
+	}
+
+	encode, err := c.encoder(c.config.Format)
+	if err != nil {
+		return err
+	}
+	if err := encode(gpx, contextWriter{ctx: ctx, w: w}); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+
+	return nil
+}
+
+// FetchGPX downloads a tour and converts it to GPX in memory, without the
+// optional transformations or writing any output
+func (c *Converter) FetchGPX(ctx context.Context, url string) (*GPX, error) {
+	komootResp, err := c.fetchTour(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	gpx, err := c.jsonToGPX(komootResp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert to GPX: %w", err)
+	}
+	c.reporter.OnParsed(gpx.pointCount())
+	return gpx, nil
+}
+
+// ConvertFromHTML converts an already downloaded Komoot tour page to a GPX
+// file, skipping the HTTP request
+func (c *Converter) ConvertFromHTML(ctx context.Context, html, outputPath string) error {
+	komootResp, err := c.parseTourPage([]byte(html))
+	if err != nil {
+		return err
+	}
+
+	_, err = c.convertTour(ctx, komootResp, outputPath)
+	return err
+}
+
+// ConvertGPX reads an existing GPX document from r, applies the configured
+// transformations and writes it to the outputPath destination in the
+// configured output format. Options that need Komoot data, such as
+// waypoints, keywords and the metadata time, don't apply.
+func (c *Converter) ConvertGPX(ctx context.Context, r io.Reader, outputPath string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("conversion canceled: %w", err)
+	}
+
+	gpx, err := ReadGPX(r)
+	if err != nil {
+		return fmt.Errorf("failed to read GPX input: %w", err)
+	}
+	if len(gpx.allPoints()) == 0 {
+		return fmt.Errorf("no track points found in GPX input")
+	}
+	implausible := 0
+	gpx.eachPoint(func(p *Point) {
+		if !p.plausibleElevation() {
+			implausible++
+		}
+	})
+	if implausible > 0 {
+		c.logger.Printf("Warning: %d elevations outside %d to %d m, kept as they are\n", implausible, minElevation, maxElevation)
+	}
+	c.reporter.OnParsed(gpx.pointCount())
+
+	name := c.config.Name
+	if name != "" {
+		if gpx.Metadata == nil {
+			gpx.Metadata = &Metadata{}
+		}
+		gpx.Metadata.Name = name
+		for i := range gpx.Tracks {
+			gpx.Tracks[i].Name = name
+		}
+	} else if gpx.Metadata != nil && gpx.Metadata.Name != "" {
+		name = gpx.Metadata.Name
+	} else if len(gpx.Tracks) > 0 && gpx.Tracks[0].Name != "" {
+		name = gpx.Tracks[0].Name
+	} else {
+		name = "GPX input"
+	}
+
+	var recorded *time.Time
+	if gpx.Metadata != nil {
+		recorded = gpx.Metadata.Time
+	}
+
+	if gpx, err = c.processGPX(gpx, 0); err != nil {
+		return err
+	}
+	_, err = c.writeTours(ctx, gpx, name, recorded, outputPath)
+	return err
+}
+
+// parseTourPage extracts and decodes the tour data embedded in a tour page
+func (c *Converter) parseTourPage(html []byte) (*KomootResponse, error) {
+	c.logger.Println("Extracting JSON data from HTML")
+	jsonData, marker, err := extractBootProps(html, c.config.PayloadDecoders...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract JSON data: %w", err)
+	}
+	c.logger.Printf("Found tour data using the %s decoder\n", marker)
+
+	var komootResp KomootResponse
+	if err := json.Unmarshal(jsonData, &komootResp); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON data: %w", err)
+	}
+
+	return &komootResp, nil
+}
+
+// buildGPX converts decoded tour data to GPX and applies the configured
+// transformations, ready to be encoded
+func (c *Converter) buildGPX(ctx context.Context, komootResp *KomootResponse) (*GPX, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("conversion canceled: %w", err)
+	}
+
+	gpx, err := c.jsonToGPX(komootResp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert to GPX: %w", err)
+	}
+	c.reporter.OnParsed(gpx.pointCount())
+	if err := c.checkReportedDistance(gpx, komootResp.Page.Embedded.Tour.Distance); err != nil {
+		return nil, err
+	}
+
+	return c.processGPX(gpx, komootResp.Page.Embedded.Tour.Distance)
+}
+
+// processGPX logs the track statistics and applies the configured
+// transformations to gpx. reportedDistance is the distance Komoot gives for
+// the tour in meters, or 0 when unknown.
+func (c *Converter) processGPX(gpx *GPX, reportedDistance float64) (*GPX, error) {
+	if c.config.ClipBounds != nil {
+		gpx = gpx.ClipToBounds(*c.config.ClipBounds)
+		if gpx.pointCount() == 0 {
+			return nil, fmt.Errorf("no track points inside the bounding box")
+		}
+		c.logger.Verbosef("Clipped track to %d points\n", gpx.pointCount())
+	}
+
+	c.logger.Verbosef("Track distance: %.2f km, %.2f km with elevation\n", gpx.TotalDistance(DistanceOptions{})/1000, gpx.TotalDistance3D()/1000)
+	gain, loss := gpx.ElevationStats(c.config.ElevationThreshold)
+	c.logger.Verbosef("Elevation gain: %.0f m, loss: %.0f m\n", gain, loss)
+
+	c.transformGPX(gpx, reportedDistance)
+
+	if c.config.MaxPoints > 0 {
+		gpx = c.fitToMaxPoints(gpx)
+	}
+	if c.config.TargetSize > 0 {
+		var err error
+		if gpx, err = c.fitToTargetSize(gpx); err != nil {
+			return nil, fmt.Errorf("failed to fit target size: %w", err)
+		}
+	}
+	gpx.setBounds()
+
+	return gpx, nil
+}
+
+// convertTour converts decoded tour data and writes it to the outputPath
+// destination, or to numbered destinations when splitting by distance. It
+// returns the destinations written.
+func (c *Converter) convertTour(ctx context.Context, komootResp *KomootResponse, outputPath string) ([]string, error) {
+	gpx, err := c.buildGPX(ctx, komootResp)
+	if err != nil {
+		return nil, err
+	}
+
+	tour := &komootResp.Page.Embedded.Tour
+	name := tour.Name
+	if name == "" {
+		name = "tour " + string(tour.ID)
+	}
+	var recorded *time.Time
+	if date, ok := parseTourDate(tour.Date); ok {
+		recorded = &date
+	}
+	return c.writeTours(ctx, gpx, name, recorded, outputPath)
+}
+
+// writeTours writes a converted tour to the outputPath destination, or to
+// numbered destinations when splitting by distance, and returns the
+// destinations written. name identifies the tour in the dry run summary and
+// recorded is when it was recorded, if known.
+func (c *Converter) writeTours(ctx context.Context, gpx *GPX, name string, recorded *time.Time, outputPath string) ([]string, error) {
+	if c.config.DryRun {
+		c.logger.Printf("Dry run: %s, %d points, %.2f km\n", name, len(gpx.allPoints()), gpx.TotalDistance(c.config.Distance)/1000)
+		return nil, nil
+	}
+
+	if c.config.SplitDistance <= 0 {
+		if err := c.writeTour(ctx, gpx, recorded, outputPath); err != nil {
+			return nil, err
+		}
+		return []string{outputPath}, nil
+	}
+
+	if c.config.PreviewTolerance > 0 || len(c.config.ElevationBands) > 0 {
+		return nil, errors.New("splitting by distance would cut apart the preview or elevation band tracks")
+	}
+	chunks := gpx.SplitByDistance(c.config.SplitDistance)
+	c.logger.Printf("Split tour into %d parts of about %g km\n", len(chunks), c.config.SplitDistance)
+	written := make([]string, 0, len(chunks))
+	for i, chunk := range chunks {
+		chunkPath := numberedPath(outputPath, i+1)
+		if err := c.writeTour(ctx, chunk, recorded, chunkPath); err != nil {
+			return written, err
+		}
+		written = append(written, chunkPath)
+	}
+	return written, nil
+}
+
+// writeTour writes a converted tour to the outputPath destination, then
+// verifies it and sets its modification time as configured
+func (c *Converter) writeTour(ctx context.Context, gpx *GPX, recorded *time.Time, outputPath string) error {
+	if err := c.writeOutput(ctx, gpx, outputPath); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+
+	filename, isFile := localFile(outputPath)
+	if !isFile && (c.config.VerifyRoundTrip || c.config.SetModTime) {
+		c.logger.Println("Output is not a local file, skipping round-trip check and modification time")
+	}
+
+	if c.config.VerifyRoundTrip && isFile {
+		if err := verifyRoundTrip(gpx, filename); err != nil {
+			return fmt.Errorf("round-trip verification failed: %w", err)
+		}
+		c.logger.Println("Verified GPX file round-trips to the converted points")
+	}
+
+	if c.config.SetModTime && isFile {
+		if recorded != nil {
+			if err := os.Chtimes(filename, *recorded, *recorded); err != nil {
+				return fmt.Errorf("failed to set GPX file modification time: %w", err)
+			}
+		} else {
+			c.logger.Println("Tour date unavailable, keeping current modification time")
+		}
+	}
+
+	c.reporter.OnWritten(outputPath)
+	return nil
+}
+
+// ErrNoCoordinates is matched by the error for tour data without any usable
+// coordinates
+var ErrNoCoordinates = errors.New("no coordinates in tour data")
+
+// coordinatesError is an ErrNoCoordinates error with a more specific message
+type coordinatesError string
+
+func (e coordinatesError) Error() string { return string(e) }
+
+func (e coordinatesError) Unwrap() error { return ErrNoCoordinates }
+
+// jsonToGPX converts JSON data to GPX format
+func (c *Converter) jsonToGPX(data *KomootResponse) (*GPX, error) {
+	if data.Page.Embedded.Tour.Embedded.Coordinates == nil {
+		return nil, coordinatesError("coordinates missing in tour data")
+	}
+
+	tourName := data.Page.Embedded.Tour.Name
+	if c.config.Name != "" {
+		tourName = c.config.Name
+	}
+	coordinates := data.Page.Embedded.Tour.Embedded.Coordinates.Items
+	if len(coordinates) == 0 {
+		return nil, coordinatesError("no coordinates found in tour data")
+	}
+
+	gpx := &GPX{
+		XMLNS:          GPXNamespace,
+		XMLNSXSI:       XSINamespace,
+		SchemaLocation: GPXSchemaLocation,
+		Version:        "1.1",
+		Creator:        creator,
+		Tracks: []Track{
+			{
+				Name: tourName,
+				Type: data.Page.Embedded.Tour.Sport,
+				Segments: []Segment{
+					{Points: make([]Point, 0, len(coordinates))},
+				},
+			},
+		},
+	}
+	metadataTime, err := c.metadataTime(data)
+	if err != nil {
+		return nil, err
+	}
+	keywords := c.keywords(data)
+	var extensions *MetadataExtensions
+	if tourID := data.Page.Embedded.Tour.ID; tourID != "" {
+		extensions = &MetadataExtensions{TourID: string(tourID)}
+	}
+	if c.config.EmitLocalOffset {
+		if offset, ok := tourUTCOffset(data.Page.Embedded.Tour.Date); ok {
+			if extensions == nil {
+				extensions = &MetadataExtensions{}
+			}
+			extensions.LocalOffset = offset
+		}
+	}
+	desc := tourSummary(&data.Page.Embedded.Tour)
+	if tourName != "" || desc != "" || metadataTime != nil || keywords != "" || extensions != nil {
+		gpx.Metadata = &Metadata{Name: tourName, Desc: desc, Time: metadataTime, Keywords: keywords, Extensions: extensions}
+	}
+
+	start, hasStart := parseTourDate(data.Page.Embedded.Tour.Date)
+
+	incomplete, implausible := 0, 0
+	sectionStarts := c.sectionStarts(&data.Page.Embedded.Tour)
+	newSection := false
+	for i, item := range coordinates {
+		newSection = newSection || sectionStarts[i]
+		if item.Lat == nil || item.Lng == nil {
+			incomplete++
+			continue
+		}
+
+		point := Point{Lat: *item.Lat, Lon: *item.Lng, NoElevation: item.Alt == nil}
+		if item.Alt != nil {
+			point.Elevation = *item.Alt
+		}
+		if hasStart && item.T != nil {
+			pointTime := start.Add(time.Duration(*item.T * float64(time.Millisecond)))
+			point.Time = &pointTime
+		}
+
+		if err := point.validateCoordinates(); err != nil {
+			return nil, fmt.Errorf("invalid point data: %w", err)
+		}
+		if point.dropImplausibleElevation() {
+			implausible++
+		}
+
+		segments := &gpx.Tracks[0].Segments
+		current := &(*segments)[len(*segments)-1]
+		current.Points = append(current.Points, point)
+		if newSection && len(current.Points) > 1 {
+			*segments = append(*segments, Segment{Points: []Point{point}})
+		}
+		newSection = false
+	}
+
+	if incomplete > 0 {
+		c.logger.Printf("Skipped %d coordinate items missing lat or lng\n", incomplete)
+	}
+	c.warnImplausibleElevations(implausible)
+	if len(gpx.Tracks[0].Segments[0].Points) == 0 {
+		return nil, coordinatesError("no complete coordinates found in tour data")
+	}
+
+	if !c.config.SkipWaypoints {
+		gpx.Waypoints = highlightWaypoints(&data.Page.Embedded.Tour, c.config.WaypointSymbols)
+	}
+	gpx.setBounds()
+
+	return gpx, nil
+}
+
+// Bounds returns the bounding box of all track points and waypoints. ok is
+// false when there are none.
+func (g *GPX) Bounds() (minLat, minLon, maxLat, maxLon float64, ok bool) {
+	extend := func(p *Point) {
+		if !ok {
+			minLat, minLon, maxLat, maxLon, ok = p.Lat, p.Lon, p.Lat, p.Lon, true
+			return
+		}
+		minLat, maxLat = min(minLat, p.Lat), max(maxLat, p.Lat)
+		minLon, maxLon = min(minLon, p.Lon), max(maxLon, p.Lon)
+	}
+	g.eachPoint(extend)
+	for _, waypoint := range g.Waypoints {
+		extend(&Point{Lat: waypoint.Lat, Lon: waypoint.Lon})
+	}
+	return minLat, minLon, maxLat, maxLon, ok
+}
+
+// TimeRange returns the earliest and latest track point times. ok is false
+// when no point has a time.
+func (g *GPX) TimeRange() (start, end time.Time, ok bool) {
+	g.eachPoint(func(p *Point) {
+		if p.Time == nil {
+			return
+		}
+		if !ok {
+			start, end, ok = *p.Time, *p.Time, true
+			return
+		}
+		if p.Time.Before(start) {
+			start = *p.Time
+		}
+		if p.Time.After(end) {
+			end = *p.Time
+		}
+	})
+	return start, end, ok
+}
+
+// setBounds stores the bounding box of the points in the metadata, or removes
+// a stale one when there are no points
+func (g *GPX) setBounds() {
+	minLat, minLon, maxLat, maxLon, ok := g.Bounds()
+	if !ok {
+		if g.Metadata != nil {
+			g.Metadata.Bounds = nil
+		}
+		return
+	}
+	if g.Metadata == nil {
+		g.Metadata = &Metadata{}
+	}
+	g.Metadata.Bounds = &Bounds{MinLat: minLat, MinLon: minLon, MaxLat: maxLat, MaxLon: maxLon}
+}
+
+// sectionStarts returns the coordinate indexes at which a new surface section
+// starts when SegmentBySurface is set, or nil
+func (c *Converter) sectionStarts(tour *KomootTour) map[int]bool {
+	if !c.config.SegmentBySurface || tour.Embedded.Surfaces == nil {
+		return nil
+	}
+
+	starts := make(map[int]bool)
+	for _, section := range tour.Embedded.Surfaces.Items {
+		if section.From > 0 {
+			starts[section.From] = true
+		}
+	}
+	return starts
+}
+
+// highlightWaypoints converts the tour's highlights to waypoints, skipping
+// those without a valid location. Categories are looked up in symbols before
+// highlightSymbols.
+func highlightWaypoints(tour *KomootTour, symbols map[string]string) []Waypoint {
+	if tour.Embedded.Highlights == nil {
+		return nil
+	}
+
+	var waypoints []Waypoint
+	for _, highlight := range tour.Embedded.Highlights.Items {
+		location := highlight.MidPoint
+		if location == nil || location.Lat == nil || location.Lng == nil {
+			continue
+		}
+		if (Point{Lat: *location.Lat, Lon: *location.Lng}).Validate() != nil {
+			continue
+		}
+		waypoint := Waypoint{
+			Lat:         *location.Lat,
+			Lon:         *location.Lng,
+			Name:        highlight.Name,
+			Description: highlight.Description,
+			Symbol:      waypointSymbol(highlight.Category, symbols),
+			Type:        highlight.Category,
+		}
+		if location.Alt != nil {
+			waypoint.Elevation = *location.Alt
+		}
+		waypoints = append(waypoints, waypoint)
+	}
+	return waypoints
+}
+
+// transformGPX applies the configured optional transformations to a converted
+// track. reportedDistance is the tour length Komoot reports, zero if unknown.
+func (c *Converter) transformGPX(gpx *GPX, reportedDistance float64) {
+	if c.config.DedupeConsecutive {
+		removed := gpx.DedupeConsecutive(false)
+		c.logger.Verbosef("Removed %d duplicate points\n", removed)
+	}
+	if c.config.InterpolateElevation {
+		filled := gpx.InterpolateElevation()
+		c.logger.Verbosef("Interpolated the elevation of %d points\n", filled)
+	}
+	if c.config.CloseLoop && gpx.IsLoop(c.config.LoopThreshold) {
+		c.logger.Println("Closing loop tour")
+		gpx.CloseLoop()
+	}
+	if c.config.EmitCumulativeElevation {
+		gpx.addCumulativeElevation(c.config.ElevationThreshold)
+	}
+	if c.config.EmitSpeed && !gpx.addSpeed() {
+		c.logger.Verbosef("Tour has no point times, not writing speeds\n")
+	}
+	c.recordDistance(gpx, reportedDistance)
+	if c.config.SimplifyTolerance > 0 {
+		removed := gpx.Simplify(c.config.SimplifyTolerance)
+		c.logger.Verbosef("Simplification removed %d points\n", removed)
+	}
+	if c.config.DownsampleEvery > 1 {
+		gpx.downsample(c.config.DownsampleEvery)
+	}
+	if c.config.PreviewTolerance > 0 {
+		gpx.addPreviewTrack(c.config.PreviewTolerance)
+	}
+	if len(c.config.ElevationBands) > 0 {
+		gpx.splitByElevationBands(c.config.ElevationBands)
+	}
+	if c.config.SegmentSize > 0 {
+		gpx.chunkSegments(c.config.SegmentSize)
+	}
+	if c.config.StripElevation {
+		gpx.StripElevation()
+	}
+}
+
+// fitToTargetSize simplifies the track until the encoded output fits in the
+// configured target size, warning when that isn't achievable
+func (c *Converter) fitToTargetSize(gpx *GPX) (*GPX, error) {
+	encode, err := c.encoder(c.config.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	fitted, tolerance, size, fits, err := fitToSize(gpx, c.config.TargetSize, encode)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case !fits:
+		c.logger.Printf("Warning: target size of %d bytes is unachievable, smallest output is %d bytes\n", c.config.TargetSize, size)
+	case tolerance > 0:
+		c.logger.Printf("Simplified with %.2f m tolerance to %d points, %d bytes\n", tolerance, len(fitted.allPoints()), size)
+	}
+	return fitted, nil
+}
+
+// fitToMaxPoints simplifies the track until it has at most the configured
+// number of points, warning when that isn't achievable
+func (c *Converter) fitToMaxPoints(gpx *GPX) *GPX {
+	fitted, tolerance, count, fits := fitToPointCount(gpx, c.config.MaxPoints)
+	switch {
+	case !fits:
+		c.logger.Printf("Warning: limit of %d points is unachievable, the most simplified track has %d\n", c.config.MaxPoints, count)
+	case tolerance > 0:
+		c.logger.Printf("Simplified with %.2f m tolerance to %d points\n", tolerance, count)
+	default:
+		c.logger.Verbosef("Track has %d points, within the limit of %d\n", count, c.config.MaxPoints)
+	}
+	return fitted
+}
+
+// metadataTime returns the timestamp for <metadata><time> according to the
+// configured mode, or nil when no time should be written
+func (c *Converter) metadataTime(data *KomootResponse) (*time.Time, error) {
+	switch c.config.MetadataTime {
+	case MetadataTimeRecord, "":
+		recorded, ok := parseTourDate(data.Page.Embedded.Tour.Date)
+		if !ok {
+			return nil, nil
+		}
+		return &recorded, nil
+	case MetadataTimeNow:
+		now := time.Now().UTC().Truncate(time.Second)
+		return &now, nil
+	case MetadataTimeNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown metadata time mode: %q", c.config.MetadataTime)
+	}
+}
+
+// keywords joins the tour's sport type, its difficulty grade as
+// difficulty:<grade> and the configured keywords into the comma-separated
+// <metadata><keywords> value, skipping blanks and duplicates
+func (c *Converter) keywords(data *KomootResponse) string {
+	tour := &data.Page.Embedded.Tour
+	candidates := []string{tour.Sport}
+	if tour.Difficulty != nil && tour.Difficulty.Grade != "" {
+		candidates = append(candidates, "difficulty:"+tour.Difficulty.Grade)
+	}
+	candidates = append(candidates, c.config.Keywords...)
+	seen := make(map[string]bool, len(candidates))
+	keywords := make([]string, 0, len(candidates))
+	for _, keyword := range candidates {
+		keyword = strings.TrimSpace(keyword)
+		if keyword == "" || seen[keyword] {
+			continue
+		}
+		seen[keyword] = true
+		keywords = append(keywords, keyword)
+	}
+	return strings.Join(keywords, ",")
+}
+
+// tourSummary describes the distance, duration, elevation and difficulty
+// Komoot reports for the tour, e.g. "Distance: 42.2 km, duration: 3h 05m,
+// difficulty: moderate", leaving out missing values
+func tourSummary(tour *KomootTour) string {
+	var parts []string
+	if tour.Distance > 0 {
+		parts = append(parts, fmt.Sprintf("Distance: %.1f km", tour.Distance/1000))
+	}
+	if tour.Duration > 0 {
+		duration := time.Duration(tour.Duration) * time.Second
+		parts = append(parts, fmt.Sprintf("duration: %dh %02dm", int(duration.Hours()), int(duration.Minutes())%60))
+	}
+	if tour.ElevationUp > 0 || tour.ElevationDown > 0 {
+		parts = append(parts, fmt.Sprintf("elevation: up %.0f m, down %.0f m", tour.ElevationUp, tour.ElevationDown))
+	}
+	if difficulty := tour.Difficulty; difficulty != nil && difficulty.Grade != "" {
+		part := "difficulty: " + difficulty.Grade
+		var requirements []string
+		if difficulty.ExplanationTechnical != "" {
+			requirements = append(requirements, "technical "+difficulty.ExplanationTechnical)
+		}
+		if difficulty.ExplanationFitness != "" {
+			requirements = append(requirements, "fitness "+difficulty.ExplanationFitness)
+		}
+		if len(requirements) > 0 {
+			part += " (" + strings.Join(requirements, ", ") + ")"
+		}
+		parts = append(parts, part)
+	}
+	if tour.Constitution > 0 {
+		parts = append(parts, fmt.Sprintf("fitness level: %d/5", tour.Constitution))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	parts[0] = strings.ToUpper(parts[0][:1]) + parts[0][1:]
+	return strings.Join(parts, ", ")
+}
+
+// parseTourDate parses the tour date from Komoot's JSON into UTC. GPX
+// requires UTC times, so the local offset Komoot reports is applied here.
+func parseTourDate(date string) (time.Time, bool) {
+	parsed, ok := parseTourLocalDate(date)
+	if !ok {
+		return time.Time{}, false
+	}
+	return parsed.UTC(), true
+}
+
+// tourUTCOffset returns the UTC offset of the tour date, e.g. +02:00
+func tourUTCOffset(date string) (string, bool) {
+	parsed, ok := parseTourLocalDate(date)
+	if !ok {
+		return "", false
+	}
+	return parsed.Format("-07:00"), true
+}
+
+// parseTourLocalDate parses the tour date keeping the offset Komoot reported
+func parseTourLocalDate(date string) (time.Time, bool) {
+	if date == "" {
+		return time.Time{}, false
+	}
+	parsed, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return parsed, true
+}
+
+// Output formats
+const (
+	FormatGPX        = "gpx"
+	FormatSVGProfile = "svg-profile"
+	FormatHTML       = "html"
+	FormatProtobuf   = "pb"
+	FormatKML        = "kml"
+	FormatCSV        = "csv"
+	FormatGeoJSON    = "geojson"
+	FormatTCX        = "tcx"
+	FormatPolyline   = "polyline"
+)
+
+// OutputFormats lists the supported output formats
+var OutputFormats = []string{FormatGPX, FormatSVGProfile, FormatHTML, FormatProtobuf, FormatKML, FormatCSV, FormatGeoJSON, FormatTCX, FormatPolyline}
+
+// encoder returns the function encoding a GPX in the given output format
+func (c *Converter) encoder(format string) (func(gpx *GPX, w io.Writer) error, error) {
+	switch format {
+	case FormatGPX, "":
+		return func(gpx *GPX, w io.Writer) error {
+			return encodeGPXIndented(gpx, w, c.config.Indent)
+		}, nil
+	case FormatSVGProfile:
+		return writeElevationSVG, nil
+	case FormatHTML:
+		return func(gpx *GPX, w io.Writer) error {
+			return writeHTMLViewer(gpx, w, c.config.LeafletURL, c.config.TileURL)
+		}, nil
+	case FormatProtobuf:
+		return writeProtobuf, nil
+	case FormatKML:
+		return func(gpx *GPX, w io.Writer) error {
+			return writeKML(gpx, w, c.config.Indent)
+		}, nil
+	case FormatCSV:
+		return writeCSV, nil
+	case FormatGeoJSON:
+		return func(gpx *GPX, w io.Writer) error {
+			return writeGeoJSON(gpx, w, c.config.Indent)
+		}, nil
+	case FormatTCX:
+		return func(gpx *GPX, w io.Writer) error {
+			return writeTCX(gpx, w, c.config.Indent)
+		}, nil
+	case FormatPolyline:
+		return func(gpx *GPX, w io.Writer) error {
+			return writePolyline(gpx, w, c.config.PolylinePrecision)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format: %q", format)
+	}
+}
+
+// writeOutput writes the GPX to destination in the configured output format,
+// stopping when ctx is canceled
+func (c *Converter) writeOutput(ctx context.Context, gpx *GPX, destination string) error {
+	encode, err := c.encoder(c.config.Format)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return c.writeTo(destination, func(w io.Writer) error {
+		return encode(gpx, contextWriter{ctx: ctx, w: w})
+	})
+}
+
+// encodeGPXIndented writes the XML header and the GPX document to w, with
+// indent per nesting level or compact when indent is empty. The header keeps
+// its trailing newline either way.
+func encodeGPXIndented(gpx *GPX, w io.Writer, indent string) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("error writing XML header: %w", err)
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", indent)
+	if err := encoder.Encode(gpx); err != nil {
+		return fmt.Errorf("error encoding GPX: %w", err)
+	}
+
+	return nil
+}
+
+// contentQueryParams are the only query parameters kept by ResolveTourURL.
+// share_token grants access to tours shared by link; everything else Komoot
+// appends (ref, utm_*, ...) is tracking that doesn't change the page.
+var contentQueryParams = []string{"share_token"}
+
+// ResolveTourURL normalizes a tour URL into a canonical form: lowercase scheme
+// and host, no fragment, no trailing slash and no query parameters other
+// than contentQueryParams
+func ResolveTourURL(urlString string) (string, error) {
+	parsedURL, err := url.Parse(strings.TrimSpace(urlString))
+	if err != nil {
+		return "", fmt.Errorf("error parsing URL: %w", err)
+	}
+
+	parsedURL.Scheme = strings.ToLower(parsedURL.Scheme)
+	parsedURL.Host = strings.ToLower(parsedURL.Host)
+	parsedURL.Fragment = ""
+	parsedURL.RawFragment = ""
+	parsedURL.Path = strings.TrimRight(parsedURL.Path, "/")
+	parsedURL.RawPath = ""
+
+	query := parsedURL.Query()
+	kept := url.Values{}
+	for _, param := range contentQueryParams {
+		if values, ok := query[param]; ok {
+			kept[param] = values
+		}
+	}
+	parsedURL.RawQuery = kept.Encode()
+
+	return parsedURL.String(), nil
+}
@@ -0,0 +1,1602 @@
+package gokomoot
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const capturedKomootFixture = "testdata/komoot_public_smarttour_33303609.json"
+
+func TestCapturedKomootFixtureConvertsToGPX(t *testing.T) {
+	content, err := os.ReadFile(capturedKomootFixture)
+	if err != nil {
+		t.Fatalf("os.ReadFile(%q) error = %v", capturedKomootFixture, err)
+	}
+
+	var response KomootResponse
+	if err := json.Unmarshal(content, &response); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	gpx, err := NewConverter(DefaultConfig()).jsonToGPX(&response)
+	if err != nil {
+		t.Fatalf("jsonToGPX() error = %v", err)
+	}
+
+	if gpx.Metadata == nil || !strings.Contains(gpx.Metadata.Name, "Olympia-Stadion") {
+		t.Fatalf("metadata name = %#v, want captured public tour name", gpx.Metadata)
+	}
+
+	points := gpx.Tracks[0].Segments[0].Points
+	if len(points) != 2044 {
+		t.Fatalf("captured fixture point count = %d, want 2044", len(points))
+	}
+	if points[0] != (Point{Lat: 52.516839, Lon: 13.25041, Elevation: 50.4}) {
+		t.Fatalf("first point = %#v, want captured fixture start point", points[0])
+	}
+	if points[len(points)-1] != (Point{Lat: 52.516839, Lon: 13.25041, Elevation: 50.4}) {
+		t.Fatalf("last point = %#v, want captured fixture end point", points[len(points)-1])
+	}
+}
+
+// tourFixtures are saved Komoot tour pages in testdata/tours, converted by
+// TestConvertTourFixturesMatchGolden and compared to the GPX file of the same
+// name. Run go test -update to rewrite the GPX files.
+var tourFixtures = []struct {
+	name    string
+	wantErr error
+}{
+	{name: "loop"},
+	{name: "special_chars"},
+	{name: "zero_coordinates", wantErr: ErrNoCoordinates},
+}
+
+func TestConvertTourFixturesMatchGolden(t *testing.T) {
+	for _, tt := range tourFixtures {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := os.ReadFile(filepath.Join("testdata", "tours", tt.name+".html"))
+			if err != nil {
+				t.Fatalf("os.ReadFile() error = %v", err)
+			}
+			jsonData, err := extractJSONFromHTML(page)
+			if err != nil {
+				t.Fatalf("extractJSONFromHTML() error = %v", err)
+			}
+			var response KomootResponse
+			if err := json.Unmarshal(jsonData, &response); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+
+			gpx, err := NewConverter(DefaultConfig()).jsonToGPX(&response)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("jsonToGPX() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("jsonToGPX() error = %v", err)
+			}
+			outputPath := filepath.Join(t.TempDir(), tt.name+".gpx")
+			if err := NewConverter(DefaultConfig()).writeOutput(context.Background(), gpx, outputPath); err != nil {
+				t.Fatalf("writeOutput() error = %v", err)
+			}
+			got, err := os.ReadFile(outputPath)
+			if err != nil {
+				t.Fatalf("os.ReadFile(%q) error = %v", outputPath, err)
+			}
+
+			goldenFile := filepath.Join("testdata", "tours", tt.name+".gpx")
+			if *updateGolden {
+				if err := os.WriteFile(goldenFile, got, 0o644); err != nil {
+					t.Fatalf("os.WriteFile() error = %v", err)
+				}
+			}
+			want, err := os.ReadFile(goldenFile)
+			if err != nil {
+				t.Fatalf("os.ReadFile(%q) error = %v", goldenFile, err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("GPX output differs from %s:\n%s", goldenFile, got)
+			}
+		})
+	}
+}
+
+// encodeGPX writes the XML header and the GPX document indented by two
+// spaces to w, as Convert does with the default configuration
+func encodeGPX(gpx *GPX, w io.Writer) error {
+	return encodeGPXIndented(gpx, w, "  ")
+}
+
+// redirectingClient returns an HTTP client sending every request to server,
+// whatever host the request URL names
+func redirectingClient(server *httptest.Server) *http.Client {
+	target, _ := url.Parse(server.URL)
+	return &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		req = req.Clone(req.Context())
+		req.URL.Scheme, req.URL.Host = target.Scheme, target.Host
+		return server.Client().Transport.RoundTrip(req)
+	})}
+}
+
+func TestConvertGzippedTourPage(t *testing.T) {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	if _, err := io.WriteString(gz, capturedKomootHTML(t)); err != nil {
+		t.Fatalf("gzip Write() error = %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("gzip Close() error = %v", err)
+	}
+
+	var acceptEncoding string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding = r.Header.Get("Accept-Encoding")
+		w.Header().Set("Content-Encoding", "gzip")
+		_, _ = w.Write(compressed.Bytes())
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.HTTPClient = redirectingClient(server)
+	gpx, err := NewConverter(config).FetchGPX(context.Background(), "https://www.komoot.com/smarttour/33303609")
+	if err != nil {
+		t.Fatalf("FetchGPX() error = %v", err)
+	}
+	if !strings.Contains(acceptEncoding, "gzip") {
+		t.Fatalf("Accept-Encoding = %q, want gzip", acceptEncoding)
+	}
+	if points := gpx.allPoints(); len(points) != 2044 {
+		t.Fatalf("FetchGPX() returned %d points, want the 2044 captured points", len(points))
+	}
+}
+
+func TestDecodeContentEncoding(t *testing.T) {
+	want := "<html>tour page</html>"
+	var zlibBody, rawDeflateBody bytes.Buffer
+	zw := zlib.NewWriter(&zlibBody)
+	_, _ = io.WriteString(zw, want)
+	_ = zw.Close()
+	fw, _ := flate.NewWriter(&rawDeflateBody, flate.DefaultCompression)
+	_, _ = io.WriteString(fw, want)
+	_ = fw.Close()
+
+	for name, tt := range map[string]struct {
+		encoding string
+		body     []byte
+	}{
+		"identity":    {"", []byte(want)},
+		"zlib":        {"deflate", zlibBody.Bytes()},
+		"raw deflate": {"Deflate", rawDeflateBody.Bytes()},
+	} {
+		got, err := decodeContentEncoding(tt.encoding, tt.body)
+		if err != nil || string(got) != want {
+			t.Fatalf("%s: decodeContentEncoding() = %q, %v, want %q", name, got, err, want)
+		}
+	}
+
+	if _, err := decodeContentEncoding("br", []byte(want)); err == nil {
+		t.Fatal("decodeContentEncoding(br) error = nil, want unsupported encoding error")
+	}
+	if _, err := decodeContentEncoding("gzip", []byte(want)); err == nil {
+		t.Fatal("decodeContentEncoding(gzip) of plain text error = nil, want error")
+	}
+}
+
+func TestConvertCapturedTourPageWithInjectedClient(t *testing.T) {
+	content, err := os.ReadFile(capturedKomootFixture)
+	if err != nil {
+		t.Fatalf("os.ReadFile(%q) error = %v", capturedKomootFixture, err)
+	}
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		fmt.Fprint(w, tourPageHTML(t, string(content)))
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.HTTPClient = redirectingClient(server)
+	outputPath := filepath.Join(t.TempDir(), "route.gpx")
+	if err := NewConverter(config).Convert(context.Background(), "https://www.komoot.com/smarttour/33303609", outputPath); err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+
+	if len(requested) != 1 || requested[0] != "/smarttour/33303609" {
+		t.Fatalf("requested paths = %v, want only the tour page", requested)
+	}
+	file, err := os.Open(outputPath)
+	if err != nil {
+		t.Fatalf("os.Open() error = %v", err)
+	}
+	defer file.Close()
+	gpx, err := ReadGPX(file)
+	if err != nil {
+		t.Fatalf("ReadGPX() error = %v", err)
+	}
+	if gpx.Metadata == nil || !strings.Contains(gpx.Metadata.Name, "Olympia-Stadion") {
+		t.Fatalf("metadata name = %#v, want captured public tour name", gpx.Metadata)
+	}
+	if gpx.Metadata.Extensions == nil || gpx.Metadata.Extensions.TourID != "33303609" {
+		t.Fatalf("metadata extensions = %#v, want tour ID 33303609", gpx.Metadata.Extensions)
+	}
+	points := gpx.allPoints()
+	if len(points) != 2044 || points[0] != (Point{Lat: 52.516839, Lon: 13.25041, Elevation: 50.4}) {
+		t.Fatalf("read back %d points starting at %#v, want the 2044 captured points", len(points), points[0])
+	}
+}
+
+func TestConvertFallsBackToAPIWithInjectedClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v007/tours/42" {
+			http.Error(w, "page changed", http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"id":42,"name":"API Tour","_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35},{"lat":51.6,"lng":-0.13,"alt":40}]}}}`)
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.HTTPClient = redirectingClient(server)
+	config.MaxRetries = 1
+	config.Format = FormatCSV
+	var buf bytes.Buffer
+	if err := NewConverter(config).ConvertToWriter(context.Background(), "https://www.komoot.com/tour/42", &buf); err != nil {
+		t.Fatalf("ConvertToWriter() error = %v", err)
+	}
+
+	want := "lat,lon,ele,time\n51.5000000,-0.1200000,35,\n51.6000000,-0.1300000,40,\n"
+	if buf.String() != want {
+		t.Fatalf("ConvertToWriter() = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestLiveKomootConversion(t *testing.T) {
+	liveURL := os.Getenv("GOKOMOOT_INTEGRATION_URL")
+	if liveURL == "" {
+		t.Skip("set GOKOMOOT_INTEGRATION_URL to run live Komoot conversion test")
+	}
+
+	converter := NewConverter(DefaultConfig())
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	html, err := converter.makeHTTPRequest(ctx, liveURL)
+	if err != nil {
+		t.Fatalf("makeHTTPRequest() error = %v", err)
+	}
+
+	jsonData, err := extractJSONFromHTML(html)
+	if err != nil {
+		t.Fatalf("extractJSONFromHTML() error = %v", err)
+	}
+
+	var response KomootResponse
+	if err := json.Unmarshal(jsonData, &response); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	gpx, err := converter.jsonToGPX(&response)
+	if err != nil {
+		t.Fatalf("jsonToGPX() error = %v", err)
+	}
+
+	points := gpx.Tracks[0].Segments[0].Points
+	if len(points) == 0 {
+		t.Fatal("live conversion produced no GPX points")
+	}
+}
+
+func TestCaptureKomootFixture(t *testing.T) {
+	captureURL := os.Getenv("GOKOMOOT_CAPTURE_URL")
+	captureOut := os.Getenv("GOKOMOOT_CAPTURE_OUT")
+	if captureURL == "" || captureOut == "" {
+		t.Skip("set GOKOMOOT_CAPTURE_URL and GOKOMOOT_CAPTURE_OUT to refresh a captured fixture")
+	}
+
+	converter := NewConverter(DefaultConfig())
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	html, err := converter.makeHTTPRequest(ctx, captureURL)
+	if err != nil {
+		t.Fatalf("makeHTTPRequest() error = %v", err)
+	}
+
+	jsonData, err := extractJSONFromHTML(html)
+	if err != nil {
+		t.Fatalf("extractJSONFromHTML() error = %v", err)
+	}
+
+	var response KomootResponse
+	if err := json.Unmarshal(jsonData, &response); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if _, err := converter.jsonToGPX(&response); err != nil {
+		t.Fatalf("jsonToGPX() error = %v", err)
+	}
+
+	content, err := json.MarshalIndent(response, "", "  ")
+	if err != nil {
+		t.Fatalf("json.MarshalIndent() error = %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(captureOut), 0o755); err != nil {
+		t.Fatalf("os.MkdirAll() error = %v", err)
+	}
+	if err := os.WriteFile(captureOut, append(content, '\n'), 0o644); err != nil {
+		t.Fatalf("os.WriteFile() error = %v", err)
+	}
+}
+
+func TestExtractJSONFromHTML(t *testing.T) {
+	payload := `{"page":{"_embedded":{"tour":{"name":"Tour with \"); marker and &quot; text","_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35}]}}}}}}`
+	encodedPayload, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	got, err := extractJSONFromHTML([]byte(`<script>kmtBoot.setProps(` + string(encodedPayload) + `);</script>`))
+	if err != nil {
+		t.Fatalf("extractJSONFromHTML() error = %v", err)
+	}
+
+	if string(got) != payload {
+		t.Fatalf("extractJSONFromHTML() = %q, want %q", got, payload)
+	}
+}
+
+// capturedKomootHTML wraps the captured fixture JSON in a minimal tour page the
+// same way Komoot embeds it.
+func capturedKomootHTML(t *testing.T) string {
+	t.Helper()
+
+	content, err := os.ReadFile(capturedKomootFixture)
+	if err != nil {
+		t.Fatalf("os.ReadFile(%q) error = %v", capturedKomootFixture, err)
+	}
+	encodedPayload, err := json.Marshal(string(content))
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	return `<html><body><script>kmtBoot.setProps(` + string(encodedPayload) + `);</script></body></html>`
+}
+
+func TestConvertFromHTMLWritesGPX(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "route.gpx")
+	if err := NewConverter(DefaultConfig()).ConvertFromHTML(context.Background(), capturedKomootHTML(t), outputPath); err != nil {
+		t.Fatalf("ConvertFromHTML() error = %v", err)
+	}
+
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("os.ReadFile() error = %v", err)
+	}
+	if got := strings.Count(string(content), "<trkpt "); got != 2044 {
+		t.Fatalf("GPX track point count = %d, want 2044", got)
+	}
+	if !strings.Contains(string(content), `<trkpt lat="52.516839" lon="13.25041">`) {
+		t.Fatalf("GPX output missing fixture start point:\n%.500s", content)
+	}
+}
+
+func TestConvertToWriterStreamsGPX(t *testing.T) {
+	html := capturedKomootHTML(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, html)
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	if err := NewConverter(DefaultConfig()).ConvertToWriter(context.Background(), server.URL+"/smarttour/33303609", &buf); err != nil {
+		t.Fatalf("ConvertToWriter() error = %v", err)
+	}
+
+	content := buf.String()
+	if !strings.HasPrefix(content, xml.Header) || strings.Count(content, "<?xml") != 1 {
+		t.Fatalf("ConvertToWriter() output should start with exactly one XML header:\n%.200s", content)
+	}
+	if got := strings.Count(content, "<trkpt "); got != 2044 {
+		t.Fatalf("GPX track point count = %d, want 2044", got)
+	}
+}
+
+func TestConvertFromHTMLHonorsCanceledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	outputPath := filepath.Join(t.TempDir(), "route.gpx")
+	err := NewConverter(DefaultConfig()).ConvertFromHTML(ctx, capturedKomootHTML(t), outputPath)
+	if err == nil || !strings.Contains(err.Error(), "context canceled") {
+		t.Fatalf("ConvertFromHTML() error = %v, want context canceled", err)
+	}
+	if _, statErr := os.Stat(outputPath); !os.IsNotExist(statErr) {
+		t.Fatalf("os.Stat() error = %v, want output not written", statErr)
+	}
+}
+
+func TestConvertFromHTMLSetsModTimeToTourDate(t *testing.T) {
+	payload := `{"page":{"_embedded":{"tour":{"name":"Dated","date":"2021-06-05T09:30:00.000+02:00","_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35}]}}}}}}`
+	encodedPayload, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	config := DefaultConfig()
+	config.SetModTime = true
+	outputPath := filepath.Join(t.TempDir(), "route.gpx")
+	html := `<script>kmtBoot.setProps(` + string(encodedPayload) + `);</script>`
+	if err := NewConverter(config).ConvertFromHTML(context.Background(), html, outputPath); err != nil {
+		t.Fatalf("ConvertFromHTML() error = %v", err)
+	}
+
+	info, err := os.Stat(outputPath)
+	if err != nil {
+		t.Fatalf("os.Stat() error = %v", err)
+	}
+	want := time.Date(2021, 6, 5, 7, 30, 0, 0, time.UTC)
+	if !info.ModTime().Equal(want) {
+		t.Fatalf("modification time = %v, want %v", info.ModTime(), want)
+	}
+}
+
+func TestExtractJSONFromHTMLMissingMarker(t *testing.T) {
+	_, err := extractJSONFromHTML([]byte(`<script>window.boot = "{}";</script>`))
+	if !errors.Is(err, ErrMarkerNotFound) || !strings.Contains(err.Error(), "start marker not found") {
+		t.Fatalf("extractJSONFromHTML() error = %v, want start marker error", err)
+	}
+}
+
+func TestExtractJSONFromHTMLMalformedLiteral(t *testing.T) {
+	_, err := extractJSONFromHTML([]byte(`<script>kmtBoot.setProps("unterminated);</script>`))
+	if err == nil || !strings.Contains(err.Error(), "unterminated") {
+		t.Fatalf("extractJSONFromHTML() error = %v, want unterminated literal error", err)
+	}
+}
+
+func TestJSONToGPXRequiresCoordinates(t *testing.T) {
+	var response KomootResponse
+	if err := json.Unmarshal([]byte(`{"page":{"_embedded":{"tour":{"name":"No coords","_embedded":{}}}}}`), &response); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	_, err := NewConverter(DefaultConfig()).jsonToGPX(&response)
+	if !errors.Is(err, ErrNoCoordinates) || !strings.Contains(err.Error(), "coordinates missing") {
+		t.Fatalf("jsonToGPX() error = %v, want coordinates missing error", err)
+	}
+}
+
+func TestJSONToGPXRejectsEmptyCoordinates(t *testing.T) {
+	var response KomootResponse
+	if err := json.Unmarshal([]byte(`{"page":{"_embedded":{"tour":{"name":"Empty coords","_embedded":{"coordinates":{"items":[]}}}}}}`), &response); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	_, err := NewConverter(DefaultConfig()).jsonToGPX(&response)
+	if !errors.Is(err, ErrNoCoordinates) || !strings.Contains(err.Error(), "no coordinates found") {
+		t.Fatalf("jsonToGPX() error = %v, want no coordinates found error", err)
+	}
+}
+
+func TestJSONToGPXRejectsInvalidCoordinates(t *testing.T) {
+	var response KomootResponse
+	if err := json.Unmarshal([]byte(`{"page":{"_embedded":{"tour":{"name":"Bad coords","_embedded":{"coordinates":{"items":[{"lat":91,"lng":0,"alt":10}]}}}}}}`), &response); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	_, err := NewConverter(DefaultConfig()).jsonToGPX(&response)
+	if err == nil || !strings.Contains(err.Error(), "invalid latitude") {
+		t.Fatalf("jsonToGPX() error = %v, want invalid latitude error", err)
+	}
+}
+
+func TestJSONToGPXSkipsIncompleteCoordinates(t *testing.T) {
+	var response KomootResponse
+	if err := json.Unmarshal([]byte(`{"page":{"_embedded":{"tour":{"name":"Partial","_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35},{"lat":51.6,"alt":36},{"lng":-0.13,"alt":37},{"lat":0,"lng":0,"alt":0}]}}}}}}`), &response); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	gpx, err := NewConverter(DefaultConfig()).jsonToGPX(&response)
+	if err != nil {
+		t.Fatalf("jsonToGPX() error = %v", err)
+	}
+
+	points := gpx.Tracks[0].Segments[0].Points
+	want := []Point{{Lat: 51.5, Lon: -0.12, Elevation: 35}, {Lat: 0, Lon: 0, Elevation: 0}}
+	if len(points) != len(want) || points[0] != want[0] || points[1] != want[1] {
+		t.Fatalf("points = %#v, want %#v", points, want)
+	}
+}
+
+func TestKomootCoordinatesUnmarshal(t *testing.T) {
+	var items KomootCoordinates
+	if err := json.Unmarshal([]byte(`[{"lat":0,"lng":1.5,"alt":null},{"lat":2,"t":500}]`), &items); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if len(items) != 2 || *items[0].Lat != 0 || *items[0].Lng != 1.5 || items[0].Alt != nil || items[0].T != nil ||
+		*items[1].Lat != 2 || items[1].Lng != nil || items[1].Alt != nil || *items[1].T != 500 {
+		t.Fatalf("json.Unmarshal() = %#v, want absent and null fields nil and the others set", items)
+	}
+
+	if err := json.Unmarshal([]byte(`[{"lat":"north","lng":1}]`), &items); err == nil {
+		t.Fatal("json.Unmarshal() error = nil, want error for a string coordinate")
+	}
+}
+
+func TestJSONToGPXDeclaresSchema(t *testing.T) {
+	var response KomootResponse
+	if err := json.Unmarshal([]byte(`{"page":{"_embedded":{"tour":{"_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35}]}}}}}}`), &response); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	gpx, err := NewConverter(DefaultConfig()).jsonToGPX(&response)
+	if err != nil {
+		t.Fatalf("jsonToGPX() error = %v", err)
+	}
+	var buf bytes.Buffer
+	if err := encodeGPX(gpx, &buf); err != nil {
+		t.Fatalf("encodeGPX() error = %v", err)
+	}
+
+	want := `<gpx xmlns="http://www.topografix.com/GPX/1/1" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:schemaLocation="http://www.topografix.com/GPX/1/1 http://www.topografix.com/GPX/1/1/gpx.xsd" version="1.1" creator="komootgpx">`
+	if !strings.Contains(buf.String(), want) {
+		t.Fatalf("output = %s, want root element %s", buf.String(), want)
+	}
+
+	read, err := ReadGPX(&buf)
+	if err != nil {
+		t.Fatalf("ReadGPX() error = %v", err)
+	}
+	if read.XMLNSXSI != XSINamespace || read.SchemaLocation != GPXSchemaLocation {
+		t.Fatalf("ReadGPX() = %#v, want schema declarations", read)
+	}
+}
+
+func TestJSONToGPXNameOverride(t *testing.T) {
+	var response KomootResponse
+	if err := json.Unmarshal([]byte(`{"page":{"_embedded":{"tour":{"name":"Morning Ride","_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35}]}}}}}}`), &response); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	config := DefaultConfig()
+	config.Name = "Coast to Coast, Day 1"
+	gpx, err := NewConverter(config).jsonToGPX(&response)
+	if err != nil {
+		t.Fatalf("jsonToGPX() error = %v", err)
+	}
+	if gpx.Metadata.Name != config.Name || gpx.Tracks[0].Name != config.Name {
+		t.Fatalf("names = %q, %q, want %q", gpx.Metadata.Name, gpx.Tracks[0].Name, config.Name)
+	}
+
+	var buf bytes.Buffer
+	if err := writeKML(gpx, &buf, "  "); err != nil {
+		t.Fatalf("writeKML() error = %v", err)
+	}
+	if strings.Contains(buf.String(), "Morning Ride") || !strings.Contains(buf.String(), "<name>Coast to Coast, Day 1</name>") {
+		t.Fatalf("writeKML() = %s, want only the overridden name", buf.String())
+	}
+}
+
+func TestJSONToGPXSegmentsBySurface(t *testing.T) {
+	var response KomootResponse
+	payload := `{"page":{"_embedded":{"tour":{"_embedded":{"coordinates":{"items":[` +
+		`{"lat":52.5,"lng":13.4},{"lat":52.501,"lng":13.4},{"lat":52.502,"lng":13.4},{"lat":52.503,"lng":13.4},{"lng":13.4},{"lat":52.505,"lng":13.4},{"lat":52.506,"lng":13.4}]},` +
+		`"surfaces":{"items":[{"from":0,"to":2,"element":"sf#asphalt"},{"from":2,"to":4,"element":"sf#gravel"},{"from":4,"to":6,"element":"sf#asphalt"}]}}}}}}`
+	if err := json.Unmarshal([]byte(payload), &response); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	config := DefaultConfig()
+	gpx, err := NewConverter(config).jsonToGPX(&response)
+	if err != nil {
+		t.Fatalf("jsonToGPX() error = %v", err)
+	}
+	if got := len(gpx.Tracks[0].Segments); got != 1 {
+		t.Fatalf("segment count without SegmentBySurface = %d, want 1", got)
+	}
+
+	config.SegmentBySurface = true
+	gpx, err = NewConverter(config).jsonToGPX(&response)
+	if err != nil {
+		t.Fatalf("jsonToGPX() error = %v", err)
+	}
+	// The incomplete coordinate 4 is skipped, so the last section starts
+	// at the next complete one.
+	wantLats := [][]float64{{52.5, 52.501, 52.502}, {52.502, 52.503, 52.505}, {52.505, 52.506}}
+	segments := gpx.Tracks[0].Segments
+	if len(segments) != len(wantLats) {
+		t.Fatalf("segments = %#v, want %d", segments, len(wantLats))
+	}
+	for i, want := range wantLats {
+		var lats []float64
+		for _, point := range segments[i].Points {
+			lats = append(lats, point.Lat)
+		}
+		if !slices.Equal(lats, want) {
+			t.Fatalf("segment %d latitudes = %v, want %v", i, lats, want)
+		}
+	}
+}
+
+func TestJSONToGPXMarksMissingAltitude(t *testing.T) {
+	var response KomootResponse
+	if err := json.Unmarshal([]byte(`{"page":{"_embedded":{"tour":{"_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12},{"lat":51.6,"lng":-0.12,"alt":0}]}}}}}}`), &response); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	gpx, err := NewConverter(DefaultConfig()).jsonToGPX(&response)
+	if err != nil {
+		t.Fatalf("jsonToGPX() error = %v", err)
+	}
+
+	points := gpx.Tracks[0].Segments[0].Points
+	if !points[0].NoElevation || points[1].NoElevation {
+		t.Fatalf("points = %#v, want only the first without elevation", points)
+	}
+
+	var buf bytes.Buffer
+	if err := encodeGPX(gpx, &buf); err != nil {
+		t.Fatalf("encodeGPX() error = %v", err)
+	}
+	if got := strings.Count(buf.String(), "<ele>"); got != 1 || !strings.Contains(buf.String(), "<ele>0</ele>") {
+		t.Fatalf("output = %s, want a single <ele>0</ele>", buf.String())
+	}
+}
+
+func TestJSONToGPXDropsImplausibleElevation(t *testing.T) {
+	var response KomootResponse
+	if err := json.Unmarshal([]byte(`{"page":{"_embedded":{"tour":{"_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":-9999},{"lat":51.6,"lng":-0.13,"alt":40}]}}}}}}`), &response); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	config := DefaultConfig()
+	config.Logger = log.New(&buf, "", 0)
+	gpx, err := NewConverter(config).jsonToGPX(&response)
+	if err != nil {
+		t.Fatalf("jsonToGPX() error = %v", err)
+	}
+	points := gpx.Tracks[0].Segments[0].Points
+	if !points[0].NoElevation || points[1].NoElevation || points[1].Elevation != 40 {
+		t.Fatalf("points = %#v, want only the implausible elevation dropped", points)
+	}
+	if want := "Warning: dropped 1 elevations outside -500 to 9000 m"; !strings.Contains(buf.String(), want) {
+		t.Fatalf("log = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestPointValidateElevation(t *testing.T) {
+	tests := []struct {
+		point Point
+		valid bool
+	}{
+		{Point{Elevation: -500}, true},
+		{Point{Elevation: 9000}, true},
+		{Point{Elevation: -501}, false},
+		{Point{Elevation: 9001}, false},
+		{Point{Elevation: 20000, NoElevation: true}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.point.Validate(); (err == nil) != tt.valid {
+			t.Fatalf("Validate(%#v) error = %v, want valid %v", tt.point, err, tt.valid)
+		}
+	}
+}
+
+func TestJSONToGPXRejectsOnlyIncompleteCoordinates(t *testing.T) {
+	var response KomootResponse
+	if err := json.Unmarshal([]byte(`{"page":{"_embedded":{"tour":{"_embedded":{"coordinates":{"items":[{"lat":51.6,"alt":36}]}}}}}}`), &response); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	_, err := NewConverter(DefaultConfig()).jsonToGPX(&response)
+	if err == nil || !strings.Contains(err.Error(), "no complete coordinates") {
+		t.Fatalf("jsonToGPX() error = %v, want no complete coordinates error", err)
+	}
+}
+
+func TestJSONToGPXMetadataTimeModes(t *testing.T) {
+	var response KomootResponse
+	if err := json.Unmarshal([]byte(`{"page":{"_embedded":{"tour":{"name":"Dated","date":"2021-06-05T09:30:00.000+02:00","_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35}]}}}}}}`), &response); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	config := DefaultConfig()
+	gpx, err := NewConverter(config).jsonToGPX(&response)
+	if err != nil {
+		t.Fatalf("jsonToGPX() error = %v", err)
+	}
+	want := time.Date(2021, 6, 5, 7, 30, 0, 0, time.UTC)
+	if gpx.Metadata.Time == nil || !gpx.Metadata.Time.Equal(want) || gpx.Metadata.Time.Location() != time.UTC {
+		t.Fatalf("record metadata time = %v, want %v", gpx.Metadata.Time, want)
+	}
+
+	config.MetadataTime = MetadataTimeNone
+	gpx, err = NewConverter(config).jsonToGPX(&response)
+	if err != nil {
+		t.Fatalf("jsonToGPX() error = %v", err)
+	}
+	if gpx.Metadata.Time != nil {
+		t.Fatalf("none metadata time = %v, want nil", gpx.Metadata.Time)
+	}
+
+	config.MetadataTime = MetadataTimeNow
+	before := time.Now().Add(-time.Second)
+	gpx, err = NewConverter(config).jsonToGPX(&response)
+	if err != nil {
+		t.Fatalf("jsonToGPX() error = %v", err)
+	}
+	if gpx.Metadata.Time == nil || gpx.Metadata.Time.Before(before) {
+		t.Fatalf("now metadata time = %v, want export time", gpx.Metadata.Time)
+	}
+}
+
+func TestJSONToGPXKeywords(t *testing.T) {
+	var response KomootResponse
+	if err := json.Unmarshal([]byte(`{"page":{"_embedded":{"tour":{"sport":"hike","_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35}]}}}}}}`), &response); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	config := DefaultConfig()
+	config.Keywords = []string{" alps", "", "hike", "2024 "}
+	gpx, err := NewConverter(config).jsonToGPX(&response)
+	if err != nil {
+		t.Fatalf("jsonToGPX() error = %v", err)
+	}
+	if gpx.Metadata == nil || gpx.Metadata.Keywords != "hike,alps,2024" {
+		t.Fatalf("metadata = %#v, want keywords hike,alps,2024", gpx.Metadata)
+	}
+}
+
+func TestJSONToGPXDifficulty(t *testing.T) {
+	var response KomootResponse
+	payload := `{"page":{"_embedded":{"tour":{"sport":"hike","distance":12500,"elevation_up":640.4,"elevation_down":612,"constitution":3,` +
+		`"difficulty":{"grade":"moderate","explanation_technical":"t2","explanation_fitness":"f3"},` +
+		`"_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35}]}}}}}}`
+	if err := json.Unmarshal([]byte(payload), &response); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	gpx, err := NewConverter(DefaultConfig()).jsonToGPX(&response)
+	if err != nil {
+		t.Fatalf("jsonToGPX() error = %v", err)
+	}
+	wantDesc := "Distance: 12.5 km, elevation: up 640 m, down 612 m, difficulty: moderate (technical t2, fitness f3), fitness level: 3/5"
+	if gpx.Metadata == nil || gpx.Metadata.Keywords != "hike,difficulty:moderate" || gpx.Metadata.Desc != wantDesc {
+		t.Fatalf("metadata = %#v, want keywords hike,difficulty:moderate and desc %q", gpx.Metadata, wantDesc)
+	}
+}
+
+func TestParseTourDateAcrossDSTBoundary(t *testing.T) {
+	// Central Europe switched from +01:00 to +02:00 at 2021-03-28 01:00 UTC.
+	tests := []struct {
+		date       string
+		wantUTC    time.Time
+		wantOffset string
+	}{
+		{"2021-03-28T01:30:00.000+01:00", time.Date(2021, 3, 28, 0, 30, 0, 0, time.UTC), "+01:00"},
+		{"2021-03-28T03:30:00.000+02:00", time.Date(2021, 3, 28, 1, 30, 0, 0, time.UTC), "+02:00"},
+		{"2021-10-31T02:30:00+02:00", time.Date(2021, 10, 31, 0, 30, 0, 0, time.UTC), "+02:00"},
+		{"2021-10-31T02:30:00+01:00", time.Date(2021, 10, 31, 1, 30, 0, 0, time.UTC), "+01:00"},
+		{"2021-06-05T07:30:00Z", time.Date(2021, 6, 5, 7, 30, 0, 0, time.UTC), "+00:00"},
+	}
+	for _, tt := range tests {
+		got, ok := parseTourDate(tt.date)
+		if !ok || !got.Equal(tt.wantUTC) || got.Location() != time.UTC {
+			t.Fatalf("parseTourDate(%q) = %v, %t, want %v", tt.date, got, ok, tt.wantUTC)
+		}
+		if got.Format(time.RFC3339) != tt.wantUTC.Format(time.RFC3339) {
+			t.Fatalf("parseTourDate(%q) formats as %q, want UTC RFC3339", tt.date, got.Format(time.RFC3339))
+		}
+		offset, ok := tourUTCOffset(tt.date)
+		if !ok || offset != tt.wantOffset {
+			t.Fatalf("tourUTCOffset(%q) = %q, %t, want %q", tt.date, offset, ok, tt.wantOffset)
+		}
+	}
+}
+
+func TestJSONToGPXEmitsLocalOffset(t *testing.T) {
+	var response KomootResponse
+	if err := json.Unmarshal([]byte(`{"page":{"_embedded":{"tour":{"date":"2021-06-05T09:30:00.000+02:00","_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35}]}}}}}}`), &response); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	config := DefaultConfig()
+	config.EmitLocalOffset = true
+	gpx, err := NewConverter(config).jsonToGPX(&response)
+	if err != nil {
+		t.Fatalf("jsonToGPX() error = %v", err)
+	}
+
+	var buf strings.Builder
+	if err := encodeGPX(gpx, &buf); err != nil {
+		t.Fatalf("encodeGPX() error = %v", err)
+	}
+	for _, want := range []string{
+		`<time>2021-06-05T07:30:00Z</time>`,
+		`<localOffset xmlns="https://github.com/mfkd/gokomoot">+02:00</localOffset>`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("GPX output missing %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestJSONToGPXEmitsTourID(t *testing.T) {
+	for _, id := range []string{`123456`, `"e987"`} {
+		var response KomootResponse
+		if err := json.Unmarshal([]byte(`{"page":{"_embedded":{"tour":{"id":`+id+`,"_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35}]}}}}}}`), &response); err != nil {
+			t.Fatalf("json.Unmarshal() error = %v", err)
+		}
+
+		gpx, err := NewConverter(DefaultConfig()).jsonToGPX(&response)
+		if err != nil {
+			t.Fatalf("jsonToGPX() error = %v", err)
+		}
+		if want := strings.Trim(id, `"`); gpx.Metadata == nil || gpx.Metadata.Extensions == nil || gpx.Metadata.Extensions.TourID != want {
+			t.Fatalf("metadata = %#v, want tour ID %s", gpx.Metadata, want)
+		}
+	}
+}
+
+func TestJSONToGPXPointTimes(t *testing.T) {
+	var response KomootResponse
+	if err := json.Unmarshal([]byte(`{"page":{"_embedded":{"tour":{"date":"2021-06-05T09:30:00.000+02:00","_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35,"t":0},{"lat":51.6,"lng":-0.13,"alt":36,"t":90500},{"lat":51.7,"lng":-0.14,"alt":37}]}}}}}}`), &response); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	gpx, err := NewConverter(DefaultConfig()).jsonToGPX(&response)
+	if err != nil {
+		t.Fatalf("jsonToGPX() error = %v", err)
+	}
+	points := gpx.Tracks[0].Segments[0].Points
+	start := time.Date(2021, 6, 5, 7, 30, 0, 0, time.UTC)
+	for i, want := range []time.Time{start, start.Add(90500 * time.Millisecond)} {
+		if points[i].Time == nil || !points[i].Time.Equal(want) {
+			t.Fatalf("point %d time = %v, want %v", i, points[i].Time, want)
+		}
+	}
+	if points[2].Time != nil {
+		t.Fatalf("point 2 time = %v, want none without an offset", points[2].Time)
+	}
+
+	var buf bytes.Buffer
+	if err := encodeGPX(gpx, &buf); err != nil {
+		t.Fatalf("encodeGPX() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), "<ele>36</ele>\n        <time>2021-06-05T07:31:30.5Z</time>") {
+		t.Fatalf("GPX output missing point time:\n%s", buf.String())
+	}
+}
+
+func TestJSONToGPXOmitsPointTimesWithoutStartDate(t *testing.T) {
+	var response KomootResponse
+	if err := json.Unmarshal([]byte(`{"page":{"_embedded":{"tour":{"_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35,"t":1000}]}}}}}}`), &response); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	gpx, err := NewConverter(DefaultConfig()).jsonToGPX(&response)
+	if err != nil {
+		t.Fatalf("jsonToGPX() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := encodeGPX(gpx, &buf); err != nil {
+		t.Fatalf("encodeGPX() error = %v", err)
+	}
+	if strings.Contains(buf.String(), "<time>") {
+		t.Fatalf("GPX output has a time without a tour start date:\n%s", buf.String())
+	}
+}
+
+func TestJSONToGPXTourSummary(t *testing.T) {
+	var response KomootResponse
+	if err := json.Unmarshal([]byte(`{"page":{"_embedded":{"tour":{"sport":"hike","distance":42195.4,"duration":11100,"_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35}]}}}}}}`), &response); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	gpx, err := NewConverter(DefaultConfig()).jsonToGPX(&response)
+	if err != nil {
+		t.Fatalf("jsonToGPX() error = %v", err)
+	}
+	if gpx.Metadata == nil || gpx.Metadata.Desc != "Distance: 42.2 km, duration: 3h 05m" {
+		t.Fatalf("metadata = %#v, want distance and duration description", gpx.Metadata)
+	}
+	if gpx.Tracks[0].Type != "hike" {
+		t.Fatalf("track type = %q, want hike", gpx.Tracks[0].Type)
+	}
+}
+
+func TestJSONToGPXHighlightWaypoints(t *testing.T) {
+	payload := `{"page":{"_embedded":{"tour":{"_embedded":{
+		"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35}]},
+		"highlights":{"items":[
+			{"name":"Viewpoint","mid_point":{"lat":51.51,"lng":-0.121,"alt":80}},
+			{"name":"No location"},
+			{"name":"Off the map","mid_point":{"lat":95,"lng":0}}
+		]}}}}}}`
+	var response KomootResponse
+	if err := json.Unmarshal([]byte(payload), &response); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	gpx, err := NewConverter(DefaultConfig()).jsonToGPX(&response)
+	if err != nil {
+		t.Fatalf("jsonToGPX() error = %v", err)
+	}
+	want := []Waypoint{{Lat: 51.51, Lon: -0.121, Elevation: 80, Name: "Viewpoint"}}
+	if len(gpx.Waypoints) != 1 || gpx.Waypoints[0] != want[0] {
+		t.Fatalf("waypoints = %#v, want %#v", gpx.Waypoints, want)
+	}
+
+	var buf bytes.Buffer
+	if err := encodeGPX(gpx, &buf); err != nil {
+		t.Fatalf("encodeGPX() error = %v", err)
+	}
+	content := buf.String()
+	if wpt, trk := strings.Index(content, "<wpt "), strings.Index(content, "<trk>"); wpt == -1 || wpt > trk {
+		t.Fatalf("GPX output should have <wpt> before <trk>:\n%s", content)
+	}
+
+	config := DefaultConfig()
+	config.SkipWaypoints = true
+	gpx, err = NewConverter(config).jsonToGPX(&response)
+	if err != nil {
+		t.Fatalf("jsonToGPX() error = %v", err)
+	}
+	if len(gpx.Waypoints) != 0 {
+		t.Fatalf("waypoints = %#v, want none with SkipWaypoints", gpx.Waypoints)
+	}
+}
+
+func TestTourSummaryOmitsMissingFields(t *testing.T) {
+	tests := map[string]KomootTour{
+		"":                 {},
+		"Distance: 1.5 km": {Distance: 1500},
+		"Duration: 0h 45m": {Duration: 2700},
+		"Difficulty: easy": {Difficulty: &KomootDifficulty{Grade: "easy"}},
+	}
+	for want, tour := range tests {
+		if got := tourSummary(&tour); got != want {
+			t.Fatalf("tourSummary(%+v) = %q, want %q", tour, got, want)
+		}
+	}
+}
+
+func TestJSONToGPXOmitsUnparseableRecordTime(t *testing.T) {
+	var response KomootResponse
+	if err := json.Unmarshal([]byte(`{"page":{"_embedded":{"tour":{"date":"yesterday","_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35}]}}}}}}`), &response); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	gpx, err := NewConverter(DefaultConfig()).jsonToGPX(&response)
+	if err != nil {
+		t.Fatalf("jsonToGPX() error = %v", err)
+	}
+	if gpx.Metadata == nil || gpx.Metadata.Time != nil {
+		t.Fatalf("metadata = %#v, want only bounds without a parseable date", gpx.Metadata)
+	}
+}
+
+func TestGPXBounds(t *testing.T) {
+	gpx := &GPX{
+		Tracks: []Track{{Segments: []Segment{
+			{Points: []Point{{Lat: 52.5, Lon: 13.4}, {Lat: 52.4, Lon: 13.6}}},
+			{Points: []Point{{Lat: 52.6, Lon: 13.5}}},
+		}}},
+		Waypoints: []Waypoint{{Lat: 52.45, Lon: 13.3}},
+	}
+	minLat, minLon, maxLat, maxLon, ok := gpx.Bounds()
+	if !ok || minLat != 52.4 || minLon != 13.3 || maxLat != 52.6 || maxLon != 13.6 {
+		t.Fatalf("Bounds() = %v %v %v %v %t, want 52.4 13.3 52.6 13.6 true", minLat, minLon, maxLat, maxLon, ok)
+	}
+
+	if _, _, _, _, ok := (&GPX{Tracks: []Track{{Segments: []Segment{{}}}}}).Bounds(); ok {
+		t.Fatal("Bounds() of an empty track ok = true, want false")
+	}
+}
+
+func TestGPXTimeRange(t *testing.T) {
+	early := time.Date(2021, 6, 5, 7, 30, 0, 0, time.UTC)
+	late := early.Add(time.Hour)
+	gpx := &GPX{Tracks: []Track{
+		{Segments: []Segment{{Points: []Point{{Lat: 52.5, Lon: 13.4, Time: &late}, {Lat: 52.4, Lon: 13.6}}}}},
+		{Segments: []Segment{{Points: []Point{{Lat: 52.6, Lon: 13.5, Time: &early}}}}},
+	}}
+	if start, end, ok := gpx.TimeRange(); !ok || !start.Equal(early) || !end.Equal(late) {
+		t.Fatalf("TimeRange() = %v %v %t, want %v %v true", start, end, ok, early, late)
+	}
+
+	untimed := &GPX{Tracks: []Track{{Segments: []Segment{{Points: []Point{{Lat: 52.5, Lon: 13.4}}}}}}}
+	if _, _, ok := untimed.TimeRange(); ok {
+		t.Fatal("TimeRange() without point times ok = true, want false")
+	}
+}
+
+func TestJSONToGPXWritesBounds(t *testing.T) {
+	var response KomootResponse
+	if err := json.Unmarshal([]byte(`{"page":{"_embedded":{"tour":{"name":"Loop","_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35},{"lat":51.6,"lng":-0.2,"alt":40}]}}}}}}`), &response); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	gpx, err := NewConverter(DefaultConfig()).jsonToGPX(&response)
+	if err != nil {
+		t.Fatalf("jsonToGPX() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := encodeGPX(gpx, &buf); err != nil {
+		t.Fatalf("encodeGPX() error = %v", err)
+	}
+	want := `<bounds minlat="51.5" minlon="-0.2" maxlat="51.6" maxlon="-0.12"></bounds>`
+	if !strings.Contains(buf.String(), want) {
+		t.Fatalf("encoded GPX = %s, want %s", buf.String(), want)
+	}
+}
+
+func TestHaversineDistance(t *testing.T) {
+	// One degree of latitude is roughly 111.2 km on a spherical Earth.
+	got := haversineDistance(Point{Lat: 0, Lon: 0}, Point{Lat: 1, Lon: 0})
+	if got < 111190 || got > 111200 {
+		t.Fatalf("haversineDistance() = %f, want about 111195", got)
+	}
+}
+
+func TestIsLoopAndCloseLoop(t *testing.T) {
+	gpx := &GPX{Tracks: []Track{{Segments: []Segment{{Points: []Point{
+		{Lat: 52.5, Lon: 13.4, Elevation: 40},
+		{Lat: 52.51, Lon: 13.41, Elevation: 45},
+		{Lat: 52.5001, Lon: 13.4001, Elevation: 41},
+	}}}}}}
+
+	if !gpx.IsLoop(50) {
+		t.Fatal("IsLoop(50) = false, want true for endpoints about 13m apart")
+	}
+	if gpx.IsLoop(5) {
+		t.Fatal("IsLoop(5) = true, want false for endpoints about 13m apart")
+	}
+
+	gpx.CloseLoop()
+	points := gpx.Tracks[0].Segments[0].Points
+	if points[2] != points[0] {
+		t.Fatalf("last point = %#v, want %#v", points[2], points[0])
+	}
+}
+
+func TestCloseLoopCopiesMissingElevation(t *testing.T) {
+	for _, tt := range []struct {
+		first, last Point
+	}{
+		{Point{Lat: 52.5, Lon: 13.4, NoElevation: true}, Point{Lat: 52.5001, Lon: 13.4001, Elevation: 41}},
+		{Point{Lat: 52.5, Lon: 13.4, Elevation: 40}, Point{Lat: 52.5001, Lon: 13.4001, NoElevation: true}},
+	} {
+		gpx := &GPX{Tracks: []Track{{Segments: []Segment{{Points: []Point{tt.first, tt.last}}}}}}
+		gpx.CloseLoop()
+		if last := gpx.Tracks[0].Segments[0].Points[1]; last != tt.first {
+			t.Fatalf("CloseLoop() last point = %#v, want %#v", last, tt.first)
+		}
+	}
+}
+
+func TestIsLoopEmptyTrack(t *testing.T) {
+	if (&GPX{}).IsLoop(50) {
+		t.Fatal("IsLoop() = true for empty GPX, want false")
+	}
+}
+
+func TestAddCumulativeElevationIgnoresNoise(t *testing.T) {
+	elevations := []float64{100, 101, 99, 105, 110, 108, 102}
+	points := make([]Point, len(elevations))
+	for i, elevation := range elevations {
+		points[i] = Point{Lat: 52.5, Lon: 13.4, Elevation: elevation}
+	}
+	gpx := &GPX{Tracks: []Track{{Segments: []Segment{{Points: points}}}}}
+
+	gpx.addCumulativeElevation(3)
+
+	want := []CumulativeElevation{
+		{0, 0}, {0, 0}, {0, 0}, {5, 0}, {10, 0}, {10, 0}, {10, 8},
+	}
+	for i, point := range gpx.Tracks[0].Segments[0].Points {
+		if got := *point.Extensions.CumulativeElevation; got != want[i] {
+			t.Fatalf("point %d cumulative elevation = %#v, want %#v", i, got, want[i])
+		}
+	}
+}
+
+func TestElevationStats(t *testing.T) {
+	elevations := []float64{100, 101, 99, 105, 110, 108, 102}
+	points := make([]Point, len(elevations))
+	for i, elevation := range elevations {
+		points[i] = Point{Lat: 52.5, Lon: 13.4, Elevation: elevation}
+	}
+	gpx := &GPX{Tracks: []Track{{Segments: []Segment{{Points: points}}}}}
+
+	if gain, loss := gpx.ElevationStats(3); gain != 10 || loss != 8 {
+		t.Fatalf("ElevationStats(3) = %v, %v, want 10, 8", gain, loss)
+	}
+	if gain, loss := gpx.ElevationStats(0); gain != 12 || loss != 10 {
+		t.Fatalf("ElevationStats(0) = %v, %v, want 12, 10", gain, loss)
+	}
+}
+
+func TestWriteGPXCumulativeElevationExtension(t *testing.T) {
+	gpx := &GPX{
+		XMLNS:   "http://www.topografix.com/GPX/1/1",
+		Version: "1.1",
+		Tracks: []Track{{Segments: []Segment{{Points: []Point{
+			{Lat: 51.5, Lon: -0.12, Elevation: 10},
+			{Lat: 51.6, Lon: -0.12, Elevation: 25},
+		}}}}},
+	}
+	gpx.addCumulativeElevation(0)
+
+	outputPath := filepath.Join(t.TempDir(), "route.gpx")
+	if err := NewConverter(DefaultConfig()).writeOutput(context.Background(), gpx, outputPath); err != nil {
+		t.Fatalf("writeOutput() error = %v", err)
+	}
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("os.ReadFile() error = %v", err)
+	}
+
+	want := `<extensions>
+          <cumulativeElevation xmlns="https://github.com/mfkd/gokomoot">
+            <ascent>15</ascent>
+            <descent>0</descent>
+          </cumulativeElevation>
+        </extensions>`
+	if !strings.Contains(string(content), want) {
+		t.Fatalf("GPX output missing %q:\n%s", want, content)
+	}
+}
+
+func TestWriteGPXProducesValidGPX11Shape(t *testing.T) {
+	gpx := &GPX{
+		XMLNS:   "http://www.topografix.com/GPX/1/1",
+		Version: "1.1",
+		Creator: "gokomoot-test",
+		Metadata: &Metadata{
+			Name: "Test Tour",
+		},
+		Tracks: []Track{
+			{
+				Name: "Test Tour",
+				Segments: []Segment{
+					{
+						Points: []Point{
+							{Lat: 51.5, Lon: -0.12, Elevation: 0},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	outputPath := filepath.Join(t.TempDir(), "route.gpx")
+	if err := NewConverter(DefaultConfig()).writeOutput(context.Background(), gpx, outputPath); err != nil {
+		t.Fatalf("writeOutput() error = %v", err)
+	}
+
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("os.ReadFile() error = %v", err)
+	}
+
+	xmlText := string(content)
+	for _, want := range []string{
+		`<gpx xmlns="http://www.topografix.com/GPX/1/1" version="1.1" creator="gokomoot-test">`,
+		`<metadata>`,
+		`<name>Test Tour</name>`,
+		`<trk>`,
+		`<ele>0</ele>`,
+	} {
+		if !strings.Contains(xmlText, want) {
+			t.Fatalf("GPX output missing %q:\n%s", want, xmlText)
+		}
+	}
+
+	if strings.Contains(xmlText, "<gpx><name>") {
+		t.Fatalf("GPX output contains root-level name:\n%s", xmlText)
+	}
+
+	var parsed any
+	if err := xml.Unmarshal(content, &parsed); err != nil {
+		t.Fatalf("xml.Unmarshal() error = %v", err)
+	}
+}
+
+func TestMakeHTTPRequestRetriesTransientStatus(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			http.Error(w, "try again", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.MaxRetries = 2
+	config.RetryInterval = 0
+	converter := NewConverter(config)
+
+	body, err := converter.makeHTTPRequest(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("makeHTTPRequest() error = %v", err)
+	}
+	if string(body) != "ok" {
+		t.Fatalf("makeHTTPRequest() body = %q, want ok", body)
+	}
+	if calls != 2 {
+		t.Fatalf("server calls = %d, want 2", calls)
+	}
+}
+
+func TestMakeHTTPRequestCallsOnRetry(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	var attempts []int
+	config := DefaultConfig()
+	config.MaxRetries = 3
+	config.RetryInterval = time.Millisecond
+	config.OnRetry = func(attempt int, err error, next time.Duration) {
+		if err == nil || !strings.Contains(err.Error(), "unexpected status code: 429") {
+			t.Errorf("OnRetry() error = %v, want 429 error", err)
+		}
+		// Exponential backoff with equal jitter: 0.5-1ms, then 1-2ms.
+		base := time.Millisecond << (attempt - 2)
+		if next < base/2 || next > base {
+			t.Errorf("OnRetry() next = %s, want between %s and %s", next, base/2, base)
+		}
+		attempts = append(attempts, attempt)
+	}
+	converter := NewConverter(config)
+
+	if _, err := converter.makeHTTPRequest(context.Background(), server.URL); err != nil {
+		t.Fatalf("makeHTTPRequest() error = %v", err)
+	}
+	if len(attempts) != 2 || attempts[0] != 2 || attempts[1] != 3 {
+		t.Fatalf("OnRetry attempts = %v, want [2 3]", attempts)
+	}
+}
+
+func TestMakeHTTPRequestDoesNotRetryPermanentClientError(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.MaxRetries = 3
+	config.RetryInterval = 0
+	converter := NewConverter(config)
+
+	_, err := converter.makeHTTPRequest(context.Background(), server.URL)
+	if !errors.Is(err, ErrTourNotFound) || !strings.Contains(err.Error(), "unexpected status code: 404") {
+		t.Fatalf("makeHTTPRequest() error = %v, want 404 error", err)
+	}
+	if calls != 1 {
+		t.Fatalf("server calls = %d, want 1", calls)
+	}
+}
+
+func TestConvertErrorsMatchSentinels(t *testing.T) {
+	pages := map[string]string{
+		"/tour/1": `<html><body>Not a tour</body></html>`,
+		"/tour/2": tourPageHTML(t, `{"page":{"_embedded":{"tour":{"id":2,"_embedded":{"coordinates":{"items":[]}}}}}}`),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/4") {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, page)
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.APIBaseURL = server.URL
+	config.RetryInterval = 0
+	config.MaxRetries = 1
+	config.Verbosity = VerbosityQuiet
+	converter := NewConverter(config)
+
+	for tour, want := range map[string]error{"1": ErrMarkerNotFound, "2": ErrNoCoordinates, "3": ErrTourNotFound} {
+		err := converter.Convert(context.Background(), server.URL+"/tour/"+tour, filepath.Join(t.TempDir(), "tour.gpx"))
+		if !errors.Is(err, want) {
+			t.Fatalf("Convert(tour %s) error = %v, want %v", tour, err, want)
+		}
+	}
+
+	err := converter.Convert(context.Background(), server.URL+"/tour/4", filepath.Join(t.TempDir(), "tour.gpx"))
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable || errors.Is(err, ErrTourNotFound) {
+		t.Fatalf("Convert(tour 4) error = %v, want a 503 StatusError", err)
+	}
+}
+
+func TestConvertSendsSessionCookieForPrivateTours(t *testing.T) {
+	html := capturedKomootHTML(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie("kmt_session"); err != nil || cookie.Value != "secret" {
+			fmt.Fprint(w, "<html>Please log in</html>")
+			return
+		}
+		fmt.Fprint(w, html)
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.APIBaseURL = server.URL
+	config.MaxRetries = 1
+	tourURL := server.URL + "/tour/33303609"
+	if err := NewConverter(config).Convert(context.Background(), tourURL, filepath.Join(t.TempDir(), "public.gpx")); err == nil {
+		t.Fatal("Convert() without cookie error = nil, want login wall error")
+	}
+
+	config.SessionCookie = "kmt_session=secret; other=1"
+	if err := NewConverter(config).Convert(context.Background(), tourURL, filepath.Join(t.TempDir(), "private.gpx")); err != nil {
+		t.Fatalf("Convert() with cookie error = %v", err)
+	}
+}
+
+func TestResolveTourURL(t *testing.T) {
+	tests := map[string]string{
+		"https://www.komoot.com/tour/123?ref=wtd":                       "https://www.komoot.com/tour/123",
+		"HTTPS://WWW.Komoot.com/tour/123/":                              "https://www.komoot.com/tour/123",
+		"https://www.komoot.com/tour/123?utm_source=app#map":            "https://www.komoot.com/tour/123",
+		"https://www.komoot.com/tour/123?share_token=abc&ref=wtd":       "https://www.komoot.com/tour/123?share_token=abc",
+		" https://www.komoot.com/smarttour/33303609?tour_origin=smart ": "https://www.komoot.com/smarttour/33303609",
+	}
+	for input, want := range tests {
+		got, err := ResolveTourURL(input)
+		if err != nil {
+			t.Fatalf("ResolveTourURL(%q) error = %v", input, err)
+		}
+		if got != want {
+			t.Fatalf("ResolveTourURL(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestMiddlewaresWrapTransportInOrder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Header.Get("Authorization"))
+	}))
+	defer server.Close()
+
+	var order []string
+	recording := func(name string) func(http.RoundTripper) http.RoundTripper {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name+" request")
+				resp, err := next.RoundTrip(req)
+				order = append(order, name+" response")
+				return resp, err
+			})
+		}
+	}
+	auth := func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			req.Header.Set("Authorization", "Bearer token")
+			return next.RoundTrip(req)
+		})
+	}
+
+	config := DefaultConfig()
+	config.Middlewares = []func(http.RoundTripper) http.RoundTripper{recording("outer"), recording("inner"), auth}
+	body, err := NewConverter(config).makeHTTPRequest(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("makeHTTPRequest() error = %v", err)
+	}
+
+	if string(body) != "Bearer token" {
+		t.Fatalf("makeHTTPRequest() body = %q, want injected header", body)
+	}
+	want := []string{"outer request", "inner request", "inner response", "outer response"}
+	if strings.Join(order, ",") != strings.Join(want, ",") {
+		t.Fatalf("middleware order = %v, want %v", order, want)
+	}
+}
+
+func TestProxyReceivesRequests(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "proxied "+r.URL.String())
+	}))
+	defer proxy.Close()
+
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatalf("url.Parse() error = %v", err)
+	}
+	config := DefaultConfig()
+	config.Proxy = proxyURL
+	body, err := NewConverter(config).makeHTTPRequest(context.Background(), "http://komoot.invalid/tour/1")
+	if err != nil {
+		t.Fatalf("makeHTTPRequest() error = %v", err)
+	}
+	if string(body) != "proxied http://komoot.invalid/tour/1" {
+		t.Fatalf("makeHTTPRequest() body = %q, want the request to reach the proxy", body)
+	}
+}
+
+func TestHTTPClientIsUsedAsIs(t *testing.T) {
+	requests := 0
+	client := &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("canned")), Request: req}, nil
+	})}
+
+	config := DefaultConfig()
+	config.HTTPClient = client
+	config.Middlewares = []func(http.RoundTripper) http.RoundTripper{
+		func(http.RoundTripper) http.RoundTripper {
+			t.Fatal("middleware applied to a custom HTTP client")
+			return nil
+		},
+	}
+	body, err := NewConverter(config).makeHTTPRequest(context.Background(), "https://www.komoot.com/tour/1")
+	if err != nil || string(body) != "canned" {
+		t.Fatalf("makeHTTPRequest() = %q, %v, want canned response", body, err)
+	}
+	if requests != 1 {
+		t.Fatalf("custom client saw %d requests, want 1", requests)
+	}
+}
+
+func TestNewHTTPClientConnectionSettings(t *testing.T) {
+	config := DefaultConfig()
+	config.Concurrency = 8
+	config.IdleConnTimeout = time.Minute
+	transport := newHTTPClient(config).Transport.(*http.Transport)
+	if transport.MaxIdleConnsPerHost != 8 || transport.IdleConnTimeout != time.Minute || !transport.ForceAttemptHTTP2 {
+		t.Fatalf("transport keeps %d idle connections per host for %v, HTTP/2 %t, want 8 for 1m0s and HTTP/2", transport.MaxIdleConnsPerHost, transport.IdleConnTimeout, transport.ForceAttemptHTTP2)
+	}
+
+	config.MaxIdleConnsPerHost = 2
+	config.ForceAttemptHTTP2 = false
+	transport = newHTTPClient(config).Transport.(*http.Transport)
+	if transport.MaxIdleConnsPerHost != 2 || transport.ForceAttemptHTTP2 {
+		t.Fatalf("transport keeps %d idle connections per host, HTTP/2 %t, want 2 without HTTP/2", transport.MaxIdleConnsPerHost, transport.ForceAttemptHTTP2)
+	}
+}
+
+func BenchmarkBatchRequestsConnectionReuse(b *testing.B) {
+	const concurrency = 8
+	var opened atomic.Int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			opened.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	// Each op is one round of a batch: concurrency requests to the same host
+	// at once, as ConvertBatch makes them.
+	for _, idle := range []int{2, 0} {
+		name := "go-default-idle"
+		if idle == 0 {
+			name = "idle-per-concurrency"
+		}
+		b.Run(name, func(b *testing.B) {
+			config := DefaultConfig()
+			config.Verbosity = VerbosityQuiet
+			config.Concurrency = concurrency
+			config.MaxIdleConnsPerHost = idle
+			converter := NewConverter(config)
+			opened.Store(0)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var wg sync.WaitGroup
+				for range concurrency {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						if _, err := converter.makeHTTPRequest(context.Background(), server.URL); err != nil {
+							b.Error(err)
+						}
+					}()
+				}
+				wg.Wait()
+			}
+			b.ReportMetric(float64(opened.Load())/float64(b.N), "conns/op")
+		})
+	}
+}
+
+func TestSleepWithContextCanBeCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	err := sleepWithContext(ctx, time.Hour)
+	if err == nil || !strings.Contains(err.Error(), "context canceled") {
+		t.Fatalf("sleepWithContext() error = %v, want context canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("sleepWithContext() took %s, want prompt cancellation", elapsed)
+	}
+}
+
+func TestEncoderHonorsIndent(t *testing.T) {
+	gpx := &GPX{Tracks: []Track{{Name: "Tour", Segments: []Segment{{Points: []Point{{Lat: 51.5, Lon: -0.12, Elevation: 35}, {Lat: 51.6, Lon: -0.13, Elevation: 40}}}}}}}
+	tests := []struct {
+		format, indent, want string
+	}{
+		{FormatGPX, "", xml.Header + `<gpx `},
+		{FormatGPX, "\t", "\n\t<trk>"},
+		{FormatKML, "", xml.Header + `<kml `},
+		{FormatGeoJSON, "", `{"type":"FeatureCollection"`},
+		{FormatGeoJSON, "  ", "{\n  \"type\""},
+	}
+	for _, tt := range tests {
+		config := DefaultConfig()
+		config.Indent = tt.indent
+		encode, err := NewConverter(config).encoder(tt.format)
+		if err != nil {
+			t.Fatalf("encoder(%q) error = %v", tt.format, err)
+		}
+		var buf bytes.Buffer
+		if err := encode(gpx, &buf); err != nil {
+			t.Fatalf("encode(%q) error = %v", tt.format, err)
+		}
+		output := buf.String()
+		if !strings.Contains(output, tt.want) {
+			t.Fatalf("%s output with indent %q = %s, want %q", tt.format, tt.indent, output, tt.want)
+		}
+		if tt.indent == "" && strings.Count(strings.TrimSuffix(strings.TrimPrefix(output, xml.Header), "\n"), "\n") > 0 {
+			t.Fatalf("%s output with no indent = %s, want a single line after the header", tt.format, output)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package gokomoot
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+// htmlViewerTemplate renders a self-contained page showing the tracks on a
+// Leaflet map
+var htmlViewerTemplate = template.Must(template.New("viewer").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<link rel="stylesheet" href="{{.LeafletURL}}/leaflet.css">
+<script src="{{.LeafletURL}}/leaflet.js"></script>
+<style>html, body, #map { height: 100%; margin: 0; }</style>
+</head>
+<body>
+<div id="map"></div>
+<script>
+var track = {{.Track}};
+var map = L.map("map");
+L.tileLayer({{.TileURL}}, {
+  maxZoom: 19,
+  attribution: "&copy; OpenStreetMap contributors"
+}).addTo(map);
+var layer = L.geoJSON(track).addTo(map);
+map.fitBounds(layer.getBounds());
+</script>
+</body>
+</html>
+`))
+
+// writeHTMLViewer writes an HTML page that displays the tracks on a Leaflet
+// map. The track is embedded as inline GeoJSON; Leaflet is loaded from
+// leafletURL and map tiles from the tileURL template.
+func writeHTMLViewer(gpx *GPX, w io.Writer, leafletURL, tileURL string) error {
+	title := "Komoot tour"
+	if gpx.Metadata != nil && gpx.Metadata.Name != "" {
+		title = gpx.Metadata.Name
+	}
+
+	err := htmlViewerTemplate.Execute(w, struct {
+		Title      string
+		LeafletURL string
+		TileURL    string
+		Track      geoJSONFeatureCollection
+	}{
+		Title:      title,
+		LeafletURL: strings.TrimSuffix(leafletURL, "/"),
+		TileURL:    tileURL,
+		Track:      gpx.toGeoJSON(),
+	})
+	if err != nil {
+		return fmt.Errorf("error rendering HTML viewer: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package gokomoot
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteHTMLViewer(t *testing.T) {
+	gpx := &GPX{
+		Metadata: &Metadata{Name: `Tour </script><b>`},
+		Tracks: []Track{{Name: "Tour", Segments: []Segment{{Points: []Point{
+			{Lat: 52.5, Lon: 13.4, Elevation: 40},
+			{Lat: 52.51, Lon: 13.41, Elevation: 45},
+		}}}}},
+	}
+
+	var buf bytes.Buffer
+	if err := writeHTMLViewer(gpx, &buf, "https://cdn.example.com/leaflet/", "https://tiles.example.com/{z}/{x}/{y}.png"); err != nil {
+		t.Fatalf("writeHTMLViewer() error = %v", err)
+	}
+
+	page := buf.String()
+	for _, want := range []string{
+		`<title>Tour &lt;/script&gt;&lt;b&gt;</title>`,
+		`href="https://cdn.example.com/leaflet/leaflet.css"`,
+		`src="https://cdn.example.com/leaflet/leaflet.js"`,
+		`L.tileLayer("https://tiles.example.com/{z}/{x}/{y}.png"`,
+		`"coordinates":[[[13.4,52.5,40],[13.41,52.51,45]]]`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Fatalf("HTML viewer missing %q:\n%s", want, page)
+		}
+	}
+}
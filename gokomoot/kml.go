@@ -0,0 +1,99 @@
+package gokomoot
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// kmlDocument is the root of a KML 2.2 file with one placemark per track
+type kmlDocument struct {
+	XMLName    xml.Name       `xml:"http://www.opengis.net/kml/2.2 kml"`
+	Name       string         `xml:"Document>name,omitempty"`
+	Placemarks []kmlPlacemark `xml:"Document>Placemark"`
+}
+
+// kmlPlacemark holds a track as a line string, or as a multi-geometry of
+// line strings when the track has several segments
+type kmlPlacemark struct {
+	Name          string            `xml:"name,omitempty"`
+	LineString    *kmlLineString    `xml:"LineString,omitempty"`
+	MultiGeometry *kmlMultiGeometry `xml:"MultiGeometry,omitempty"`
+}
+
+// kmlMultiGeometry groups the line strings of a multi-segment track
+type kmlMultiGeometry struct {
+	LineStrings []kmlLineString `xml:"LineString"`
+}
+
+// kmlLineString is a line of lon,lat,ele tuples, or lon,lat tuples for points
+// without elevation
+type kmlLineString struct {
+	AltitudeMode string `xml:"altitudeMode,omitempty"`
+	Coordinates  string `xml:"coordinates"`
+}
+
+// writeKML encodes all tracks as KML placemarks for Google Earth, with
+// absolute elevations. Lines without any elevation are clamped to the ground.
+func writeKML(gpx *GPX, w io.Writer, indent string) error {
+	doc := kmlDocument{}
+	if gpx.Metadata != nil {
+		doc.Name = gpx.Metadata.Name
+	}
+
+	for _, track := range gpx.Tracks {
+		placemark := kmlPlacemark{Name: track.Name}
+		if placemark.Name == "" {
+			placemark.Name = doc.Name
+		}
+
+		var lines []kmlLineString
+		for _, segment := range track.Segments {
+			if len(segment.Points) > 0 {
+				line := kmlLineString{Coordinates: kmlCoordinates(segment.Points)}
+				if hasElevation(segment.Points) {
+					line.AltitudeMode = "absolute"
+				}
+				lines = append(lines, line)
+			}
+		}
+		switch len(lines) {
+		case 0:
+			continue
+		case 1:
+			placemark.LineString = &lines[0]
+		default:
+			placemark.MultiGeometry = &kmlMultiGeometry{LineStrings: lines}
+		}
+		doc.Placemarks = append(doc.Placemarks, placemark)
+	}
+
+	if len(doc.Placemarks) == 0 {
+		return fmt.Errorf("no track points to write")
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("error writing XML header: %w", err)
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", indent)
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("error encoding KML: %w", err)
+	}
+	return nil
+}
+
+// kmlCoordinates formats points as whitespace-separated lon,lat,ele tuples
+func kmlCoordinates(points []Point) string {
+	tuples := make([]string, len(points))
+	for i, point := range points {
+		tuples[i] = strconv.FormatFloat(point.Lon, 'f', -1, 64) + "," +
+			strconv.FormatFloat(point.Lat, 'f', -1, 64)
+		if !point.NoElevation {
+			tuples[i] += "," + strconv.FormatFloat(point.Elevation, 'f', -1, 64)
+		}
+	}
+	return strings.Join(tuples, " ")
+}
@@ -0,0 +1,55 @@
+package gokomoot
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+const kmlGoldenFile = "testdata/tour.kml"
+
+func TestWriteKMLMatchesGolden(t *testing.T) {
+	gpx := &GPX{
+		Metadata: &Metadata{Name: "Havel & Tegel"},
+		Tracks: []Track{
+			{Name: "Havel & Tegel", Segments: []Segment{{Points: []Point{
+				{Lat: 52.516839, Lon: 13.25041, Elevation: 50.4},
+				{Lat: 52.516855, Lon: 13.25038, Elevation: 50.4},
+				{Lat: 52.517005, Lon: 13.250184, Elevation: 50.6},
+			}}}},
+			{Name: "split", Segments: []Segment{
+				{Points: []Point{{Lat: 1, Lon: 2, Elevation: 3}}},
+				{Points: []Point{{Lat: 4, Lon: 5, Elevation: 6}}},
+			}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := writeKML(gpx, &buf, "  "); err != nil {
+		t.Fatalf("writeKML() error = %v", err)
+	}
+
+	if *updateGolden {
+		if err := os.WriteFile(kmlGoldenFile, buf.Bytes(), 0o644); err != nil {
+			t.Fatalf("os.WriteFile() error = %v", err)
+		}
+	}
+	want, err := os.ReadFile(kmlGoldenFile)
+	if err != nil {
+		t.Fatalf("os.ReadFile(%q) error = %v", kmlGoldenFile, err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("writeKML() output differs from %s:\n%s", kmlGoldenFile, buf.String())
+	}
+}
+
+func TestWriteKMLRejectsEmptyTrack(t *testing.T) {
+	err := writeKML(&GPX{Tracks: []Track{{Name: "empty"}}}, &bytes.Buffer{}, "  ")
+	if err == nil || !strings.Contains(err.Error(), "no track points") {
+		t.Fatalf("writeKML() error = %v, want no track points error", err)
+	}
+}
@@ -0,0 +1,47 @@
+package gokomoot
+
+import (
+	"fmt"
+	"log"
+)
+
+// Verbosity selects which progress messages the converter logs
+type Verbosity int
+
+// Verbosity levels. The zero value is VerbosityNormal.
+const (
+	// VerbosityQuiet logs nothing; errors are still returned to the caller
+	VerbosityQuiet Verbosity = -1
+	// VerbosityNormal logs progress messages
+	VerbosityNormal Verbosity = 0
+	// VerbosityVerbose also logs details like response sizes and retry reasons
+	VerbosityVerbose Verbosity = 1
+)
+
+// leveledLogger drops messages above the configured verbosity
+type leveledLogger struct {
+	logger    *log.Logger
+	verbosity Verbosity
+}
+
+// Printf logs a progress message at normal verbosity
+func (l *leveledLogger) Printf(format string, v ...any) {
+	l.output(VerbosityNormal, fmt.Sprintf(format, v...))
+}
+
+// Println logs a progress message at normal verbosity
+func (l *leveledLogger) Println(v ...any) {
+	l.output(VerbosityNormal, fmt.Sprintln(v...))
+}
+
+// Verbosef logs a detail message shown only at verbose verbosity
+func (l *leveledLogger) Verbosef(format string, v ...any) {
+	l.output(VerbosityVerbose, fmt.Sprintf(format, v...))
+}
+
+func (l *leveledLogger) output(level Verbosity, message string) {
+	if level > l.verbosity {
+		return
+	}
+	_ = l.logger.Output(3, message)
+}
@@ -0,0 +1,85 @@
+package gokomoot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLeveledLoggerVerbosity(t *testing.T) {
+	tests := []struct {
+		verbosity Verbosity
+		want      string
+	}{
+		{VerbosityQuiet, ""},
+		{VerbosityNormal, "progress\n"},
+		{VerbosityVerbose, "progress\ndetail 42\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		logger := &leveledLogger{logger: log.New(&buf, "", 0), verbosity: tt.verbosity}
+		logger.Println("progress")
+		logger.Verbosef("detail %d\n", 42)
+		if got := buf.String(); got != tt.want {
+			t.Fatalf("verbosity %d logged %q, want %q", tt.verbosity, got, tt.want)
+		}
+	}
+}
+
+func TestConverterUsesConfiguredLogger(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hello")
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	config := DefaultConfig()
+	config.Logger = log.New(&buf, "", 0)
+	config.Verbosity = VerbosityVerbose
+	if _, err := NewConverter(config).makeHTTPRequest(context.Background(), server.URL); err != nil {
+		t.Fatalf("makeHTTPRequest() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), `Received 5 bytes with status 200 from `+server.URL+`, content type "text/plain; charset=utf-8"`) {
+		t.Fatalf("log = %q, want response size and content type", buf.String())
+	}
+}
+
+func TestRetryLogsStatusAndAttempts(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	config := DefaultConfig()
+	config.Logger = log.New(&buf, "", 0)
+	config.MaxRetries = 3
+	config.RetryInterval = time.Millisecond
+	if _, err := NewConverter(config).makeHTTPRequest(context.Background(), server.URL); err == nil {
+		t.Fatal("makeHTTPRequest() error = nil, want 404 error")
+	}
+
+	logged := buf.String()
+	for _, want := range []string{
+		"Retry attempt 2/3 in ",
+		"after unexpected status code: 503, ",
+		"Request to " + server.URL + " failed after 2 attempts:\n  attempt 1: unexpected status code: 503 after ",
+		"\n  attempt 2: unexpected status code: 404 after ",
+	} {
+		if !strings.Contains(logged, want) {
+			t.Fatalf("log = %q, want %q", logged, want)
+		}
+	}
+}
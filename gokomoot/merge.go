@@ -0,0 +1,79 @@
+package gokomoot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MergeGPX combines several GPX documents into one, keeping every track and
+// waypoint in order, so each tour of a multi-day trip becomes its own <trk>
+// with its original name. The metadata of the first document is kept, minus
+// the tour ID and distance that only described that tour, and the bounds are
+// recomputed over all of them. Nil documents are skipped.
+func MergeGPX(tracks ...*GPX) *GPX {
+	var merged *GPX
+	for _, gpx := range tracks {
+		if gpx == nil {
+			continue
+		}
+		if merged == nil {
+			merged = &GPX{
+				XMLNS:          gpx.XMLNS,
+				XMLNSXSI:       gpx.XMLNSXSI,
+				SchemaLocation: gpx.SchemaLocation,
+				XMLNSGPXTPX:    gpx.XMLNSGPXTPX,
+				Version:        gpx.Version,
+				Creator:        gpx.Creator,
+			}
+			if gpx.Metadata != nil {
+				metadata := *gpx.Metadata
+				if metadata.Extensions != nil {
+					extensions := *metadata.Extensions
+					extensions.TourID = ""
+					extensions.Distance = ""
+					metadata.Extensions = &extensions
+				}
+				merged.Metadata = &metadata
+			}
+		}
+		merged.Tracks = append(merged.Tracks, gpx.Tracks...)
+		merged.Waypoints = append(merged.Waypoints, gpx.Waypoints...)
+	}
+	if merged == nil {
+		return &GPX{}
+	}
+	merged.setBounds()
+	return merged
+}
+
+// ConvertMerged downloads each tour, converts it with the configured
+// transformations and writes all of them to the single outputPath
+// destination, one or more tracks per tour, as combined by MergeGPX. The
+// first tour that fails stops the conversion.
+func (c *Converter) ConvertMerged(ctx context.Context, urls []string, outputPath string) error {
+	if len(urls) == 0 {
+		return errors.New("no tours to merge")
+	}
+
+	tours := make([]*GPX, len(urls))
+	var recorded *time.Time
+	for i, tourURL := range urls {
+		komootResp, err := c.fetchTour(ctx, tourURL)
+		if err != nil {
+			return fmt.Errorf("%s: %w", tourURL, err)
+		}
+		if tours[i], err = c.buildGPX(ctx, komootResp); err != nil {
+			return fmt.Errorf("%s: %w", tourURL, err)
+		}
+		if date, ok := parseTourDate(komootResp.Page.Embedded.Tour.Date); ok && (recorded == nil || date.Before(*recorded)) {
+			recorded = &date
+		}
+	}
+
+	merged := MergeGPX(tours...)
+	c.logger.Printf("Merged %d tours into %d tracks\n", len(tours), len(merged.Tracks))
+	_, err := c.writeTours(ctx, merged, fmt.Sprintf("%d merged tours", len(tours)), recorded, outputPath)
+	return err
+}
@@ -0,0 +1,72 @@
+package gokomoot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMergeGPXKeepsEveryTrack(t *testing.T) {
+	day1 := &GPX{
+		Version:   "1.1",
+		Creator:   creator,
+		Metadata:  &Metadata{Name: "Day 1", Extensions: &MetadataExtensions{TourID: "1", Distance: "1200", LocalOffset: "+02:00"}},
+		Tracks:    []Track{{Name: "Day 1", Segments: []Segment{{Points: []Point{{Lat: 47, Lon: 11}, {Lat: 47.1, Lon: 11.1}}}}}},
+		Waypoints: []Waypoint{{Lat: 47.05, Lon: 11.05, Name: "Hut"}},
+	}
+	day2 := &GPX{
+		Version: "1.1",
+		Tracks:  []Track{{Name: "Day 2", Segments: []Segment{{Points: []Point{{Lat: 47.1, Lon: 11.1}, {Lat: 47.3, Lon: 11.4}}}}}},
+	}
+
+	merged := MergeGPX(day1, nil, day2)
+	if len(merged.Tracks) != 2 || merged.Tracks[0].Name != "Day 1" || merged.Tracks[1].Name != "Day 2" {
+		t.Fatalf("MergeGPX() tracks = %+v, want Day 1 and Day 2", merged.Tracks)
+	}
+	if len(merged.Waypoints) != 1 || merged.Creator != creator {
+		t.Fatalf("MergeGPX() = %+v, want the waypoint and creator of the first GPX", merged)
+	}
+	extensions := merged.Metadata.Extensions
+	if extensions.TourID != "" || extensions.Distance != "" || extensions.LocalOffset != "+02:00" {
+		t.Fatalf("MergeGPX() metadata extensions = %+v, want only the local offset", extensions)
+	}
+	if day1.Metadata.Extensions.TourID != "1" {
+		t.Fatal("MergeGPX() modified the metadata of its input")
+	}
+	if bounds := merged.Metadata.Bounds; bounds == nil || *bounds != (Bounds{MinLat: 47, MinLon: 11, MaxLat: 47.3, MaxLon: 11.4}) {
+		t.Fatalf("MergeGPX() bounds = %+v, want the bounds of both tours", bounds)
+	}
+}
+
+func TestConvertMergedWritesOneFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/tour/")
+		fmt.Fprint(w, tourPageHTML(t, `{"page":{"_embedded":{"tour":{"id":`+id+`,"name":"Stage `+id+`","_embedded":{"coordinates":{"items":[{"lat":51.`+id+`,"lng":-0.12,"alt":35},{"lat":51.`+id+`1,"lng":-0.12,"alt":36}]}}}}}}`))
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.Verbosity = VerbosityQuiet
+	outputPath := filepath.Join(t.TempDir(), "trip.gpx")
+	if err := NewConverter(config).ConvertMerged(context.Background(), []string{server.URL + "/tour/1", server.URL + "/tour/2"}, outputPath); err != nil {
+		t.Fatalf("ConvertMerged() error = %v", err)
+	}
+
+	file, err := os.Open(outputPath)
+	if err != nil {
+		t.Fatalf("os.Open() error = %v", err)
+	}
+	defer file.Close()
+	gpx, err := ReadGPX(file)
+	if err != nil {
+		t.Fatalf("ReadGPX() error = %v", err)
+	}
+	if len(gpx.Tracks) != 2 || gpx.Tracks[0].Name != "Stage 1" || gpx.Tracks[1].Name != "Stage 2" {
+		t.Fatalf("merged tracks = %+v, want Stage 1 and Stage 2", gpx.Tracks)
+	}
+}
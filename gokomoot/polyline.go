@@ -0,0 +1,71 @@
+package gokomoot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Polyline precisions: 5 decimals is Google's standard, 6 is used by OSRM
+// and Valhalla
+const (
+	PolylinePrecision5 = 5
+	PolylinePrecision6 = 6
+)
+
+// writePolyline writes the points of the first track as a Google Encoded
+// Polyline string, rounding coordinates to precision decimals, followed by a
+// newline. Elevations and times are not part of the format.
+func writePolyline(gpx *GPX, w io.Writer, precision int) error {
+	if precision != PolylinePrecision5 && precision != PolylinePrecision6 {
+		return fmt.Errorf("unsupported polyline precision %d, want 5 or 6", precision)
+	}
+	if len(gpx.Tracks) == 0 {
+		return errors.New("no track points to write")
+	}
+
+	var points []Point
+	for _, segment := range gpx.Tracks[0].Segments {
+		points = append(points, segment.Points...)
+	}
+	if len(points) == 0 {
+		return errors.New("no track points to write")
+	}
+
+	if _, err := fmt.Fprintln(w, string(encodePolyline(points, precision))); err != nil {
+		return fmt.Errorf("error writing polyline: %w", err)
+	}
+	return nil
+}
+
+// encodePolyline encodes the latitude and longitude of points with the
+// Encoded Polyline Algorithm: each coordinate is rounded to precision
+// decimals and written as the difference to the previous one
+func encodePolyline(points []Point, precision int) []byte {
+	factor := math.Pow10(precision)
+	encoded := make([]byte, 0, len(points)*8)
+	var lastLat, lastLon int64
+	for _, point := range points {
+		lat := int64(math.Round(point.Lat * factor))
+		lon := int64(math.Round(point.Lon * factor))
+		encoded = appendPolylineValue(encoded, lat-lastLat)
+		encoded = appendPolylineValue(encoded, lon-lastLon)
+		lastLat, lastLon = lat, lon
+	}
+	return encoded
+}
+
+// appendPolylineValue appends one signed value as 5-bit chunks, least
+// significant first, each offset by 63 into printable ASCII
+func appendPolylineValue(encoded []byte, value int64) []byte {
+	shifted := uint64(value) << 1
+	if value < 0 {
+		shifted = ^shifted
+	}
+	for shifted >= 0x20 {
+		encoded = append(encoded, byte(0x20|shifted&0x1f)+63)
+		shifted >>= 5
+	}
+	return append(encoded, byte(shifted)+63)
+}
@@ -0,0 +1,43 @@
+package gokomoot
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWritePolyline(t *testing.T) {
+	// The example from Google's Encoded Polyline Algorithm documentation,
+	// split over two segments
+	gpx := &GPX{Tracks: []Track{{Segments: []Segment{
+		{Points: []Point{{Lat: 38.5, Lon: -120.2, Elevation: 100}, {Lat: 40.7, Lon: -120.95}}},
+		{Points: []Point{{Lat: 43.252, Lon: -126.453}}},
+	}}}}
+
+	tests := []struct {
+		gpx       *GPX
+		precision int
+		want      string
+	}{
+		{gpx, PolylinePrecision5, "_p~iF~ps|U_ulLnnqC_mqNvxq`@\n"},
+		{&GPX{Tracks: []Track{{Segments: []Segment{{Points: []Point{{Lat: 38.5, Lon: -120.2}}}}}}}, PolylinePrecision6, "_izlhA~rlgdF\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := writePolyline(tt.gpx, &buf, tt.precision); err != nil {
+			t.Fatalf("writePolyline(precision %d) error = %v", tt.precision, err)
+		}
+		if buf.String() != tt.want {
+			t.Fatalf("writePolyline(precision %d) = %q, want %q", tt.precision, buf.String(), tt.want)
+		}
+	}
+}
+
+func TestWritePolylineRejectsBadInput(t *testing.T) {
+	if err := writePolyline(&GPX{Tracks: []Track{{}}}, &bytes.Buffer{}, PolylinePrecision5); err == nil {
+		t.Fatal("writePolyline() without points error = nil, want error")
+	}
+	gpx := &GPX{Tracks: []Track{{Segments: []Segment{{Points: []Point{{Lat: 1, Lon: 2}}}}}}}
+	if err := writePolyline(gpx, &bytes.Buffer{}, 7); err == nil {
+		t.Fatal("writePolyline() with precision 7 error = nil, want error")
+	}
+}
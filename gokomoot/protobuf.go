@@ -0,0 +1,250 @@
+package gokomoot
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Field numbers of the Track message in track.proto
+const (
+	protoFieldName = 1
+	protoFieldLat  = 2
+	protoFieldLon  = 3
+	protoFieldEle  = 4
+	protoFieldTime = 5
+)
+
+// Protobuf wire types used by the Track message
+const (
+	protoWireVarint = 0
+	protoWire64Bit  = 1
+	protoWireBytes  = 2
+	protoWire32Bit  = 5
+)
+
+// writeProtobuf encodes the points of the first track as a Track message
+// (see track.proto) with packed coordinate fields
+func writeProtobuf(gpx *GPX, w io.Writer) error {
+	var points []Point
+	name := ""
+	if len(gpx.Tracks) > 0 {
+		name = gpx.Tracks[0].Name
+		for _, segment := range gpx.Tracks[0].Segments {
+			points = append(points, segment.Points...)
+		}
+	}
+	if name == "" && gpx.Metadata != nil {
+		name = gpx.Metadata.Name
+	}
+
+	var buf []byte
+	if name != "" {
+		buf = protoAppendTag(buf, protoFieldName, protoWireBytes)
+		buf = binary.AppendUvarint(buf, uint64(len(name)))
+		buf = append(buf, name...)
+	}
+	buf = protoAppendPackedDoubles(buf, protoFieldLat, points, func(p Point) float64 { return p.Lat })
+	buf = protoAppendPackedDoubles(buf, protoFieldLon, points, func(p Point) float64 { return p.Lon })
+	if hasElevation(points) {
+		buf = protoAppendPackedDoubles(buf, protoFieldEle, points, func(p Point) float64 { return p.Elevation })
+	}
+	buf = protoAppendPackedTimes(buf, protoFieldTime, points)
+
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("error writing protobuf: %w", err)
+	}
+	return nil
+}
+
+func protoAppendTag(buf []byte, field, wireType int) []byte {
+	return binary.AppendUvarint(buf, uint64(field)<<3|uint64(wireType))
+}
+
+func protoAppendPackedDoubles(buf []byte, field int, points []Point, value func(Point) float64) []byte {
+	if len(points) == 0 {
+		return buf
+	}
+	buf = protoAppendTag(buf, field, protoWireBytes)
+	buf = binary.AppendUvarint(buf, uint64(8*len(points)))
+	for _, point := range points {
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(value(point)))
+	}
+	return buf
+}
+
+// protoAppendPackedTimes appends the point times as packed zigzag-encoded
+// Unix milliseconds, or nothing unless every point has a time
+func protoAppendPackedTimes(buf []byte, field int, points []Point) []byte {
+	var packed []byte
+	for _, point := range points {
+		if point.Time == nil {
+			return buf
+		}
+		packed = binary.AppendVarint(packed, point.Time.UnixMilli())
+	}
+	if len(packed) == 0 {
+		return buf
+	}
+	buf = protoAppendTag(buf, field, protoWireBytes)
+	buf = binary.AppendUvarint(buf, uint64(len(packed)))
+	return append(buf, packed...)
+}
+
+// DecodeProtobuf decodes a Track message written by writeProtobuf into a GPX
+// with a single track and segment. Unknown fields are skipped.
+func DecodeProtobuf(data []byte) (*GPX, error) {
+	var name string
+	var lats, lons, eles []float64
+	var times []int64
+
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errors.New("invalid protobuf field key")
+		}
+		data = data[n:]
+		field, wireType := int(key>>3), int(key&7)
+
+		var err error
+		switch {
+		case field == protoFieldName && wireType == protoWireBytes:
+			var value []byte
+			value, data, err = protoReadBytes(data)
+			name = string(value)
+		case field == protoFieldLat:
+			lats, data, err = protoReadDoubles(lats, data, wireType)
+		case field == protoFieldLon:
+			lons, data, err = protoReadDoubles(lons, data, wireType)
+		case field == protoFieldEle:
+			eles, data, err = protoReadDoubles(eles, data, wireType)
+		case field == protoFieldTime:
+			times, data, err = protoReadSint64s(times, data, wireType)
+		default:
+			data, err = protoSkip(data, wireType)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("field %d: %w", field, err)
+		}
+	}
+
+	if len(lats) != len(lons) || (len(eles) != 0 && len(eles) != len(lats)) || (len(times) != 0 && len(times) != len(lats)) {
+		return nil, fmt.Errorf("mismatched point fields: %d lat, %d lon, %d ele, %d time", len(lats), len(lons), len(eles), len(times))
+	}
+
+	points := make([]Point, len(lats))
+	for i := range points {
+		points[i] = Point{Lat: lats[i], Lon: lons[i]}
+		if len(eles) > 0 {
+			points[i].Elevation = eles[i]
+		} else {
+			points[i].NoElevation = true
+		}
+		if len(times) > 0 {
+			pointTime := time.UnixMilli(times[i]).UTC()
+			points[i].Time = &pointTime
+		}
+	}
+
+	gpx := &GPX{
+		XMLNS:          GPXNamespace,
+		XMLNSXSI:       XSINamespace,
+		SchemaLocation: GPXSchemaLocation,
+		Version:        "1.1",
+		Tracks:         []Track{{Name: name, Segments: []Segment{{Points: points}}}},
+	}
+	if name != "" {
+		gpx.Metadata = &Metadata{Name: name}
+	}
+	return gpx, nil
+}
+
+func protoReadBytes(data []byte) (value, rest []byte, err error) {
+	length, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < length {
+		return nil, nil, errors.New("truncated length-delimited field")
+	}
+	return data[n : n+int(length)], data[n+int(length):], nil
+}
+
+// protoReadDoubles reads a packed or unpacked repeated double field
+func protoReadDoubles(values []float64, data []byte, wireType int) ([]float64, []byte, error) {
+	switch wireType {
+	case protoWire64Bit:
+		if len(data) < 8 {
+			return nil, nil, errors.New("truncated double")
+		}
+		return append(values, math.Float64frombits(binary.LittleEndian.Uint64(data))), data[8:], nil
+	case protoWireBytes:
+		packed, rest, err := protoReadBytes(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(packed)%8 != 0 {
+			return nil, nil, errors.New("packed doubles length is not a multiple of 8")
+		}
+		for i := 0; i < len(packed); i += 8 {
+			values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(packed[i:])))
+		}
+		return values, rest, nil
+	default:
+		return nil, nil, fmt.Errorf("unexpected wire type %d for double", wireType)
+	}
+}
+
+// protoReadSint64s reads a packed or unpacked repeated sint64 field
+func protoReadSint64s(values []int64, data []byte, wireType int) ([]int64, []byte, error) {
+	switch wireType {
+	case protoWireVarint:
+		value, n := binary.Varint(data)
+		if n <= 0 {
+			return nil, nil, errors.New("truncated varint")
+		}
+		return append(values, value), data[n:], nil
+	case protoWireBytes:
+		packed, rest, err := protoReadBytes(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		for len(packed) > 0 {
+			value, n := binary.Varint(packed)
+			if n <= 0 {
+				return nil, nil, errors.New("truncated packed varint")
+			}
+			values = append(values, value)
+			packed = packed[n:]
+		}
+		return values, rest, nil
+	default:
+		return nil, nil, fmt.Errorf("unexpected wire type %d for sint64", wireType)
+	}
+}
+
+func protoSkip(data []byte, wireType int) ([]byte, error) {
+	switch wireType {
+	case protoWireVarint:
+		_, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errors.New("truncated varint")
+		}
+		return data[n:], nil
+	case protoWire64Bit:
+		if len(data) < 8 {
+			return nil, errors.New("truncated 64-bit value")
+		}
+		return data[8:], nil
+	case protoWireBytes:
+		_, rest, err := protoReadBytes(data)
+		return rest, err
+	case protoWire32Bit:
+		if len(data) < 4 {
+			return nil, errors.New("truncated 32-bit value")
+		}
+		return data[4:], nil
+	default:
+		return nil, fmt.Errorf("unsupported wire type %d", wireType)
+	}
+}
@@ -0,0 +1,135 @@
+package gokomoot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProtobufRoundTrip(t *testing.T) {
+	gpx := &GPX{Tracks: []Track{{Name: "Tour", Segments: []Segment{
+		{Points: []Point{{Lat: 52.516839, Lon: 13.25041, Elevation: 50.4}}},
+		{Points: []Point{{Lat: -33.8688, Lon: 151.2093, Elevation: -1}}},
+	}}}}
+
+	var buf bytes.Buffer
+	if err := writeProtobuf(gpx, &buf); err != nil {
+		t.Fatalf("writeProtobuf() error = %v", err)
+	}
+	decoded, err := DecodeProtobuf(buf.Bytes())
+	if err != nil {
+		t.Fatalf("DecodeProtobuf() error = %v", err)
+	}
+
+	if decoded.Tracks[0].Name != "Tour" || decoded.Metadata == nil || decoded.Metadata.Name != "Tour" {
+		t.Fatalf("DecodeProtobuf() name = %#v, want Tour", decoded.Tracks[0].Name)
+	}
+	got := decoded.allPoints()
+	want := gpx.allPoints()
+	if len(got) != len(want) {
+		t.Fatalf("DecodeProtobuf() point count = %d, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("DecodeProtobuf() point %d = %#v, want %#v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestWriteProtobufWireFormat(t *testing.T) {
+	gpx := &GPX{Tracks: []Track{{Name: "A", Segments: []Segment{{Points: []Point{{Lat: 1, Lon: 2, Elevation: 3}}}}}}}
+
+	var buf bytes.Buffer
+	if err := writeProtobuf(gpx, &buf); err != nil {
+		t.Fatalf("writeProtobuf() error = %v", err)
+	}
+
+	// name: field 1, length 1; lat/lon/ele: fields 2-4, packed, 8 bytes each.
+	want := []byte{0x0a, 0x01, 'A'}
+	for field, value := range []float64{1, 2, 3} {
+		want = append(want, byte((field+2)<<3|2), 0x08)
+		want = binary.LittleEndian.AppendUint64(want, math.Float64bits(value))
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("writeProtobuf() = % x, want % x", buf.Bytes(), want)
+	}
+}
+
+func TestDecodeProtobufAcceptsUnpackedAndUnknownFields(t *testing.T) {
+	var data []byte
+	data = append(data, 0x11) // lat, unpacked double
+	data = binary.LittleEndian.AppendUint64(data, math.Float64bits(46.5))
+	data = append(data, 0x19) // lon, unpacked double
+	data = binary.LittleEndian.AppendUint64(data, math.Float64bits(8.1))
+	data = append(data, 0x28, 0x02) // time_ms, unpacked zigzag varint 1
+	data = append(data, 0x50, 0x07) // unknown field 10 varint
+
+	gpx, err := DecodeProtobuf(data)
+	if err != nil {
+		t.Fatalf("DecodeProtobuf() error = %v", err)
+	}
+	points := gpx.allPoints()
+	if len(points) != 1 || points[0].Lat != 46.5 || points[0].Lon != 8.1 || points[0].Elevation != 0 {
+		t.Fatalf("DecodeProtobuf() points = %#v", points)
+	}
+	if points[0].Time == nil || points[0].Time.UnixMilli() != 1 {
+		t.Fatalf("DecodeProtobuf() time = %v, want 1 ms after the epoch", points[0].Time)
+	}
+}
+
+func TestProtobufRoundTripsPointTimes(t *testing.T) {
+	start := time.Date(2021, 6, 5, 7, 30, 0, 0, time.UTC)
+	later := start.Add(1500 * time.Millisecond)
+	gpx := &GPX{Tracks: []Track{{Segments: []Segment{{Points: []Point{
+		{Lat: 1, Lon: 2, Time: &start},
+		{Lat: 1.001, Lon: 2, Time: &later},
+	}}}}}}
+
+	var buf bytes.Buffer
+	if err := writeProtobuf(gpx, &buf); err != nil {
+		t.Fatalf("writeProtobuf() error = %v", err)
+	}
+	decoded, err := DecodeProtobuf(buf.Bytes())
+	if err != nil {
+		t.Fatalf("DecodeProtobuf() error = %v", err)
+	}
+	for i, point := range decoded.allPoints() {
+		want := gpx.allPoints()[i].Time
+		if point.Time == nil || !point.Time.Equal(*want) {
+			t.Fatalf("DecodeProtobuf() point %d time = %v, want %v", i, point.Time, want)
+		}
+	}
+}
+
+func TestWriteProtobufOmitsPartialTimes(t *testing.T) {
+	start := time.Date(2021, 6, 5, 7, 30, 0, 0, time.UTC)
+	gpx := &GPX{Tracks: []Track{{Segments: []Segment{{Points: []Point{
+		{Lat: 1, Lon: 2, Time: &start},
+		{Lat: 1.001, Lon: 2},
+	}}}}}}
+
+	var buf bytes.Buffer
+	if err := writeProtobuf(gpx, &buf); err != nil {
+		t.Fatalf("writeProtobuf() error = %v", err)
+	}
+	decoded, err := DecodeProtobuf(buf.Bytes())
+	if err != nil {
+		t.Fatalf("DecodeProtobuf() error = %v", err)
+	}
+	if point := decoded.allPoints()[0]; point.Time != nil {
+		t.Fatalf("DecodeProtobuf() time = %v, want none when some points lack times", point.Time)
+	}
+}
+
+func TestDecodeProtobufRejectsMismatchedFields(t *testing.T) {
+	data := []byte{0x12, 0x08}
+	data = binary.LittleEndian.AppendUint64(data, math.Float64bits(46.5))
+
+	_, err := DecodeProtobuf(data)
+	if err == nil || !strings.Contains(err.Error(), "mismatched point fields") {
+		t.Fatalf("DecodeProtobuf() error = %v, want mismatched point fields", err)
+	}
+}
@@ -0,0 +1,90 @@
+package gokomoot
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket holding a single token, refilled every
+// interval. Every request of a Converter takes a token, so concurrent workers
+// together stay within the rate and requests are spread out evenly rather
+// than sent in bursts.
+type rateLimiter struct {
+	interval time.Duration
+
+	mu sync.Mutex
+	// next is when the next token is available
+	next time.Time
+}
+
+// newRateLimiter returns a limiter allowing perSecond requests per second, or
+// nil for no limit when perSecond isn't positive
+func newRateLimiter(perSecond float64) *rateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// reserve takes the next token and returns how long after now it becomes
+// available. A nil limiter never makes requests wait.
+func (l *rateLimiter) reserve(now time.Time) time.Duration {
+	if l == nil {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	return wait
+}
+
+// hostLimiter bounds how many requests to the same host are in flight at a
+// time, across all workers of a Converter, so a batch doesn't open more
+// connections to one host than it allows
+type hostLimiter struct {
+	limit int
+
+	mu sync.Mutex
+	// slots holds a semaphore per host
+	slots map[string]chan struct{}
+}
+
+// newHostLimiter returns a limiter allowing perHost requests to each host at
+// a time, or nil for no limit when perHost isn't positive
+func newHostLimiter(perHost int) *hostLimiter {
+	if perHost <= 0 {
+		return nil
+	}
+	return &hostLimiter{limit: perHost, slots: map[string]chan struct{}{}}
+}
+
+// acquire waits until a request to host may be made and returns the function
+// that ends it. A nil limiter never makes requests wait.
+func (l *hostLimiter) acquire(ctx context.Context, host string) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	l.mu.Lock()
+	host = strings.ToLower(host)
+	slots, ok := l.slots[host]
+	if !ok {
+		slots = make(chan struct{}, l.limit)
+		l.slots[host] = slots
+	}
+	l.mu.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
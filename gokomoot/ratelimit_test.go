@@ -0,0 +1,101 @@
+package gokomoot
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	limiter := newRateLimiter(4)
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+
+	// Three requests at once are spread 250 ms apart; one after the bucket
+	// has refilled doesn't wait.
+	for i, want := range []time.Duration{0, 250 * time.Millisecond, 500 * time.Millisecond} {
+		if got := limiter.reserve(now); got != want {
+			t.Fatalf("reserve() %d = %v, want %v", i, got, want)
+		}
+	}
+	if got := limiter.reserve(now.Add(time.Second)); got != 0 {
+		t.Fatalf("reserve() after a second = %v, want 0", got)
+	}
+
+	if newRateLimiter(0) != nil {
+		t.Fatal("newRateLimiter(0) != nil, want no limit")
+	}
+	var unlimited *rateLimiter
+	if got := unlimited.reserve(now); got != 0 {
+		t.Fatalf("nil reserve() = %v, want 0", got)
+	}
+}
+
+func TestRequestsPerSecondIsSharedByConcurrentRequests(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.Verbosity = VerbosityQuiet
+	config.RequestsPerSecond = 50
+	converter := NewConverter(config)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := converter.makeHTTPRequest(context.Background(), server.URL); err != nil {
+				t.Errorf("makeHTTPRequest() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// At 50 per second the last of five requests waits 80 ms.
+	if requests != 5 {
+		t.Fatalf("server got %d requests, want 5", requests)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Fatalf("requests took %v, want at least 80ms", elapsed)
+	}
+}
+
+func TestHostLimiterAcquire(t *testing.T) {
+	limiter := newHostLimiter(1)
+	release, err := limiter.acquire(context.Background(), "www.komoot.com")
+	if err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+
+	// Another host has its own slot, while the busy host makes requests wait
+	if _, err := limiter.acquire(context.Background(), "api.komoot.de"); err != nil {
+		t.Fatalf("acquire() for another host error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.acquire(ctx, "WWW.komoot.com"); err != context.DeadlineExceeded {
+		t.Fatalf("acquire() for a busy host error = %v, want context.DeadlineExceeded", err)
+	}
+	release()
+	if _, err := limiter.acquire(context.Background(), "www.komoot.com"); err != nil {
+		t.Fatalf("acquire() after release error = %v", err)
+	}
+
+	if newHostLimiter(0) != nil {
+		t.Fatal("newHostLimiter(0) != nil, want no limit")
+	}
+	var unlimited *hostLimiter
+	if _, err := unlimited.acquire(context.Background(), "www.komoot.com"); err != nil {
+		t.Fatalf("nil limiter acquire() error = %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package gokomoot
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+// Round-trip verification tolerances. The encoder writes the shortest exact
+// float representation, so anything beyond these means a real encoder bug.
+const (
+	roundTripDegreeTolerance    = 1e-7 // about 1 cm
+	roundTripElevationTolerance = 1e-3 // 1 mm
+)
+
+// gpx10Header holds the document-level fields GPX 1.0 puts directly under
+// <gpx>, where GPX 1.1 nests them in <metadata>
+type gpx10Header struct {
+	XMLName  xml.Name   `xml:"gpx"`
+	Name     string     `xml:"name"`
+	Time     *time.Time `xml:"time"`
+	Keywords string     `xml:"keywords"`
+}
+
+// ReadGPX decodes a GPX 1.1 document into the GPX model and validates the
+// coordinates of every point. Elevations are kept as they are, even outside
+// the range Point.Validate accepts, such as those of a flight. GPX 1.0
+// documents are accepted too: their top-level name, time and keywords are
+// moved into the metadata. The result is always marked as GPX 1.1, the
+// version the encoders write.
+func ReadGPX(r io.Reader) (*GPX, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading GPX: %w", err)
+	}
+
+	var gpx GPX
+	if err := xml.Unmarshal(content, &gpx); err != nil {
+		return nil, fmt.Errorf("error decoding GPX: %w", err)
+	}
+
+	if gpx.Version == "1.0" || gpx.XMLName.Space == GPXNamespace10 {
+		var header gpx10Header
+		if err := xml.Unmarshal(content, &header); err != nil {
+			return nil, fmt.Errorf("error decoding GPX 1.0 header: %w", err)
+		}
+		if gpx.Metadata == nil && (header.Name != "" || header.Time != nil || header.Keywords != "") {
+			gpx.Metadata = &Metadata{Name: header.Name, Time: header.Time, Keywords: header.Keywords}
+		}
+	}
+
+	index := 0
+	var validationErr error
+	gpx.eachPoint(func(p *Point) {
+		if err := p.validateCoordinates(); err != nil && validationErr == nil {
+			validationErr = fmt.Errorf("invalid point %d: %w", index, err)
+		}
+		index++
+	})
+	if validationErr != nil {
+		return nil, validationErr
+	}
+
+	gpx.XMLName = xml.Name{}
+	gpx.XMLNS = GPXNamespace
+	gpx.XMLNSXSI = XSINamespace
+	gpx.SchemaLocation = GPXSchemaLocation
+	gpx.Version = "1.1"
+	return &gpx, nil
+}
+
+// verifyRoundTrip re-reads the GPX file at filename and checks that it holds
+// the same points as want
+func verifyRoundTrip(want *GPX, filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("error opening GPX file: %w", err)
+	}
+	defer file.Close()
+
+	got, err := ReadGPX(file)
+	if err != nil {
+		return err
+	}
+
+	wantPoints, gotPoints := want.allPoints(), got.allPoints()
+	if len(gotPoints) != len(wantPoints) {
+		return fmt.Errorf("point count mismatch: wrote %d, read back %d", len(wantPoints), len(gotPoints))
+	}
+	for i := range wantPoints {
+		w, g := wantPoints[i], gotPoints[i]
+		if math.Abs(w.Lat-g.Lat) > roundTripDegreeTolerance ||
+			math.Abs(w.Lon-g.Lon) > roundTripDegreeTolerance ||
+			w.NoElevation != g.NoElevation ||
+			(!w.NoElevation && math.Abs(w.Elevation-g.Elevation) > roundTripElevationTolerance) {
+			return fmt.Errorf("point %d mismatch: wrote (%v, %v, %v), read back (%v, %v, %v)",
+				i, w.Lat, w.Lon, w.Elevation, g.Lat, g.Lon, g.Elevation)
+		}
+	}
+	return nil
+}
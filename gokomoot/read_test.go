@@ -0,0 +1,199 @@
+package gokomoot
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadGPXRoundTripsWrittenFile(t *testing.T) {
+	recorded := time.Date(2021, 6, 5, 7, 30, 0, 0, time.UTC)
+	want := &GPX{
+		XMLNS:    "http://www.topografix.com/GPX/1/1",
+		Version:  "1.1",
+		Creator:  "komootgpx",
+		Metadata: &Metadata{Name: "Tour", Time: &recorded, Keywords: "hike"},
+		Tracks: []Track{{Name: "Tour", Segments: []Segment{
+			{Points: []Point{{Lat: 52.516839, Lon: 13.25041, Elevation: 50.4}}},
+			{Points: []Point{{Lat: 52.5, Lon: 13.4, Elevation: 0}}},
+		}}},
+	}
+
+	var buf bytes.Buffer
+	if err := encodeGPX(want, &buf); err != nil {
+		t.Fatalf("encodeGPX() error = %v", err)
+	}
+	got, err := ReadGPX(&buf)
+	if err != nil {
+		t.Fatalf("ReadGPX() error = %v", err)
+	}
+
+	if got.Version != "1.1" || got.Creator != "komootgpx" {
+		t.Fatalf("ReadGPX() root = %q %q, want 1.1 komootgpx", got.Version, got.Creator)
+	}
+	if got.Metadata == nil || got.Metadata.Name != "Tour" || !got.Metadata.Time.Equal(recorded) || got.Metadata.Keywords != "hike" {
+		t.Fatalf("ReadGPX() metadata = %#v, want %#v", got.Metadata, want.Metadata)
+	}
+	if len(got.Tracks) != 1 || len(got.Tracks[0].Segments) != 2 {
+		t.Fatalf("ReadGPX() tracks = %#v, want one track with two segments", got.Tracks)
+	}
+	if got.Tracks[0].Segments[0].Points[0] != want.Tracks[0].Segments[0].Points[0] {
+		t.Fatalf("ReadGPX() first point = %#v", got.Tracks[0].Segments[0].Points[0])
+	}
+}
+
+func TestReadGPXAcceptsGPX10(t *testing.T) {
+	content := `<?xml version="1.0"?>
+<gpx version="1.0" creator="old" xmlns="http://www.topografix.com/GPX/1/0">
+  <name>Legacy</name>
+  <time>2004-05-06T07:08:09Z</time>
+  <trk><name>Legacy</name><trkseg>
+    <trkpt lat="46.5" lon="8.1"><ele>1200</ele><time>2004-05-06T07:08:09Z</time><speed>1.5</speed></trkpt>
+  </trkseg></trk>
+</gpx>`
+
+	gpx, err := ReadGPX(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("ReadGPX() error = %v", err)
+	}
+	if gpx.Version != "1.1" || gpx.XMLNS != "http://www.topografix.com/GPX/1/1" {
+		t.Fatalf("ReadGPX() version = %q %q, want GPX 1.1", gpx.Version, gpx.XMLNS)
+	}
+	if gpx.Metadata == nil || gpx.Metadata.Name != "Legacy" || gpx.Metadata.Time == nil {
+		t.Fatalf("ReadGPX() metadata = %#v, want name and time from GPX 1.0 header", gpx.Metadata)
+	}
+	points := gpx.allPoints()
+	if len(points) != 1 || points[0].Lat != 46.5 || points[0].Lon != 8.1 || points[0].Elevation != 1200 {
+		t.Fatalf("ReadGPX() points = %#v", points)
+	}
+	if want := time.Date(2004, 5, 6, 7, 8, 9, 0, time.UTC); points[0].Time == nil || !points[0].Time.Equal(want) {
+		t.Fatalf("ReadGPX() point time = %v, want %v", points[0].Time, want)
+	}
+}
+
+func TestReadGPXMarksPointsWithoutElevation(t *testing.T) {
+	content := `<gpx version="1.1" xmlns="http://www.topografix.com/GPX/1/1"><trk><trkseg>
+<trkpt lat="1" lon="2"></trkpt><trkpt lat="1" lon="3"><ele>0</ele></trkpt>
+</trkseg></trk></gpx>`
+
+	gpx, err := ReadGPX(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("ReadGPX() error = %v", err)
+	}
+	points := gpx.Tracks[0].Segments[0].Points
+	if !points[0].NoElevation || points[1].NoElevation {
+		t.Fatalf("points = %#v, want only the first without elevation", points)
+	}
+}
+
+func TestReadGPXRejectsInvalidPoints(t *testing.T) {
+	content := `<gpx version="1.1" xmlns="http://www.topografix.com/GPX/1/1"><trk><trkseg>
+<trkpt lat="1" lon="2"></trkpt><trkpt lat="1" lon="200"></trkpt>
+</trkseg></trk></gpx>`
+
+	_, err := ReadGPX(strings.NewReader(content))
+	if err == nil || !strings.Contains(err.Error(), "invalid point 1: invalid longitude") {
+		t.Fatalf("ReadGPX() error = %v, want invalid point 1 error", err)
+	}
+}
+
+func TestReadGPXKeepsHighElevations(t *testing.T) {
+	content := `<gpx version="1.1" xmlns="http://www.topografix.com/GPX/1/1"><trk><trkseg>
+<trkpt lat="1" lon="2"><ele>11000</ele></trkpt>
+</trkseg></trk></gpx>`
+
+	gpx, err := ReadGPX(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("ReadGPX() error = %v", err)
+	}
+	if point := gpx.Tracks[0].Segments[0].Points[0]; point.NoElevation || point.Elevation != 11000 {
+		t.Fatalf("point = %#v, want the 11000 m elevation kept", point)
+	}
+}
+
+func TestVerifyRoundTrip(t *testing.T) {
+	gpx := &GPX{
+		XMLNS:   "http://www.topografix.com/GPX/1/1",
+		Version: "1.1",
+		Tracks: []Track{{Name: "Tour", Segments: []Segment{{Points: []Point{
+			{Lat: 52.516839, Lon: 13.25041, Elevation: 50.4},
+			{Lat: -33.8688197, Lon: 151.2092955, Elevation: -0.25},
+		}}}}},
+	}
+	outputPath := filepath.Join(t.TempDir(), "route.gpx")
+	if err := NewConverter(DefaultConfig()).writeOutput(context.Background(), gpx, outputPath); err != nil {
+		t.Fatalf("writeOutput() error = %v", err)
+	}
+
+	if err := verifyRoundTrip(gpx, outputPath); err != nil {
+		t.Fatalf("verifyRoundTrip() error = %v", err)
+	}
+
+	gpx.Tracks[0].Segments[0].Points[1].Lon += 0.001
+	err := verifyRoundTrip(gpx, outputPath)
+	if err == nil || !strings.Contains(err.Error(), "point 1 mismatch") {
+		t.Fatalf("verifyRoundTrip() error = %v, want point 1 mismatch", err)
+	}
+}
+
+func TestVerifyRoundTripDetectsMissingPoints(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "route.gpx")
+	content := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx xmlns="http://www.topografix.com/GPX/1/1" version="1.1"><trk><trkseg><trkpt lat="1" lon="2"></trkpt></trkseg></trk></gpx>`
+	if err := os.WriteFile(outputPath, []byte(content), 0o644); err != nil {
+		t.Fatalf("os.WriteFile() error = %v", err)
+	}
+
+	gpx := &GPX{Tracks: []Track{{Segments: []Segment{{Points: []Point{{Lat: 1, Lon: 2}, {Lat: 3, Lon: 4}}}}}}}
+	err := verifyRoundTrip(gpx, outputPath)
+	if err == nil || !strings.Contains(err.Error(), "wrote 2, read back 1") {
+		t.Fatalf("verifyRoundTrip() error = %v, want point count mismatch", err)
+	}
+}
+
+func TestConvertGPXAppliesTransformations(t *testing.T) {
+	content := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx xmlns="http://www.topografix.com/GPX/1/1" version="1.1" creator="other">
+  <trk><name>Evening ride</name><trkseg>
+    <trkpt lat="47.0" lon="8.0"><ele>400</ele></trkpt>
+    <trkpt lat="47.001" lon="8.0"><ele>401</ele></trkpt>
+    <trkpt lat="47.002" lon="8.0"><ele>402</ele></trkpt>
+    <trkpt lat="47.003" lon="8.0"><ele>403</ele></trkpt>
+  </trkseg></trk>
+</gpx>`
+	outputPath := filepath.Join(t.TempDir(), "route.gpx")
+	config := DefaultConfig()
+	config.SimplifyTolerance = 1
+	config.Name = "Renamed"
+	if err := NewConverter(config).ConvertGPX(context.Background(), strings.NewReader(content), outputPath); err != nil {
+		t.Fatalf("ConvertGPX() error = %v", err)
+	}
+
+	file, err := os.Open(outputPath)
+	if err != nil {
+		t.Fatalf("os.Open() error = %v", err)
+	}
+	defer file.Close()
+	got, err := ReadGPX(file)
+	if err != nil {
+		t.Fatalf("ReadGPX() error = %v", err)
+	}
+	if points := got.Tracks[0].Segments[0].Points; len(points) != 2 {
+		t.Fatalf("ConvertGPX() wrote %d points, want the straight line simplified to 2", len(points))
+	}
+	if got.Metadata == nil || got.Metadata.Name != "Renamed" || got.Tracks[0].Name != "Renamed" {
+		t.Fatalf("ConvertGPX() names = %#v %q, want Renamed", got.Metadata, got.Tracks[0].Name)
+	}
+}
+
+func TestConvertGPXRejectsEmptyInput(t *testing.T) {
+	content := `<gpx xmlns="http://www.topografix.com/GPX/1/1" version="1.1"><wpt lat="1" lon="2"></wpt></gpx>`
+	err := NewConverter(DefaultConfig()).ConvertGPX(context.Background(), strings.NewReader(content), filepath.Join(t.TempDir(), "route.gpx"))
+	if err == nil || !strings.Contains(err.Error(), "no track points") {
+		t.Fatalf("ConvertGPX() error = %v, want no track points error", err)
+	}
+}
@@ -0,0 +1,60 @@
+package gokomoot
+
+// Reporter receives progress events from a Converter, for callers that show
+// progress in their own UI rather than reading log lines. ConvertBatch
+// converts tours concurrently, so its events may arrive from several
+// goroutines at once and implementations must be safe for concurrent use.
+type Reporter interface {
+	// OnDownloadStart is called before the tour at url is fetched
+	OnDownloadStart(url string)
+	// OnParsed is called once the tour data has been converted, with the
+	// number of track points before any transformations
+	OnParsed(pointCount int)
+	// OnWritten is called after each output destination has been written
+	OnWritten(path string)
+	// OnTourDone is called by ConvertBatch as each tour finishes, with the
+	// tour's URL, how many tours of total are done and the tour's error, if
+	// it failed
+	OnTourDone(url string, done, total int, err error)
+}
+
+// NopReporter ignores every event. Embed it to implement only some of the
+// Reporter methods.
+type NopReporter struct{}
+
+// OnDownloadStart implements Reporter
+func (NopReporter) OnDownloadStart(url string) {}
+
+// OnParsed implements Reporter
+func (NopReporter) OnParsed(pointCount int) {}
+
+// OnWritten implements Reporter
+func (NopReporter) OnWritten(path string) {}
+
+// OnTourDone implements Reporter
+func (NopReporter) OnTourDone(url string, done, total int, err error) {}
+
+// logReporter is the default Reporter, logging events as progress messages
+type logReporter struct {
+	logger *leveledLogger
+}
+
+func (r logReporter) OnDownloadStart(url string) {
+	r.logger.Printf("Downloading tour data from %s\n", url)
+}
+
+func (r logReporter) OnParsed(pointCount int) {
+	r.logger.Verbosef("Parsed %d track points\n", pointCount)
+}
+
+func (r logReporter) OnWritten(path string) {
+	r.logger.Printf("Successfully created file: %s\n", path)
+}
+
+func (r logReporter) OnTourDone(url string, done, total int, err error) {
+	status := "done"
+	if err != nil {
+		status = "failed"
+	}
+	r.logger.Verbosef("Tour %d of %d %s: %s\n", done, total, status, url)
+}
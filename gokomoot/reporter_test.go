@@ -0,0 +1,91 @@
+package gokomoot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type recordingReporter struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recordingReporter) record(format string, v ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, fmt.Sprintf(format, v...))
+}
+
+func (r *recordingReporter) OnDownloadStart(url string) { r.record("download %s", url) }
+func (r *recordingReporter) OnParsed(pointCount int)    { r.record("parsed %d", pointCount) }
+func (r *recordingReporter) OnWritten(path string)      { r.record("written %s", path) }
+func (r *recordingReporter) OnTourDone(url string, done, total int, err error) {
+	r.record("done %d/%d %s failed=%t", done, total, url, err != nil)
+}
+
+func TestConvertBatchReportsPerTourEvents(t *testing.T) {
+	page := tourPageHTML(t, `{"page":{"_embedded":{"tour":{"id":1,"name":"Loop","_embedded":{"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35},{"lat":51.501,"lng":-0.12,"alt":36}]}}}}}}`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tour/1" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, page)
+	}))
+	defer server.Close()
+
+	reporter := &recordingReporter{}
+	var logs bytes.Buffer
+	config := DefaultConfig()
+	config.APIBaseURL = server.URL
+	config.RetryInterval = 0
+	config.MaxRetries = 1
+	config.Concurrency = 1
+	config.Reporter = reporter
+	config.Logger = log.New(&logs, "", 0)
+	outputDir := t.TempDir()
+	urls := []string{server.URL + "/tour/1", server.URL + "/tour/2"}
+
+	written, _ := NewConverter(config).ConvertBatch(context.Background(), urls, outputDir)
+	if len(written) != 1 {
+		t.Fatalf("ConvertBatch() = %v, want one file", written)
+	}
+
+	want := []string{
+		"download " + urls[0],
+		"parsed 2",
+		"written " + written[0],
+		"done 1/2 " + urls[0] + " failed=false",
+		"download " + urls[1],
+		"done 2/2 " + urls[1] + " failed=true",
+	}
+	if !slices.Equal(reporter.events, want) {
+		t.Fatalf("events = %q, want %q", reporter.events, want)
+	}
+	if strings.Contains(logs.String(), "Successfully created file") {
+		t.Fatalf("logs = %q, want written events to go to the reporter only", logs.String())
+	}
+}
+
+func TestDefaultReporterLogs(t *testing.T) {
+	var logs bytes.Buffer
+	config := DefaultConfig()
+	config.Logger = log.New(&logs, "", 0)
+	converter := NewConverter(config)
+
+	converter.reporter.OnDownloadStart("https://www.komoot.com/tour/1")
+	converter.reporter.OnWritten("tour.gpx")
+	for _, want := range []string{"Downloading tour data from https://www.komoot.com/tour/1", "Successfully created file: tour.gpx"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Fatalf("logs = %q, want %q", logs.String(), want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package gokomoot
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// ErrRetryBudgetExhausted is wrapped by the error of a request that wasn't
+// retried because Configuration.RetryBudget was used up
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// retryBudget counts the retries left for all requests of a Converter
+type retryBudget struct {
+	left atomic.Int64
+}
+
+// newRetryBudget returns a budget of n retries, or nil for no limit when n
+// isn't positive
+func newRetryBudget(n int) *retryBudget {
+	if n <= 0 {
+		return nil
+	}
+	budget := &retryBudget{}
+	budget.left.Store(int64(n))
+	return budget
+}
+
+// take draws one retry from the budget and reports whether one was left. A
+// nil budget always has retries left.
+func (b *retryBudget) take() bool {
+	return b == nil || b.left.Add(-1) >= 0
+}
+
+// backoff returns the wait before the given retry (1 for the first retry):
+// RetryInterval doubled for every earlier retry and capped at MaxBackoff,
+// with equal jitter so concurrent clients don't retry in lockstep
+func (c *Converter) backoff(retry int) time.Duration {
+	wait := c.config.RetryInterval
+	for i := 1; i < retry && (c.config.MaxBackoff <= 0 || wait < c.config.MaxBackoff); i++ {
+		wait *= 2
+	}
+	wait = c.capBackoff(wait)
+	if wait <= 1 {
+		return wait
+	}
+
+	half := wait / 2
+	return half + rand.N(half+1)
+}
+
+// capBackoff limits wait to MaxBackoff when it is set
+func (c *Converter) capBackoff(wait time.Duration) time.Duration {
+	if c.config.MaxBackoff > 0 && wait > c.config.MaxBackoff {
+		return c.config.MaxBackoff
+	}
+	return wait
+}
+
+// retryAfter returns the wait a 429 or 503 response asks for in its
+// Retry-After header, given either in seconds or as an HTTP date
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,218 @@
+package gokomoot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestBackoffDoublesAndCaps(t *testing.T) {
+	config := DefaultConfig()
+	config.RetryInterval = time.Second
+	config.MaxBackoff = 5 * time.Second
+	converter := NewConverter(config)
+
+	for retry, base := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		for range 20 {
+			if got := converter.backoff(retry); got < base/2 || got > base {
+				t.Fatalf("backoff(%d) = %s, want between %s and %s", retry, got, base/2, base)
+			}
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		status int
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{http.StatusTooManyRequests, "7", 7 * time.Second, true},
+		{http.StatusServiceUnavailable, "Fri, 01 Mar 2024 12:00:30 GMT", 30 * time.Second, true},
+		{http.StatusServiceUnavailable, "Fri, 01 Mar 2024 11:00:00 GMT", 0, true},
+		{http.StatusTooManyRequests, "soon", 0, false},
+		{http.StatusTooManyRequests, "", 0, false},
+		{http.StatusInternalServerError, "7", 0, false},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+		if tt.header != "" {
+			resp.Header.Set("Retry-After", tt.header)
+		}
+		got, ok := retryAfter(resp, now)
+		if got != tt.want || ok != tt.ok {
+			t.Fatalf("retryAfter(%d, %q) = %s, %t, want %s, %t", tt.status, tt.header, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMakeHTTPRequestHonorsRetryAfter(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "120")
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	var waits []time.Duration
+	config := DefaultConfig()
+	config.RetryInterval = 0
+	config.MaxBackoff = 5 * time.Millisecond
+	config.OnRetry = func(attempt int, err error, next time.Duration) {
+		waits = append(waits, next)
+	}
+
+	if _, err := NewConverter(config).makeHTTPRequest(context.Background(), server.URL); err != nil {
+		t.Fatalf("makeHTTPRequest() error = %v", err)
+	}
+	if len(waits) != 1 || waits[0] != 5*time.Millisecond {
+		t.Fatalf("retry waits = %v, want Retry-After capped at 5ms", waits)
+	}
+}
+
+type closeTrackingBody struct {
+	io.ReadCloser
+	closed *int
+}
+
+func (b closeTrackingBody) Close() error {
+	*b.closed++
+	return b.ReadCloser.Close()
+}
+
+func TestMakeHTTPRequestClosesBodyOfEveryAttempt(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls <= 2 {
+			http.Error(w, "unavailable", http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	responses, closed := 0, 0
+	config := DefaultConfig()
+	config.RetryInterval = 0
+	config.Middlewares = []func(http.RoundTripper) http.RoundTripper{
+		func(next http.RoundTripper) http.RoundTripper {
+			return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				resp, err := next.RoundTrip(req)
+				if err == nil {
+					responses++
+					resp.Body = closeTrackingBody{ReadCloser: resp.Body, closed: &closed}
+				}
+				return resp, err
+			})
+		},
+	}
+
+	body, err := NewConverter(config).makeHTTPRequest(context.Background(), server.URL)
+	if err != nil || string(body) != "ok" {
+		t.Fatalf("makeHTTPRequest() = %q, %v, want ok", body, err)
+	}
+	if responses != 3 || closed != 3 {
+		t.Fatalf("closed %d of %d response bodies, want all 3", closed, responses)
+	}
+}
+
+func TestMakeHTTPRequestReportsTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.HTTPTimeout = 20 * time.Millisecond
+	config.MaxRetries = 1
+	_, err := NewConverter(config).makeHTTPRequest(context.Background(), server.URL)
+	if !errors.Is(err, ErrRequestTimeout) {
+		t.Fatalf("makeHTTPRequest() error = %v, want ErrRequestTimeout", err)
+	}
+}
+
+func TestMakeHTTPRequestKeepsRotatedUserAgentAcrossRetries(t *testing.T) {
+	var agents []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.UserAgent())
+		if len(agents) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.RetryInterval = 0
+	config.RotateUserAgent = true
+	if _, err := NewConverter(config).makeHTTPRequest(context.Background(), server.URL); err != nil {
+		t.Fatalf("makeHTTPRequest() error = %v", err)
+	}
+	if len(agents) != 2 || agents[0] != agents[1] || !slices.Contains(browserUserAgents, agents[0]) {
+		t.Fatalf("User-Agents = %q, want the same browser User-Agent on both attempts", agents)
+	}
+}
+
+func TestMakeHTTPRequestSendsAcceptLanguage(t *testing.T) {
+	var language string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		language = r.Header.Get("Accept-Language")
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.AcceptLanguage = "de-DE"
+	if _, err := NewConverter(config).makeHTTPRequest(context.Background(), server.URL); err != nil {
+		t.Fatalf("makeHTTPRequest() error = %v", err)
+	}
+	if language != "de-DE" {
+		t.Fatalf("Accept-Language = %q, want de-DE", language)
+	}
+}
+
+func TestRetryBudgetIsSharedAcrossRequests(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "unavailable", http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.RetryInterval = 0
+	config.MaxRetries = 3
+	config.RetryBudget = 3
+	converter := NewConverter(config)
+
+	// The first request uses two retries, the second the last one and the
+	// third none, failing after its only attempt.
+	wantCalls := []int{3, 5, 6}
+	for i, want := range wantCalls {
+		_, err := converter.makeHTTPRequest(context.Background(), server.URL)
+		if i > 0 && !errors.Is(err, ErrRetryBudgetExhausted) {
+			t.Fatalf("request %d error = %v, want ErrRetryBudgetExhausted", i+1, err)
+		}
+		if calls != want {
+			t.Fatalf("server calls after request %d = %d, want %d", i+1, calls, want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package gokomoot
+
+import (
+	"fmt"
+	"time"
+)
+
+// chunkSegments re-segments every track so no segment holds more than size
+// points. Points are neither changed nor dropped; only the <trkseg>
+// boundaries move.
+func (g *GPX) chunkSegments(size int) {
+	if size < 1 {
+		return
+	}
+
+	for ti := range g.Tracks {
+		var chunked []Segment
+		for _, segment := range g.Tracks[ti].Segments {
+			points := segment.Points
+			for len(points) > size {
+				chunked = append(chunked, Segment{Points: points[:size:size]})
+				points = points[size:]
+			}
+			chunked = append(chunked, Segment{Points: points})
+		}
+		g.Tracks[ti].Segments = chunked
+	}
+}
+
+// DedupeConsecutive removes every point with the same latitude and
+// longitude as the point before it in its segment, keeping the first point of
+// each run, such as the repeated points Komoot records during a pause. With
+// matchTime, points only count as duplicates when their times are equal too.
+// It returns the number of points removed.
+func (g *GPX) DedupeConsecutive(matchTime bool) int {
+	removed := 0
+	for ti := range g.Tracks {
+		for si := range g.Tracks[ti].Segments {
+			segment := &g.Tracks[ti].Segments[si]
+			if len(segment.Points) < 2 {
+				continue
+			}
+
+			kept := segment.Points[:1]
+			for _, point := range segment.Points[1:] {
+				previous := kept[len(kept)-1]
+				if point.Lat == previous.Lat && point.Lon == previous.Lon && (!matchTime || sameTime(point.Time, previous.Time)) {
+					removed++
+					continue
+				}
+				kept = append(kept, point)
+			}
+			segment.Points = kept
+		}
+	}
+	return removed
+}
+
+// sameTime reports whether two optional point times are both unset or equal
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// Downsample keeps every nth point of the segment, at indices 0, n, 2n and so
+// on, plus always the last point so the track still ends where it did
+func (s *Segment) Downsample(n int) error {
+	if n < 1 {
+		return fmt.Errorf("downsampling interval must be at least 1, got %d", n)
+	}
+	if n == 1 || len(s.Points) == 0 {
+		return nil
+	}
+
+	last := len(s.Points) - 1
+	kept := make([]Point, 0, last/n+2)
+	for i := 0; i < last; i += n {
+		kept = append(kept, s.Points[i])
+	}
+	s.Points = append(kept, s.Points[last])
+	return nil
+}
+
+// downsample keeps every nth point of every segment, see Segment.Downsample
+func (g *GPX) downsample(n int) {
+	if n <= 1 {
+		return
+	}
+
+	for ti := range g.Tracks {
+		for si := range g.Tracks[ti].Segments {
+			// n is at least 2, so Downsample can't fail.
+			_ = g.Tracks[ti].Segments[si].Downsample(n)
+		}
+	}
+}
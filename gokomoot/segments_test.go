@@ -0,0 +1,121 @@
+package gokomoot
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChunkSegments(t *testing.T) {
+	points := make([]Point, 7)
+	for i := range points {
+		points[i] = Point{Lat: 52.5, Lon: 13.4 + float64(i)*0.001}
+	}
+	gpx := &GPX{Tracks: []Track{{Segments: []Segment{
+		{Points: points},
+		{Points: []Point{{Lat: 52.6, Lon: 13.5}}},
+	}}}}
+
+	gpx.chunkSegments(3)
+
+	segments := gpx.Tracks[0].Segments
+	wantSizes := []int{3, 3, 1, 1}
+	if len(segments) != len(wantSizes) {
+		t.Fatalf("segment count = %d, want %d", len(segments), len(wantSizes))
+	}
+	for i, want := range wantSizes {
+		if len(segments[i].Points) != want {
+			t.Fatalf("segment %d size = %d, want %d", i, len(segments[i].Points), want)
+		}
+	}
+	if segments[1].Points[0] != points[3] || segments[2].Points[0] != points[6] {
+		t.Fatalf("chunked points out of order: %#v", segments)
+	}
+}
+
+func TestDedupeConsecutive(t *testing.T) {
+	start := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	at := func(seconds int) *time.Time {
+		pointTime := start.Add(time.Duration(seconds) * time.Second)
+		return &pointTime
+	}
+	newGPX := func() *GPX {
+		return &GPX{Tracks: []Track{{Segments: []Segment{
+			{Points: []Point{
+				{Lat: 52.5, Lon: 13.4, Time: at(0)},
+				{Lat: 52.5, Lon: 13.4, Time: at(10)},
+				{Lat: 52.5, Lon: 13.4, Time: at(10)},
+				{Lat: 52.6, Lon: 13.4, Time: at(20)},
+				{Lat: 52.5, Lon: 13.4, Time: at(30)},
+			}},
+			{Points: []Point{{Lat: 52.6, Lon: 13.5}}},
+		}}}}
+	}
+
+	tests := []struct {
+		matchTime bool
+		removed   int
+		wantTimes []int
+	}{
+		{false, 2, []int{0, 20, 30}},
+		{true, 1, []int{0, 10, 20, 30}},
+	}
+	for _, tt := range tests {
+		gpx := newGPX()
+		if removed := gpx.DedupeConsecutive(tt.matchTime); removed != tt.removed {
+			t.Fatalf("DedupeConsecutive(%t) = %d, want %d", tt.matchTime, removed, tt.removed)
+		}
+		points := gpx.Tracks[0].Segments[0].Points
+		if len(points) != len(tt.wantTimes) {
+			t.Fatalf("DedupeConsecutive(%t) kept %d points, want %d", tt.matchTime, len(points), len(tt.wantTimes))
+		}
+		for i, seconds := range tt.wantTimes {
+			if !points[i].Time.Equal(*at(seconds)) {
+				t.Fatalf("DedupeConsecutive(%t) point %d time = %v, want %v", tt.matchTime, i, points[i].Time, at(seconds))
+			}
+		}
+		if len(gpx.Tracks[0].Segments[1].Points) != 1 {
+			t.Fatalf("DedupeConsecutive(%t) changed the single-point segment", tt.matchTime)
+		}
+	}
+}
+
+func TestSegmentDownsample(t *testing.T) {
+	tests := []struct {
+		count, n int
+		want     []int
+	}{
+		{7, 3, []int{0, 3, 6}},
+		{8, 3, []int{0, 3, 6, 7}},
+		{3, 1, []int{0, 1, 2}},
+		{2, 5, []int{0, 1}},
+		{1, 5, []int{0}},
+		{0, 5, nil},
+	}
+	for _, tt := range tests {
+		points := make([]Point, tt.count)
+		for i := range points {
+			points[i] = Point{Lat: 52.5, Lon: 13.4 + float64(i)*0.001}
+		}
+		segment := Segment{Points: points}
+
+		if err := segment.Downsample(tt.n); err != nil {
+			t.Fatalf("Downsample(%d) error = %v", tt.n, err)
+		}
+		if len(segment.Points) != len(tt.want) {
+			t.Fatalf("Downsample(%d) of %d points kept %d, want %d", tt.n, tt.count, len(segment.Points), len(tt.want))
+		}
+		for i, index := range tt.want {
+			if segment.Points[i] != points[index] {
+				t.Fatalf("Downsample(%d) point %d = %#v, want point %d", tt.n, i, segment.Points[i], index)
+			}
+		}
+	}
+}
+
+func TestSegmentDownsampleRejectsInvalidInterval(t *testing.T) {
+	segment := Segment{Points: []Point{{Lat: 52.5, Lon: 13.4}}}
+	if err := segment.Downsample(0); err == nil || !strings.Contains(err.Error(), "at least 1") {
+		t.Fatalf("Downsample(0) error = %v, want interval error", err)
+	}
+}
@@ -0,0 +1,220 @@
+package gokomoot
+
+import (
+	"io"
+	"math"
+)
+
+// simplifyPoints reduces points with the Ramer–Douglas–Peucker algorithm,
+// dropping points that lie within tolerance meters of the simplified line.
+// The first and last point are always kept.
+func simplifyPoints(points []Point, tolerance float64) []Point {
+	if len(points) < 3 || tolerance <= 0 {
+		return append([]Point(nil), points...)
+	}
+
+	// Project onto a local plane around the first point so distances can be
+	// measured in meters with plain vector math.
+	refLat := points[0].Lat * math.Pi / 180
+	xs := make([]float64, len(points))
+	ys := make([]float64, len(points))
+	for i, p := range points {
+		xs[i] = p.Lon * math.Pi / 180 * math.Cos(refLat) * EarthRadius
+		ys[i] = p.Lat * math.Pi / 180 * EarthRadius
+	}
+
+	keep := make([]bool, len(points))
+	keep[0], keep[len(points)-1] = true, true
+
+	// Walk ranges with an explicit stack so very long tracks can't exhaust
+	// the goroutine stack.
+	stack := [][2]int{{0, len(points) - 1}}
+	for len(stack) > 0 {
+		start, end := stack[len(stack)-1][0], stack[len(stack)-1][1]
+		stack = stack[:len(stack)-1]
+
+		maxDistance, index := 0.0, -1
+		for i := start + 1; i < end; i++ {
+			distance := segmentDistance(xs[i], ys[i], xs[start], ys[start], xs[end], ys[end])
+			if distance > maxDistance {
+				maxDistance, index = distance, i
+			}
+		}
+
+		if index != -1 && maxDistance > tolerance {
+			keep[index] = true
+			stack = append(stack, [2]int{start, index}, [2]int{index, end})
+		}
+	}
+
+	simplified := make([]Point, 0, len(points))
+	for i, p := range points {
+		if keep[i] {
+			simplified = append(simplified, p)
+		}
+	}
+	return simplified
+}
+
+// segmentDistance returns the distance from (px, py) to the segment between
+// (ax, ay) and (bx, by)
+func segmentDistance(px, py, ax, ay, bx, by float64) float64 {
+	dx, dy := bx-ax, by-ay
+	lengthSquared := dx*dx + dy*dy
+	if lengthSquared == 0 {
+		return math.Hypot(px-ax, py-ay)
+	}
+
+	t := ((px-ax)*dx + (py-ay)*dy) / lengthSquared
+	t = math.Max(0, math.Min(1, t))
+	return math.Hypot(px-(ax+t*dx), py-(ay+t*dy))
+}
+
+// Simplify reduces every segment of every track with the Ramer–Douglas–Peucker
+// algorithm, dropping points within tolerance meters of the simplified line
+// while keeping each segment's first and last point. It returns the number of
+// points removed.
+func (g *GPX) Simplify(tolerance float64) int {
+	removed := 0
+	for ti := range g.Tracks {
+		for si := range g.Tracks[ti].Segments {
+			segment := &g.Tracks[ti].Segments[si]
+			simplified := simplifyPoints(segment.Points, tolerance)
+			removed += len(segment.Points) - len(simplified)
+			segment.Points = simplified
+		}
+	}
+	return removed
+}
+
+// addPreviewTrack appends a simplified copy of the first track named "preview"
+// while leaving the full-resolution track untouched
+func (g *GPX) addPreviewTrack(tolerance float64) {
+	if len(g.Tracks) == 0 {
+		return
+	}
+
+	preview := Track{Name: "preview", Type: g.Tracks[0].Type}
+	for _, segment := range g.Tracks[0].Segments {
+		preview.Segments = append(preview.Segments, Segment{Points: simplifyPoints(segment.Points, tolerance)})
+	}
+	g.Tracks = append(g.Tracks, preview)
+}
+
+// simplified returns a copy of the GPX with every segment simplified using
+// tolerance in meters
+func (g *GPX) simplified(tolerance float64) *GPX {
+	copied := *g
+	copied.Tracks = make([]Track, len(g.Tracks))
+	for ti, track := range g.Tracks {
+		copied.Tracks[ti] = Track{Name: track.Name, Type: track.Type, Segments: make([]Segment, len(track.Segments))}
+		for si, segment := range track.Segments {
+			copied.Tracks[ti].Segments[si] = Segment{Points: simplifyPoints(segment.Points, tolerance)}
+		}
+	}
+	return &copied
+}
+
+// countingWriter counts the bytes written to it
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// encodedSize returns the number of bytes encode writes for gpx
+func encodedSize(gpx *GPX, encode func(*GPX, io.Writer) error) (int64, error) {
+	var counter countingWriter
+	if err := encode(gpx, &counter); err != nil {
+		return 0, err
+	}
+	return counter.n, nil
+}
+
+// fitToSize simplifies the GPX just enough for its encoded output to fit in
+// target bytes. It returns the simplified GPX, the tolerance used and the
+// encoded size; see fitTolerance.
+func fitToSize(gpx *GPX, target int64, encode func(*GPX, io.Writer) error) (result *GPX, tolerance float64, size int64, fits bool, err error) {
+	return fitTolerance(gpx, target, func(g *GPX) (int64, error) {
+		return encodedSize(g, encode)
+	})
+}
+
+// fitToPointCount simplifies the GPX just enough to keep at most maxPoints
+// track points. It returns the simplified GPX, the tolerance used and the
+// point count; see fitTolerance.
+func fitToPointCount(gpx *GPX, maxPoints int) (result *GPX, tolerance float64, count int, fits bool) {
+	result, tolerance, size, fits, _ := fitTolerance(gpx, int64(maxPoints), func(g *GPX) (int64, error) {
+		return int64(g.pointCount()), nil
+	})
+	return result, tolerance, int(size), fits
+}
+
+// pointCount returns the number of track points
+func (g *GPX) pointCount() int {
+	count := 0
+	for _, track := range g.Tracks {
+		for _, segment := range track.Segments {
+			count += len(segment.Points)
+		}
+	}
+	return count
+}
+
+// fitTolerance simplifies the GPX just enough for measure to report at most
+// target, binary-searching the simplification tolerance. It returns the
+// simplified GPX, the tolerance used and its measure. When even maximum
+// simplification doesn't fit, fits is false and the most simplified GPX is
+// returned.
+func fitTolerance(gpx *GPX, target int64, measure func(*GPX) (int64, error)) (result *GPX, tolerance float64, size int64, fits bool, err error) {
+	size, err = measure(gpx)
+	if err != nil || size <= target {
+		return gpx, 0, size, err == nil, err
+	}
+
+	smallest := gpx.simplified(math.Inf(1))
+	smallestSize, err := measure(smallest)
+	if err != nil {
+		return nil, 0, 0, false, err
+	}
+	if smallestSize > target {
+		return smallest, math.Inf(1), smallestSize, false, nil
+	}
+
+	// Find a tolerance that fits, then narrow the range to the smallest one.
+	low, high := 0.0, 1.0
+	result, size = nil, 0
+	for high < 2*math.Pi*EarthRadius {
+		candidate := gpx.simplified(high)
+		candidateSize, err := measure(candidate)
+		if err != nil {
+			return nil, 0, 0, false, err
+		}
+		if candidateSize <= target {
+			result, size = candidate, candidateSize
+			break
+		}
+		low, high = high, high*2
+	}
+	if result == nil {
+		return smallest, math.Inf(1), smallestSize, true, nil
+	}
+
+	for i := 0; i < 20 && high-low > 0.01; i++ {
+		middle := (low + high) / 2
+		candidate := gpx.simplified(middle)
+		candidateSize, err := measure(candidate)
+		if err != nil {
+			return nil, 0, 0, false, err
+		}
+		if candidateSize <= target {
+			result, size, high = candidate, candidateSize, middle
+		} else {
+			low = middle
+		}
+	}
+	return result, high, size, true, nil
+}
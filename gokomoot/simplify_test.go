@@ -0,0 +1,185 @@
+package gokomoot
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestSimplifyPointsDropsCollinearPoints(t *testing.T) {
+	points := []Point{
+		{Lat: 52.5, Lon: 13.4},
+		{Lat: 52.5, Lon: 13.401},
+		{Lat: 52.5, Lon: 13.402},
+		{Lat: 52.501, Lon: 13.403},
+		{Lat: 52.5, Lon: 13.404},
+	}
+
+	got := simplifyPoints(points, 10)
+	want := []Point{points[0], points[2], points[3], points[4]}
+	if len(got) != len(want) {
+		t.Fatalf("simplifyPoints() = %#v, want %#v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("simplifyPoints()[%d] = %#v, want %#v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSimplifyPointsKeepsEndpoints(t *testing.T) {
+	points := []Point{
+		{Lat: 52.5, Lon: 13.4},
+		{Lat: 52.50001, Lon: 13.40001},
+		{Lat: 52.5, Lon: 13.40002},
+	}
+
+	got := simplifyPoints(points, 1000)
+	if len(got) != 2 || got[0] != points[0] || got[1] != points[2] {
+		t.Fatalf("simplifyPoints() = %#v, want first and last point", got)
+	}
+}
+
+func TestSimplifySimplifiesEverySegment(t *testing.T) {
+	line := []Point{
+		{Lat: 52.5, Lon: 13.4},
+		{Lat: 52.5, Lon: 13.401},
+		{Lat: 52.5, Lon: 13.402},
+		{Lat: 52.5, Lon: 13.403},
+	}
+	gpx := &GPX{Tracks: []Track{
+		{Segments: []Segment{{Points: line}, {Points: line[:3]}}},
+		{Segments: []Segment{{Points: line[:2]}}},
+	}}
+
+	if removed := gpx.Simplify(10); removed != 3 {
+		t.Fatalf("Simplify() = %d, want 3", removed)
+	}
+	for ti, track := range gpx.Tracks {
+		for si, segment := range track.Segments {
+			points := segment.Points
+			if len(points) != 2 || points[0] != line[0] || points[1] == line[0] {
+				t.Fatalf("track %d segment %d = %#v, want only its endpoints", ti, si, points)
+			}
+		}
+	}
+}
+
+func TestTransformGPXLogsSimplifiedPoints(t *testing.T) {
+	var buf bytes.Buffer
+	config := DefaultConfig()
+	config.SimplifyTolerance = 10
+	config.Verbosity = VerbosityVerbose
+	config.Logger = log.New(&buf, "", 0)
+	gpx := &GPX{Tracks: []Track{{Segments: []Segment{{Points: []Point{
+		{Lat: 52.5, Lon: 13.4},
+		{Lat: 52.5, Lon: 13.401},
+		{Lat: 52.5, Lon: 13.402},
+	}}}}}}
+
+	NewConverter(config).transformGPX(gpx, 0)
+
+	if got := len(gpx.Tracks[0].Segments[0].Points); got != 2 {
+		t.Fatalf("point count = %d, want 2", got)
+	}
+	if !strings.Contains(buf.String(), "Simplification removed 1 points") {
+		t.Fatalf("log = %q, want removed point count", buf.String())
+	}
+}
+
+func TestAddPreviewTrackKeepsFullTrack(t *testing.T) {
+	points := []Point{
+		{Lat: 52.5, Lon: 13.4},
+		{Lat: 52.5, Lon: 13.401},
+		{Lat: 52.5, Lon: 13.402},
+	}
+	gpx := &GPX{Tracks: []Track{{Name: "Tour", Segments: []Segment{{Points: points}}}}}
+
+	gpx.addPreviewTrack(10)
+
+	if len(gpx.Tracks) != 2 {
+		t.Fatalf("track count = %d, want 2", len(gpx.Tracks))
+	}
+	if got := len(gpx.Tracks[0].Segments[0].Points); got != 3 {
+		t.Fatalf("full track point count = %d, want 3", got)
+	}
+	preview := gpx.Tracks[1]
+	if preview.Name != "preview" || len(preview.Segments[0].Points) != 2 {
+		t.Fatalf("preview track = %#v, want 2 point track named preview", preview)
+	}
+}
+
+func zigzagGPX(count int) *GPX {
+	points := make([]Point, count)
+	for i := range points {
+		points[i] = Point{Lat: 52.5 + float64(i%2)*0.0001*float64(i%7), Lon: 13.4 + float64(i)*0.001, Elevation: 40}
+	}
+	return &GPX{Tracks: []Track{{Name: "Zigzag", Type: "hike", Segments: []Segment{{Points: points}}}}}
+}
+
+func TestFitToSizeShrinksBelowTarget(t *testing.T) {
+	gpx := zigzagGPX(500)
+	fullSize, err := encodedSize(gpx, encodeGPX)
+	if err != nil {
+		t.Fatalf("encodedSize() error = %v", err)
+	}
+
+	target := fullSize / 3
+	fitted, tolerance, size, fits, err := fitToSize(gpx, target, encodeGPX)
+	if err != nil {
+		t.Fatalf("fitToSize() error = %v", err)
+	}
+	if !fits || size > target || tolerance <= 0 {
+		t.Fatalf("fitToSize() = size %d, tolerance %f, fits %t, want fit under %d", size, tolerance, fits, target)
+	}
+	if got, err := encodedSize(fitted, encodeGPX); err != nil || got != size {
+		t.Fatalf("encodedSize(fitted) = %d, %v, want %d", got, err, size)
+	}
+	if len(gpx.allPoints()) != 500 {
+		t.Fatal("fitToSize() modified the input GPX")
+	}
+	if track := fitted.Tracks[0]; track.Name != "Zigzag" || track.Type != "hike" {
+		t.Fatalf("fitted track = %q, %q, want the name and type kept", track.Name, track.Type)
+	}
+}
+
+func TestFitToSizeReportsUnachievableTarget(t *testing.T) {
+	fitted, _, size, fits, err := fitToSize(zigzagGPX(50), 10, encodeGPX)
+	if err != nil {
+		t.Fatalf("fitToSize() error = %v", err)
+	}
+	if fits || size <= 10 || len(fitted.allPoints()) != 2 {
+		t.Fatalf("fitToSize() = size %d, fits %t, %d points, want most simplified output", size, fits, len(fitted.allPoints()))
+	}
+}
+
+func TestFitToSizeKeepsOutputThatAlreadyFits(t *testing.T) {
+	gpx := zigzagGPX(10)
+	fitted, tolerance, _, fits, err := fitToSize(gpx, 1<<20, encodeGPX)
+	if err != nil || !fits || tolerance != 0 || fitted != gpx {
+		t.Fatalf("fitToSize() = %p, %f, %t, %v, want unchanged GPX", fitted, tolerance, fits, err)
+	}
+}
+
+func TestFitToPointCountKeepsEndpoints(t *testing.T) {
+	gpx := zigzagGPX(500)
+	fitted, tolerance, count, fits := fitToPointCount(gpx, 100)
+	if !fits || count > 100 || tolerance <= 0 {
+		t.Fatalf("fitToPointCount() = %d points, tolerance %f, fits %t, want at most 100", count, tolerance, fits)
+	}
+	if got := fitted.pointCount(); got != count {
+		t.Fatalf("fitted point count = %d, want reported %d", got, count)
+	}
+	if fitted.Tracks[0].Type != "hike" {
+		t.Fatalf("fitted track type = %q, want hike", fitted.Tracks[0].Type)
+	}
+	points, original := fitted.allPoints(), gpx.allPoints()
+	if points[0] != original[0] || points[len(points)-1] != original[len(original)-1] {
+		t.Fatal("fitToPointCount() dropped an endpoint")
+	}
+
+	if _, _, count, fits := fitToPointCount(gpx, 1); fits || count != 2 {
+		t.Fatalf("fitToPointCount(1) = %d points, fits %t, want unachievable with 2 points", count, fits)
+	}
+}
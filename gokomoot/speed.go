@@ -0,0 +1,62 @@
+package gokomoot
+
+import (
+	"math"
+	"strings"
+)
+
+// Garmin TrackPointExtension v2 namespace and schema, which defines the
+// per-point speed
+const (
+	TrackPointExtensionNamespace      = "http://www.garmin.com/xmlschemas/TrackPointExtension/v2"
+	trackPointExtensionSchemaLocation = TrackPointExtensionNamespace + " https://www8.garmin.com/xmlschemas/TrackPointExtensionv2.xsd"
+)
+
+// TrackPointExtension is Garmin's per-point extension, written with the
+// gpxtpx prefix declared on the <gpx> element
+type TrackPointExtension struct {
+	// Speed is in meters per second
+	Speed float64 `xml:"gpxtpx:speed"`
+}
+
+// addSpeed records on every point the speed of the leg leading to it, or of
+// the leg leaving it for the first point of a segment, as a Garmin
+// TrackPointExtension. Points on a leg without two times or without elapsed
+// time get none. It reports whether any point got a speed, and only then
+// declares the gpxtpx namespace.
+func (g *GPX) addSpeed() bool {
+	added := false
+	for t := range g.Tracks {
+		for s := range g.Tracks[t].Segments {
+			points := g.Tracks[t].Segments[s].Points
+			for i := range points {
+				from, to := i-1, i
+				if i == 0 {
+					from, to = 0, 1
+				}
+				if to >= len(points) || points[from].Time == nil || points[to].Time == nil {
+					continue
+				}
+				elapsed := points[to].Time.Sub(*points[from].Time).Seconds()
+				if elapsed <= 0 {
+					continue
+				}
+
+				speed := haversineDistance(points[from], points[to]) / elapsed
+				if points[i].Extensions == nil {
+					points[i].Extensions = &PointExtensions{}
+				}
+				points[i].Extensions.TrackPointExtension = &TrackPointExtension{Speed: math.Round(speed*100) / 100}
+				added = true
+			}
+		}
+	}
+
+	if added {
+		g.XMLNSGPXTPX = TrackPointExtensionNamespace
+		if g.SchemaLocation != "" && !strings.Contains(g.SchemaLocation, TrackPointExtensionNamespace) {
+			g.SchemaLocation += " " + trackPointExtensionSchemaLocation
+		}
+	}
+	return added
+}
@@ -0,0 +1,63 @@
+package gokomoot
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAddSpeed(t *testing.T) {
+	start := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	at := func(seconds int) *time.Time {
+		pointTime := start.Add(time.Duration(seconds) * time.Second)
+		return &pointTime
+	}
+	// Legs of about 111.2 m each.
+	gpx := &GPX{SchemaLocation: GPXSchemaLocation, Tracks: []Track{{Segments: []Segment{{Points: []Point{
+		{Lat: 0, Lon: 0, Time: at(0)},
+		{Lat: 0.001, Lon: 0, Time: at(10)},
+		{Lat: 0.002, Lon: 0, Time: at(10)},
+		{Lat: 0.003, Lon: 0},
+	}}}}}}
+
+	if !gpx.addSpeed() {
+		t.Fatal("addSpeed() = false, want true")
+	}
+	points := gpx.Tracks[0].Segments[0].Points
+	for i, want := range []float64{11.12, 11.12, -1, -1} {
+		extension := points[i].Extensions
+		if want < 0 {
+			if extension != nil {
+				t.Fatalf("point %d extensions = %#v, want none", i, extension)
+			}
+			continue
+		}
+		if extension == nil || extension.TrackPointExtension == nil || extension.TrackPointExtension.Speed != want {
+			t.Fatalf("point %d extensions = %#v, want speed %v", i, extension, want)
+		}
+	}
+	if gpx.XMLNSGPXTPX != TrackPointExtensionNamespace || !strings.Contains(gpx.SchemaLocation, "TrackPointExtensionv2.xsd") {
+		t.Fatalf("namespace = %q, schema location = %q, want the TrackPointExtension ones", gpx.XMLNSGPXTPX, gpx.SchemaLocation)
+	}
+
+	var buf bytes.Buffer
+	if err := encodeGPX(gpx, &buf); err != nil {
+		t.Fatalf("encodeGPX() error = %v", err)
+	}
+	for _, want := range []string{
+		`xmlns:gpxtpx="` + TrackPointExtensionNamespace + `"`,
+		"<extensions>\n          <gpxtpx:TrackPointExtension>\n            <gpxtpx:speed>11.12</gpxtpx:speed>",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("GPX output missing %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestAddSpeedWithoutTimes(t *testing.T) {
+	gpx := &GPX{Tracks: []Track{{Segments: []Segment{{Points: []Point{{Lat: 0, Lon: 0}, {Lat: 0.001, Lon: 0}}}}}}}
+	if gpx.addSpeed() || gpx.XMLNSGPXTPX != "" || gpx.Tracks[0].Segments[0].Points[0].Extensions != nil {
+		t.Fatalf("addSpeed() without times changed the GPX: %#v", gpx)
+	}
+}
@@ -0,0 +1,107 @@
+package gokomoot
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// SplitByDistance cuts the tracks into consecutive chunks of about km
+// kilometers each, measured with the haversine distance along the points of
+// one track after the other; the gap between two tracks isn't counted. Each
+// chunk is a GPX of its own with the parts of the tracks it covers;
+// neighbouring chunks share the point they meet at, and points keep their
+// elevation and time. Waypoints are left out. A GPX that isn't longer than
+// km is returned as the only chunk.
+func (g *GPX) SplitByDistance(km float64) []*GPX {
+	if km <= 0 || len(g.Tracks) == 0 {
+		return []*GPX{g}
+	}
+
+	limit := km * 1000
+	var chunks [][]Track
+	var current []Track
+	distance := 0.0
+	for ti, track := range g.Tracks {
+		current = append(current, Track{Name: track.Name, Type: track.Type})
+		for si, segment := range track.Segments {
+			open := &current[len(current)-1]
+			open.Segments = append(open.Segments, Segment{})
+			for pi, point := range segment.Points {
+				if pi > 0 {
+					distance += haversineDistance(segment.Points[pi-1], point)
+				}
+				open := &current[len(current)-1]
+				openSegment := &open.Segments[len(open.Segments)-1]
+				openSegment.Points = append(openSegment.Points, point)
+
+				segmentEnd := pi == len(segment.Points)-1
+				trackEnd := segmentEnd && si == len(track.Segments)-1
+				if distance < limit || (trackEnd && ti == len(g.Tracks)-1) {
+					continue
+				}
+				chunks = append(chunks, current)
+				current = nil
+				if !trackEnd {
+					current = []Track{{Name: track.Name, Type: track.Type}}
+				}
+				if !segmentEnd {
+					current[0].Segments = []Segment{{Points: []Point{point}}}
+				}
+				distance = 0
+			}
+		}
+	}
+	chunks = append(chunks, current)
+
+	if len(chunks) == 1 {
+		return []*GPX{g}
+	}
+
+	split := make([]*GPX, len(chunks))
+	for i, tracks := range chunks {
+		for j := range tracks {
+			if tracks[j].Name != "" {
+				tracks[j].Name = fmt.Sprintf("%s (%d/%d)", tracks[j].Name, i+1, len(chunks))
+			}
+		}
+		split[i] = &GPX{
+			XMLNS:          g.XMLNS,
+			XMLNSXSI:       g.XMLNSXSI,
+			SchemaLocation: g.SchemaLocation,
+			XMLNSGPXTPX:    g.XMLNSGPXTPX,
+			Version:        g.Version,
+			Creator:        g.Creator,
+			Metadata:       g.chunkMetadata(i+1, len(chunks)),
+			Tracks:         tracks,
+		}
+		split[i].setBounds()
+	}
+	return split
+}
+
+// chunkMetadata returns a copy of the metadata for chunk n of total, with the
+// part number added to the name and the whole-track distance dropped
+func (g *GPX) chunkMetadata(n, total int) *Metadata {
+	if g.Metadata == nil {
+		return nil
+	}
+
+	metadata := *g.Metadata
+	if metadata.Name != "" {
+		metadata.Name = fmt.Sprintf("%s (%d/%d)", metadata.Name, n, total)
+	}
+	if metadata.Extensions != nil {
+		extensions := *metadata.Extensions
+		extensions.Distance = ""
+		metadata.Extensions = &extensions
+	}
+	return &metadata
+}
+
+// numberedPath inserts -n before the extension of destination, turning
+// tour.gpx into tour-1.gpx
+func numberedPath(destination string, n int) string {
+	extension := path.Ext(destination)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(destination, extension), n, extension)
+}
@@ -0,0 +1,170 @@
+package gokomoot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// meridianPoints returns count points about 111 m apart going north, each
+// with an elevation and a time
+func meridianPoints(count int) []Point {
+	start := time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)
+	points := make([]Point, count)
+	for i := range points {
+		pointTime := start.Add(time.Duration(i) * time.Minute)
+		points[i] = Point{Lat: 52 + float64(i)*0.001, Lon: 13.4, Elevation: float64(100 + i), Time: &pointTime}
+	}
+	return points
+}
+
+func TestSplitByDistance(t *testing.T) {
+	points := meridianPoints(10)
+	gpx := &GPX{
+		Version:  "1.1",
+		Metadata: &Metadata{Name: "Tour", Extensions: &MetadataExtensions{TourID: "1", Distance: "1000.0"}},
+		Tracks:   []Track{{Name: "Tour", Type: "hike", Segments: []Segment{{Points: points}}}},
+	}
+
+	chunks := gpx.SplitByDistance(0.4)
+
+	wantStarts := []int{0, 4, 8}
+	if len(chunks) != len(wantStarts) {
+		t.Fatalf("SplitByDistance() returned %d chunks, want %d", len(chunks), len(wantStarts))
+	}
+	for i, chunk := range chunks {
+		chunkPoints := chunk.Tracks[0].Segments[0].Points
+		if chunkPoints[0] != points[wantStarts[i]] {
+			t.Fatalf("chunk %d starts with %#v, want point %d", i, chunkPoints[0], wantStarts[i])
+		}
+		if chunkPoints[0].Time == nil || chunkPoints[0].Elevation != float64(100+wantStarts[i]) {
+			t.Fatalf("chunk %d first point = %#v, want elevation and time kept", i, chunkPoints[0])
+		}
+		if chunk.Tracks[0].Type != "hike" || chunk.Metadata.Extensions.TourID != "1" || chunk.Metadata.Extensions.Distance != "" {
+			t.Fatalf("chunk %d = %#v, want track type and tour ID without the whole distance", i, chunk)
+		}
+	}
+	if bounds := chunks[1].Metadata.Bounds; bounds == nil || bounds.MinLat != points[4].Lat || bounds.MaxLat != points[8].Lat {
+		t.Fatalf("chunk bounds = %#v, want the latitudes of points 4 to 8", bounds)
+	}
+	if got := chunks[1].Metadata.Name; got != "Tour (2/3)" {
+		t.Fatalf("chunk name = %q, want %q", got, "Tour (2/3)")
+	}
+	if last := chunks[2].Tracks[0].Segments[0].Points; last[len(last)-1] != points[9] {
+		t.Fatalf("last chunk ends with %#v, want the final point", last[len(last)-1])
+	}
+	if gpx.Metadata.Name != "Tour" || gpx.Metadata.Extensions.Distance != "1000.0" {
+		t.Fatalf("SplitByDistance() changed the original metadata: %#v", gpx.Metadata)
+	}
+}
+
+func TestSplitByDistanceKeepsSegmentBreaks(t *testing.T) {
+	points := meridianPoints(6)
+	gpx := &GPX{Tracks: []Track{{Segments: []Segment{{Points: points[:3]}, {Points: points[3:]}}}}}
+
+	chunks := gpx.SplitByDistance(0.2)
+
+	if len(chunks) != 2 {
+		t.Fatalf("SplitByDistance() returned %d chunks, want 2", len(chunks))
+	}
+	for i, chunk := range chunks {
+		for _, segment := range chunk.Tracks[0].Segments {
+			if len(segment.Points) < 2 {
+				t.Fatalf("chunk %d has segment %#v, want at least 2 points", i, segment.Points)
+			}
+		}
+	}
+}
+
+func TestSplitByDistanceSplitsEveryTrack(t *testing.T) {
+	// Two days of a merged trip, 444 m each, split into chunks of 600 m
+	points := meridianPoints(10)
+	gpx := &GPX{Tracks: []Track{
+		{Name: "Day 1", Segments: []Segment{{Points: points[:5]}}},
+		{Name: "Day 2", Segments: []Segment{{Points: points[5:]}}},
+	}}
+
+	chunks := gpx.SplitByDistance(0.6)
+
+	if len(chunks) != 2 {
+		t.Fatalf("SplitByDistance() returned %d chunks, want 2", len(chunks))
+	}
+	var names []string
+	count := 0
+	for _, chunk := range chunks {
+		for _, track := range chunk.Tracks {
+			names = append(names, track.Name)
+			for _, segment := range track.Segments {
+				count += len(segment.Points)
+			}
+		}
+	}
+	if want := []string{"Day 1 (1/2)", "Day 2 (1/2)", "Day 2 (2/2)"}; !slices.Equal(names, want) {
+		t.Fatalf("chunk tracks = %v, want %v", names, want)
+	}
+	// The point the chunks meet at is in both
+	if count != len(points)+1 {
+		t.Fatalf("chunks hold %d points, want all %d plus the shared one", count, len(points))
+	}
+}
+
+func TestSplitByDistanceShortTrack(t *testing.T) {
+	gpx := &GPX{Tracks: []Track{{Segments: []Segment{{Points: meridianPoints(3)}}}}}
+	if chunks := gpx.SplitByDistance(5); len(chunks) != 1 || chunks[0] != gpx {
+		t.Fatalf("SplitByDistance() = %v, want the GPX itself", chunks)
+	}
+}
+
+func TestNumberedPath(t *testing.T) {
+	tests := map[string]string{
+		"tour.gpx":                  "tour-2.gpx",
+		"out/tour.v1.gpx":           "out/tour.v1-2.gpx",
+		"tour":                      "tour-2",
+		"s3://bucket/tours/day.kml": "s3://bucket/tours/day-2.kml",
+	}
+	for input, want := range tests {
+		if got := numberedPath(input, 2); got != want {
+			t.Fatalf("numberedPath(%q, 2) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestConvertFromHTMLSplitsByDistance(t *testing.T) {
+	config := DefaultConfig()
+	config.SplitDistance = 0.15
+	outputPath := filepath.Join(t.TempDir(), "tour.gpx")
+	html := tourPageHTML(t, `{"page":{"_embedded":{"tour":{"id":1,"name":"Ride","_embedded":{"coordinates":{"items":[{"lat":52,"lng":13.4},{"lat":52.001,"lng":13.4},{"lat":52.002,"lng":13.4},{"lat":52.003,"lng":13.4}]}}}}}}`)
+
+	if err := NewConverter(config).ConvertFromHTML(context.Background(), html, outputPath); err != nil {
+		t.Fatalf("ConvertFromHTML() error = %v", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(outputPath))
+	if err != nil {
+		t.Fatalf("os.ReadDir() error = %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if want := []string{"tour-1.gpx", "tour-2.gpx"}; !slices.Equal(names, want) {
+		t.Fatalf("written files = %v, want %v", names, want)
+	}
+}
+
+func TestConvertFromHTMLRejectsSplittingDerivedTracks(t *testing.T) {
+	config := DefaultConfig()
+	config.Verbosity = VerbosityQuiet
+	config.SplitDistance = 0.15
+	config.PreviewTolerance = 10
+	outputPath := filepath.Join(t.TempDir(), "tour.gpx")
+	html := tourPageHTML(t, `{"page":{"_embedded":{"tour":{"id":1,"name":"Ride","_embedded":{"coordinates":{"items":[{"lat":52,"lng":13.4},{"lat":52.003,"lng":13.4}]}}}}}}`)
+	err := NewConverter(config).ConvertFromHTML(context.Background(), html, outputPath)
+	if err == nil || !strings.Contains(err.Error(), "cut apart") {
+		t.Fatalf("ConvertFromHTML() error = %v, want an error about splitting the preview track", err)
+	}
+}
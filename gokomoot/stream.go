@@ -0,0 +1,505 @@
+package gokomoot
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// StreamGPX converts tour JSON shaped like KomootResponse, as embedded in the
+// tour page, to a GPX document written to w while the coordinates are being
+// read. Each coordinate is written as a <trkpt> as soon as it is parsed and
+// the buffers are reused, so memory use stays the same however long the tour
+// is, unlike building a GPX first.
+//
+// The streaming path writes the tour name, sport, metadata time and point
+// times, which must precede the coordinates in the JSON; Komoot sends them
+// first. Anything after the coordinates is not read. Waypoints, the tour
+// summary and extensions are left out and none of the optional
+// transformations are applied, so use Convert for those.
+func (c *Converter) StreamGPX(ctx context.Context, r io.Reader, w io.Writer) error {
+	decoder := json.NewDecoder(r)
+	for _, key := range []string{"page", "_embedded", "tour"} {
+		if err := jsonFindKey(decoder, key); err != nil {
+			return fmt.Errorf("failed to find tour data: %w", err)
+		}
+	}
+
+	out := bufio.NewWriter(contextWriter{ctx: ctx, w: w})
+	stream := gpxStream{converter: c, w: out, encoder: xml.NewEncoder(out)}
+	stream.encoder.Indent("", c.config.Indent)
+	err := jsonEachKey(decoder, func(key string) error {
+		switch key {
+		case "name":
+			return decoder.Decode(&stream.tour.Name)
+		case "date":
+			return decoder.Decode(&stream.tour.Date)
+		case "sport":
+			return decoder.Decode(&stream.tour.Sport)
+		case "_embedded":
+			return jsonEachKey(decoder, func(key string) error {
+				if key != "coordinates" {
+					return jsonSkipValue(decoder)
+				}
+				return jsonEachKey(decoder, func(key string) error {
+					if key != "items" {
+						return jsonSkipValue(decoder)
+					}
+					// The decoder allocates for every value, so the
+					// coordinates are read from the rest of the input by
+					// coordinateScanner, which leaves the decoder behind
+					scanner := coordinateScanner{r: bufio.NewReader(io.MultiReader(decoder.Buffered(), r))}
+					if err := stream.writePoints(&scanner); err != nil {
+						return err
+					}
+					return errStreamDone
+				})
+			})
+		default:
+			return jsonSkipValue(decoder)
+		}
+	})
+	if err != nil && !errors.Is(err, errStreamDone) {
+		return fmt.Errorf("failed to stream GPX: %w", err)
+	}
+	if !stream.started {
+		return coordinatesError("coordinates missing in tour data")
+	}
+	if stream.points == 0 {
+		return coordinatesError("no complete coordinates found in tour data")
+	}
+	if err := out.Flush(); err != nil {
+		return fmt.Errorf("failed to stream GPX: %w", err)
+	}
+	c.warnImplausibleElevations(stream.implausible)
+	return nil
+}
+
+// errStreamDone stops reading the tour JSON once the coordinates are written
+var errStreamDone = errors.New("coordinates written")
+
+// gpxStream writes a GPX document point by point
+type gpxStream struct {
+	converter *Converter
+	w         *bufio.Writer
+	encoder   *xml.Encoder
+	tour      KomootTour
+	started   bool
+	points    int
+	// implausible counts the elevations dropped as implausible
+	implausible int
+	// buf is reused to format each point
+	buf []byte
+}
+
+// writePoints writes the document around the JSON coordinate array scanner
+// is positioned at, writing each complete coordinate as a <trkpt>. The points
+// are formatted by hand, indented like the XML encoder does, since encoding
+// them one by one allocates for every point.
+func (s *gpxStream) writePoints(scanner *coordinateScanner) error {
+	if err := scanner.start(); err != nil {
+		return err
+	}
+
+	if _, err := s.w.WriteString(xml.Header); err != nil {
+		return fmt.Errorf("error writing XML header: %w", err)
+	}
+	if err := s.start(); err != nil {
+		return err
+	}
+	if err := s.encoder.Flush(); err != nil {
+		return err
+	}
+
+	indent := s.converter.config.Indent
+	newline := func(depth int) {
+		if indent != "" {
+			s.buf = append(s.buf, '\n')
+			for range depth {
+				s.buf = append(s.buf, indent...)
+			}
+		}
+	}
+
+	start, hasStart := parseTourDate(s.tour.Date)
+	var item komootCoordinateFields
+	for {
+		more, err := scanner.next(&item)
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+		if !item.Lat.set || !item.Lng.set {
+			continue
+		}
+
+		point := Point{Lat: item.Lat.value, Lon: item.Lng.value, Elevation: item.Alt.value, NoElevation: !item.Alt.set}
+		if err := point.validateCoordinates(); err != nil {
+			return fmt.Errorf("invalid point data: %w", err)
+		}
+		if point.dropImplausibleElevation() {
+			s.implausible++
+		}
+		timed := hasStart && item.T.set
+
+		s.buf = s.buf[:0]
+		newline(3)
+		s.buf = append(s.buf, `<trkpt lat="`...)
+		s.buf = strconv.AppendFloat(s.buf, point.Lat, 'g', -1, 64)
+		s.buf = append(s.buf, `" lon="`...)
+		s.buf = strconv.AppendFloat(s.buf, point.Lon, 'g', -1, 64)
+		s.buf = append(s.buf, `">`...)
+		if !point.NoElevation {
+			newline(4)
+			s.buf = append(s.buf, "<ele>"...)
+			s.buf = strconv.AppendFloat(s.buf, point.Elevation, 'g', -1, 64)
+			s.buf = append(s.buf, "</ele>"...)
+		}
+		if timed {
+			newline(4)
+			s.buf = append(s.buf, "<time>"...)
+			s.buf = start.Add(time.Duration(item.T.value*float64(time.Millisecond))).AppendFormat(s.buf, time.RFC3339Nano)
+			s.buf = append(s.buf, "</time>"...)
+		}
+		if !point.NoElevation || timed {
+			newline(3)
+		}
+		s.buf = append(s.buf, "</trkpt>"...)
+		if _, err := s.w.Write(s.buf); err != nil {
+			return err
+		}
+		s.points++
+	}
+
+	s.buf = s.buf[:0]
+	for depth, name := range []string{"trkseg", "trk", "gpx"} {
+		newline(2 - depth)
+		s.buf = append(s.buf, "</"+name+">"...)
+	}
+	_, err := s.w.Write(s.buf)
+	return err
+}
+
+// start writes everything up to the opening <trkseg>
+func (s *gpxStream) start() error {
+	s.started = true
+	attr := func(name, value string) xml.Attr {
+		return xml.Attr{Name: xml.Name{Local: name}, Value: value}
+	}
+	root := xml.StartElement{Name: xml.Name{Local: "gpx"}, Attr: []xml.Attr{
+		attr("xmlns", GPXNamespace),
+		attr("xmlns:xsi", XSINamespace),
+		attr("xsi:schemaLocation", GPXSchemaLocation),
+		attr("version", "1.1"),
+		attr("creator", creator),
+	}}
+	if err := s.encoder.EncodeToken(root); err != nil {
+		return err
+	}
+
+	name := s.tour.Name
+	if s.converter.config.Name != "" {
+		name = s.converter.config.Name
+	}
+	var data KomootResponse
+	data.Page.Embedded.Tour = s.tour
+	metadataTime, err := s.converter.metadataTime(&data)
+	if err != nil {
+		return err
+	}
+	if name != "" || metadataTime != nil {
+		metadata := Metadata{Name: name, Time: metadataTime}
+		if err := s.encoder.EncodeElement(metadata, xml.StartElement{Name: xml.Name{Local: "metadata"}}); err != nil {
+			return err
+		}
+	}
+
+	if err := s.encoder.EncodeToken(xml.StartElement{Name: xml.Name{Local: "trk"}}); err != nil {
+		return err
+	}
+	for _, element := range []struct{ name, value string }{{"name", name}, {"type", s.tour.Sport}} {
+		if element.value == "" {
+			continue
+		}
+		if err := s.encoder.EncodeElement(element.value, xml.StartElement{Name: xml.Name{Local: element.name}}); err != nil {
+			return err
+		}
+	}
+	return s.encoder.EncodeToken(xml.StartElement{Name: xml.Name{Local: "trkseg"}})
+}
+
+// jsonFindKey advances decoder, positioned at an object, to the value of key
+func jsonFindKey(decoder *json.Decoder, key string) error {
+	if err := jsonExpectDelim(decoder, '{'); err != nil {
+		return err
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		if token == key {
+			return nil
+		}
+		if err := jsonSkipValue(decoder); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("key %q not found", key)
+}
+
+// jsonEachKey calls fn for every key of the object decoder is positioned at.
+// fn must consume the key's value.
+func jsonEachKey(decoder *json.Decoder, fn func(key string) error) error {
+	if err := jsonExpectDelim(decoder, '{'); err != nil {
+		return err
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := token.(string)
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+	_, err := decoder.Token()
+	return err
+}
+
+// jsonExpectDelim reads the next token and checks that it is delim
+func jsonExpectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("unexpected JSON token %v, want %v", token, delim)
+	}
+	return nil
+}
+
+// jsonSkipValue consumes the next value without keeping it
+func jsonSkipValue(decoder *json.Decoder) error {
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// coordinateScanner reads the objects of a Komoot coordinate array one at a
+// time, reusing its buffer so reading a coordinate doesn't allocate
+type coordinateScanner struct {
+	r   *bufio.Reader
+	buf []byte
+	// first is true until the first item is read
+	first bool
+}
+
+// start reads up to the first item, past the colon before the array that
+// json.Decoder leaves unread after a key
+func (s *coordinateScanner) start() error {
+	c, err := s.nonSpace()
+	if err != nil {
+		return err
+	}
+	if c == ':' {
+		if c, err = s.nonSpace(); err != nil {
+			return err
+		}
+	}
+	if c != '[' {
+		return fmt.Errorf("coordinate items are %q, want an array", c)
+	}
+	s.first = true
+	return nil
+}
+
+// next reads the next coordinate into item and reports whether there was one
+func (s *coordinateScanner) next(item *komootCoordinateFields) (bool, error) {
+	c, err := s.nonSpace()
+	if err != nil {
+		return false, err
+	}
+	if c == ']' {
+		return false, nil
+	}
+	if !s.first {
+		if c != ',' {
+			return false, fmt.Errorf("unexpected %q between coordinates", c)
+		}
+		if c, err = s.nonSpace(); err != nil {
+			return false, err
+		}
+	}
+	s.first = false
+	if c != '{' {
+		return false, fmt.Errorf("coordinate is %q, want an object", c)
+	}
+
+	*item = komootCoordinateFields{}
+	for {
+		c, err := s.nonSpace()
+		if err != nil {
+			return false, err
+		}
+		if c == '}' {
+			return true, nil
+		}
+		if c == ',' {
+			if c, err = s.nonSpace(); err != nil {
+				return false, err
+			}
+		}
+		if c != '"' {
+			return false, fmt.Errorf("coordinate key starts with %q", c)
+		}
+		if err := s.readString(); err != nil {
+			return false, err
+		}
+		if c, err := s.nonSpace(); err != nil {
+			return false, err
+		} else if c != ':' {
+			return false, fmt.Errorf("unexpected %q after coordinate key", c)
+		}
+
+		var field *optionalFloat
+		switch string(s.buf) {
+		case "lat":
+			field = &item.Lat
+		case "lng":
+			field = &item.Lng
+		case "alt":
+			field = &item.Alt
+		case "t":
+			field = &item.T
+		}
+		if field == nil {
+			if err := s.skipValue(); err != nil {
+				return false, err
+			}
+			continue
+		}
+		if err := s.readLiteral(); err != nil {
+			return false, err
+		}
+		if err := field.UnmarshalJSON(s.buf); err != nil {
+			return false, err
+		}
+	}
+}
+
+// nonSpace returns the next byte that isn't JSON whitespace
+func (s *coordinateScanner) nonSpace() (byte, error) {
+	for {
+		c, err := s.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+			return c, nil
+		}
+	}
+}
+
+// readString reads the rest of a string, after its opening quote, into buf
+// with escapes left as they are
+func (s *coordinateScanner) readString() error {
+	s.buf = s.buf[:0]
+	for {
+		c, err := s.r.ReadByte()
+		if err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		switch c {
+		case '"':
+			return nil
+		case '\\':
+			s.buf = append(s.buf, c)
+			if c, err = s.r.ReadByte(); err != nil {
+				return io.ErrUnexpectedEOF
+			}
+		}
+		s.buf = append(s.buf, c)
+	}
+}
+
+// readLiteral reads a number, true, false or null into buf
+func (s *coordinateScanner) readLiteral() error {
+	c, err := s.nonSpace()
+	if err != nil {
+		return err
+	}
+	s.buf = append(s.buf[:0], c)
+	for {
+		c, err := s.r.ReadByte()
+		if err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		switch c {
+		case ',', '}', ']', ' ', '\t', '\n', '\r':
+			return s.r.UnreadByte()
+		}
+		s.buf = append(s.buf, c)
+	}
+}
+
+// skipValue consumes the next value without keeping it
+func (s *coordinateScanner) skipValue() error {
+	c, err := s.nonSpace()
+	if err != nil {
+		return err
+	}
+	switch c {
+	case '"':
+		return s.readString()
+	case '{', '[':
+		depth := 1
+		for depth > 0 {
+			c, err := s.r.ReadByte()
+			if err != nil {
+				return io.ErrUnexpectedEOF
+			}
+			switch c {
+			case '"':
+				if err := s.readString(); err != nil {
+					return err
+				}
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+			}
+		}
+		return nil
+	default:
+		if err := s.r.UnreadByte(); err != nil {
+			return err
+		}
+		return s.readLiteral()
+	}
+}
@@ -0,0 +1,149 @@
+package gokomoot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// syntheticTourJSON returns tour JSON with n points along a line
+func syntheticTourJSON(n int) []byte {
+	var b strings.Builder
+	b.WriteString(`{"page":{"_embedded":{"tour":{"name":"Synthetic","date":"2024-05-01T08:00:00.000Z","sport":"touringbicycle","_embedded":{"coordinates":{"items":[`)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `{"lat":%.6f,"lng":%.6f,"alt":%.1f,"t":%d}`, 47+float64(i)*1e-5, 8+float64(i)*1e-5, 400+float64(i%100), i*1000)
+	}
+	b.WriteString(`]}}}}}}`)
+	return []byte(b.String())
+}
+
+func TestStreamGPXMatchesStructPath(t *testing.T) {
+	tourJSON := syntheticTourJSON(50)
+	converter := NewConverter(DefaultConfig())
+
+	var data KomootResponse
+	if err := json.Unmarshal(tourJSON, &data); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	want, err := converter.jsonToGPX(&data)
+	if err != nil {
+		t.Fatalf("jsonToGPX() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := converter.StreamGPX(context.Background(), bytes.NewReader(tourJSON), &out); err != nil {
+		t.Fatalf("StreamGPX() error = %v", err)
+	}
+	got, err := ReadGPX(&out)
+	if err != nil {
+		t.Fatalf("ReadGPX() error = %v", err)
+	}
+
+	if got.Metadata.Name != want.Metadata.Name || !got.Metadata.Time.Equal(*want.Metadata.Time) {
+		t.Errorf("StreamGPX() metadata = %q %v, want %q %v", got.Metadata.Name, got.Metadata.Time, want.Metadata.Name, want.Metadata.Time)
+	}
+	if got.Tracks[0].Type != want.Tracks[0].Type {
+		t.Errorf("StreamGPX() track type = %q, want %q", got.Tracks[0].Type, want.Tracks[0].Type)
+	}
+	gotPoints, wantPoints := got.Tracks[0].Segments[0].Points, want.Tracks[0].Segments[0].Points
+	if len(gotPoints) != len(wantPoints) {
+		t.Fatalf("StreamGPX() wrote %d points, want %d", len(gotPoints), len(wantPoints))
+	}
+	for i := range wantPoints {
+		g, w := gotPoints[i], wantPoints[i]
+		if g.Lat != w.Lat || g.Lon != w.Lon || g.Elevation != w.Elevation || !g.Time.Equal(*w.Time) {
+			t.Fatalf("StreamGPX() point %d = %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func TestStreamGPXWithoutCoordinates(t *testing.T) {
+	tourJSON := `{"page":{"_embedded":{"tour":{"name":"Empty","_embedded":{}}}}}`
+	err := NewConverter(DefaultConfig()).StreamGPX(context.Background(), strings.NewReader(tourJSON), io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "coordinates missing") {
+		t.Fatalf("StreamGPX() error = %v, want coordinates missing", err)
+	}
+}
+
+func TestStreamGPXFormatsPointsLikeTheEncoder(t *testing.T) {
+	tourJSON := `{"page":{"_embedded":{"tour":{"name":"A \"quoted\" tour","sport":"hike","date":"2024-05-01T08:00:00.000Z",` +
+		`"_embedded":{"coordinates":{"items":[` +
+		`{"lat":47.5,"lng":8.25,"alt":400.5,"t":1500},` +
+		` {"lat":47.6, "extra":{"a":["}",1]}, "note":"x\"y", "lng":8.3, "alt":null},` +
+		`{"lng":8.4}]}},"after":{"ignored":true}}}}}`
+	var out bytes.Buffer
+	if err := NewConverter(DefaultConfig()).StreamGPX(context.Background(), strings.NewReader(tourJSON), &out); err != nil {
+		t.Fatalf("StreamGPX() error = %v", err)
+	}
+
+	want := `<trkseg>
+      <trkpt lat="47.5" lon="8.25">
+        <ele>400.5</ele>
+        <time>2024-05-01T08:00:01.5Z</time>
+      </trkpt>
+      <trkpt lat="47.6" lon="8.3"></trkpt>
+    </trkseg>
+  </trk>
+</gpx>`
+	if got := out.String(); !strings.HasSuffix(got, want) {
+		t.Fatalf("StreamGPX() output =\n%s\nwant it to end with\n%s", got, want)
+	}
+	if !strings.Contains(out.String(), "<name>A &#34;quoted&#34; tour</name>") {
+		t.Fatalf("StreamGPX() output missing escaped name:\n%s", out.String())
+	}
+}
+
+func TestStreamGPXAllocationsDontGrowWithTourLength(t *testing.T) {
+	converter := NewConverter(DefaultConfig())
+	allocs := func(n int) float64 {
+		tourJSON := syntheticTourJSON(n)
+		return testing.AllocsPerRun(3, func() {
+			if err := converter.StreamGPX(context.Background(), bytes.NewReader(tourJSON), io.Discard); err != nil {
+				t.Fatalf("StreamGPX() error = %v", err)
+			}
+		})
+	}
+	// A few allocations of slack for the race detector; allocating per point
+	// would add thousands
+	if short, long := allocs(100), allocs(10000); long > short+10 {
+		t.Fatalf("StreamGPX() allocations = %v for 100 points and %v for 10000, want no growth", short, long)
+	}
+}
+
+func BenchmarkEncodeGPX(b *testing.B) {
+	tourJSON := syntheticTourJSON(200000)
+	converter := NewConverter(DefaultConfig())
+
+	b.Run("struct", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var data KomootResponse
+			if err := json.Unmarshal(tourJSON, &data); err != nil {
+				b.Fatal(err)
+			}
+			gpx, err := converter.jsonToGPX(&data)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err := encodeGPX(gpx, io.Discard); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("stream", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := converter.StreamGPX(context.Background(), bytes.NewReader(tourJSON), io.Discard); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package gokomoot
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// Elevation profile chart dimensions in SVG user units
+const (
+	svgWidth  = 800
+	svgHeight = 300
+	svgMargin = 50
+)
+
+// writeElevationSVG renders the elevation-vs-distance profile of the first
+// track as a standalone SVG line chart
+func writeElevationSVG(gpx *GPX, w io.Writer) error {
+	if len(gpx.Tracks) == 0 {
+		return fmt.Errorf("no track to plot")
+	}
+
+	var distances, elevations []float64
+	var previous *Point
+	total, hasElevation := 0.0, false
+	for _, segment := range gpx.Tracks[0].Segments {
+		for i := range segment.Points {
+			point := &segment.Points[i]
+			if previous != nil {
+				total += haversineDistance(*previous, *point)
+			}
+			distances = append(distances, total)
+			elevations = append(elevations, point.Elevation)
+			hasElevation = hasElevation || point.Elevation != 0
+			previous = point
+		}
+	}
+
+	if len(elevations) < 2 {
+		return fmt.Errorf("at least two points are needed to plot an elevation profile")
+	}
+	if !hasElevation {
+		return fmt.Errorf("tour has no elevation data to plot")
+	}
+
+	minElevation, maxElevation := elevations[0], elevations[0]
+	for _, elevation := range elevations {
+		minElevation = min(minElevation, elevation)
+		maxElevation = max(maxElevation, elevation)
+	}
+	elevationRange := maxElevation - minElevation
+	if elevationRange == 0 {
+		elevationRange = 1
+	}
+	distanceRange := total
+	if distanceRange == 0 {
+		distanceRange = 1
+	}
+
+	plotWidth := float64(svgWidth - 2*svgMargin)
+	plotHeight := float64(svgHeight - 2*svgMargin)
+	bottom := float64(svgHeight - svgMargin)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`+"\n",
+		svgWidth, svgHeight, svgWidth, svgHeight)
+
+	name := gpx.Tracks[0].Name
+	if name == "" && gpx.Metadata != nil {
+		name = gpx.Metadata.Name
+	}
+	if name != "" {
+		buf.WriteString("  <title>")
+		_ = xml.EscapeText(&buf, []byte(name))
+		buf.WriteString("</title>\n")
+	}
+
+	fmt.Fprintf(&buf, `  <rect width="100%%" height="100%%" fill="white"/>`+"\n")
+	fmt.Fprintf(&buf, `  <line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black"/>`+"\n", svgMargin, svgMargin, svgMargin, svgHeight-svgMargin)
+	fmt.Fprintf(&buf, `  <line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black"/>`+"\n", svgMargin, svgHeight-svgMargin, svgWidth-svgMargin, svgHeight-svgMargin)
+
+	buf.WriteString(`  <polyline fill="none" stroke="#2b6cb0" stroke-width="1.5" points="`)
+	for i := range elevations {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		x := svgMargin + distances[i]/distanceRange*plotWidth
+		y := bottom - (elevations[i]-minElevation)/elevationRange*plotHeight
+		fmt.Fprintf(&buf, "%.1f,%.1f", x, y)
+	}
+	buf.WriteString("\"/>\n")
+
+	fmt.Fprintf(&buf, `  <text x="%d" y="%d" text-anchor="end">%.0f m</text>`+"\n", svgMargin-5, svgHeight-svgMargin, minElevation)
+	fmt.Fprintf(&buf, `  <text x="%d" y="%d" text-anchor="end">%.0f m</text>`+"\n", svgMargin-5, svgMargin+4, maxElevation)
+	fmt.Fprintf(&buf, `  <text x="%d" y="%d" text-anchor="middle">0 km</text>`+"\n", svgMargin, svgHeight-svgMargin+15)
+	fmt.Fprintf(&buf, `  <text x="%d" y="%d" text-anchor="middle">%.1f km</text>`+"\n", svgWidth-svgMargin, svgHeight-svgMargin+15, total/1000)
+	fmt.Fprintf(&buf, `  <text x="%d" y="%d" text-anchor="middle">Distance (km)</text>`+"\n", svgWidth/2, svgHeight-10)
+	fmt.Fprintf(&buf, `  <text transform="translate(15 %d) rotate(-90)" text-anchor="middle">Elevation (m)</text>`+"\n", svgHeight/2)
+	buf.WriteString("</svg>\n")
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("error writing SVG: %w", err)
+	}
+	return nil
+}
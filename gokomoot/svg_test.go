@@ -0,0 +1,51 @@
+package gokomoot
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestWriteElevationSVG(t *testing.T) {
+	gpx := &GPX{Tracks: []Track{{Name: "Hill & valley", Segments: []Segment{{Points: []Point{
+		{Lat: 46.5, Lon: 8.0, Elevation: 1000},
+		{Lat: 46.51, Lon: 8.0, Elevation: 1200},
+		{Lat: 46.52, Lon: 8.0, Elevation: 1100},
+	}}}}}}
+
+	var buf bytes.Buffer
+	if err := writeElevationSVG(gpx, &buf); err != nil {
+		t.Fatalf("writeElevationSVG() error = %v", err)
+	}
+
+	svg := buf.String()
+	for _, want := range []string{
+		`<title>Hill &amp; valley</title>`,
+		`points="50.0,250.0 400.0,50.0 750.0,150.0"`,
+		`>1000 m</text>`,
+		`>1200 m</text>`,
+		`>2.2 km</text>`,
+	} {
+		if !strings.Contains(svg, want) {
+			t.Fatalf("SVG output missing %q:\n%s", want, svg)
+		}
+	}
+
+	var parsed any
+	if err := xml.Unmarshal(buf.Bytes(), &parsed); err != nil {
+		t.Fatalf("xml.Unmarshal() error = %v", err)
+	}
+}
+
+func TestWriteElevationSVGRequiresElevation(t *testing.T) {
+	gpx := &GPX{Tracks: []Track{{Segments: []Segment{{Points: []Point{
+		{Lat: 46.5, Lon: 8.0},
+		{Lat: 46.51, Lon: 8.0},
+	}}}}}}
+
+	err := writeElevationSVG(gpx, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "no elevation data") {
+		t.Fatalf("writeElevationSVG() error = %v, want no elevation data error", err)
+	}
+}
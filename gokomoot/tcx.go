@@ -0,0 +1,195 @@
+package gokomoot
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// tcxDatabase is the root of a Garmin Training Center (TCX) v2 file
+type tcxDatabase struct {
+	XMLName    xml.Name      `xml:"http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2 TrainingCenterDatabase"`
+	Activities []tcxActivity `xml:"Activities>Activity"`
+}
+
+// tcxActivity is one activity, identified by its start time
+type tcxActivity struct {
+	Sport string    `xml:"Sport,attr"`
+	ID    time.Time `xml:"Id"`
+	Laps  []tcxLap  `xml:"Lap"`
+}
+
+// tcxLap holds the totals of a lap and its points, one Track per segment
+type tcxLap struct {
+	StartTime        time.Time  `xml:"StartTime,attr"`
+	TotalTimeSeconds float64    `xml:"TotalTimeSeconds"`
+	DistanceMeters   float64    `xml:"DistanceMeters"`
+	Calories         int        `xml:"Calories"`
+	Intensity        string     `xml:"Intensity"`
+	TriggerMethod    string     `xml:"TriggerMethod"`
+	Tracks           []tcxTrack `xml:"Track"`
+}
+
+// tcxTrack is a run of trackpoints without gaps
+type tcxTrack struct {
+	Points []tcxTrackpoint `xml:"Trackpoint"`
+}
+
+// tcxTrackpoint is a point with its distance from the start of the activity
+type tcxTrackpoint struct {
+	Time           time.Time   `xml:"Time"`
+	Position       tcxPosition `xml:"Position"`
+	AltitudeMeters *float64    `xml:"AltitudeMeters,omitempty"`
+	DistanceMeters float64     `xml:"DistanceMeters"`
+}
+
+// tcxPosition is a position in degrees
+type tcxPosition struct {
+	Lat float64 `xml:"LatitudeDegrees"`
+	Lon float64 `xml:"LongitudeDegrees"`
+}
+
+// TCX sports; the schema knows no others
+const (
+	tcxSportBiking  = "Biking"
+	tcxSportRunning = "Running"
+	tcxSportOther   = "Other"
+)
+
+// tcxSport maps a Komoot sport such as touring_bicycle or jogging to a TCX
+// sport
+func tcxSport(sport string) string {
+	switch {
+	case strings.Contains(sport, "bicycle"), strings.Contains(sport, "bike"), strings.Contains(sport, "mtb"):
+		return tcxSportBiking
+	case sport == "jogging", strings.Contains(sport, "running"):
+		return tcxSportRunning
+	default:
+		return tcxSportOther
+	}
+}
+
+// tcxSpeeds are the speeds in meters per second at which points without a
+// time are assumed to be reached, by TCX sport
+var tcxSpeeds = map[string]float64{
+	tcxSportBiking:  15 / 3.6,
+	tcxSportRunning: 10 / 3.6,
+	tcxSportOther:   4 / 3.6,
+}
+
+// writeTCX encodes the tracks as a TCX activity with one lap per track, for
+// importing into Garmin Connect. The activity takes its sport from the first
+// track. TCX requires a time on every point, so points without one get a
+// synthesized time, see withPointTimes.
+func writeTCX(gpx *GPX, w io.Writer, indent string) error {
+	var laps []tcxLap
+	var distance float64
+	for _, track := range withPointTimes(gpx).Tracks {
+		if lap := tcxTrackLap(track, &distance); len(lap.Tracks) > 0 {
+			laps = append(laps, lap)
+		}
+	}
+	if len(laps) == 0 {
+		return errors.New("no track points to write")
+	}
+	database := tcxDatabase{Activities: []tcxActivity{{Sport: tcxSport(gpx.Tracks[0].Type), ID: laps[0].StartTime, Laps: laps}}}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("error writing XML header: %w", err)
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", indent)
+	if err := encoder.Encode(database); err != nil {
+		return fmt.Errorf("error encoding TCX: %w", err)
+	}
+	return nil
+}
+
+// withPointTimes returns gpx with a time on every track point, copying the
+// tracks if any point has none. Such a point is timed as reached from the
+// point before at a typical speed for the track's sport. The clock starts at
+// the earliest point time, else the metadata time, else the Unix epoch.
+func withPointTimes(gpx *GPX) *GPX {
+	untimed := false
+	gpx.eachPoint(func(p *Point) {
+		untimed = untimed || p.Time == nil
+	})
+	if !untimed {
+		return gpx
+	}
+
+	clock, _, ok := gpx.TimeRange()
+	if !ok {
+		clock = time.Unix(0, 0).UTC()
+		if gpx.Metadata != nil && gpx.Metadata.Time != nil {
+			clock = *gpx.Metadata.Time
+		}
+	}
+
+	timed := *gpx
+	timed.Tracks = slices.Clone(gpx.Tracks)
+	for i := range timed.Tracks {
+		track := &timed.Tracks[i]
+		speed := tcxSpeeds[tcxSport(track.Type)]
+		track.Segments = slices.Clone(track.Segments)
+		for j := range track.Segments {
+			points := slices.Clone(track.Segments[j].Points)
+			for k := range points {
+				if points[k].Time != nil {
+					clock = *points[k].Time
+					continue
+				}
+				if k > 0 {
+					clock = clock.Add(time.Duration(haversineDistance(points[k-1], points[k]) / speed * float64(time.Second)))
+				}
+				pointTime := clock
+				points[k].Time = &pointTime
+			}
+			track.Segments[j].Points = points
+		}
+	}
+	return &timed
+}
+
+// tcxTrackLap converts a track whose points all have a time to a lap.
+// distance is the distance covered by the laps before it, which the
+// trackpoints continue from; the gap between two tracks isn't counted.
+func tcxTrackLap(track Track, distance *float64) tcxLap {
+	var lap tcxLap
+	for _, segment := range track.Segments {
+		if len(segment.Points) == 0 {
+			continue
+		}
+		tcxSegment := tcxTrack{Points: make([]tcxTrackpoint, 0, len(segment.Points))}
+		for i, point := range segment.Points {
+			if i > 0 {
+				*distance += haversineDistance(segment.Points[i-1], point)
+			}
+			trackpoint := tcxTrackpoint{
+				Time:           point.Time.UTC(),
+				Position:       tcxPosition{Lat: point.Lat, Lon: point.Lon},
+				DistanceMeters: *distance,
+			}
+			if !point.NoElevation {
+				elevation := point.Elevation
+				trackpoint.AltitudeMeters = &elevation
+			}
+			tcxSegment.Points = append(tcxSegment.Points, trackpoint)
+		}
+		lap.Tracks = append(lap.Tracks, tcxSegment)
+	}
+
+	single := &GPX{Tracks: []Track{track}}
+	lap.DistanceMeters = single.TotalDistance(DistanceOptions{})
+	if start, end, ok := single.TimeRange(); ok {
+		lap.StartTime = start.UTC()
+		lap.TotalTimeSeconds = end.Sub(start).Seconds()
+	}
+	lap.Intensity = "Active"
+	lap.TriggerMethod = "Manual"
+	return lap
+}
@@ -0,0 +1,137 @@
+package gokomoot
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestWriteTCXRoundTrip(t *testing.T) {
+	var response KomootResponse
+	payload := `{"page":{"_embedded":{"tour":{"name":"Ride","sport":"touring_bicycle","date":"2021-06-05T09:30:00.000+02:00","_embedded":{"coordinates":{"items":[` +
+		`{"lat":52.5,"lng":13.4,"alt":35,"t":0},{"lat":52.501,"lng":13.4,"alt":36,"t":30000},{"lat":52.502,"lng":13.4,"t":60000}]}}}}}}`
+	if err := json.Unmarshal([]byte(payload), &response); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	gpx, err := NewConverter(DefaultConfig()).jsonToGPX(&response)
+	if err != nil {
+		t.Fatalf("jsonToGPX() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeTCX(gpx, &buf, "  "); err != nil {
+		t.Fatalf("writeTCX() error = %v", err)
+	}
+	var database tcxDatabase
+	if err := xml.Unmarshal(buf.Bytes(), &database); err != nil {
+		t.Fatalf("xml.Unmarshal() error = %v", err)
+	}
+
+	if len(database.Activities) != 1 || len(database.Activities[0].Laps) != 1 {
+		t.Fatalf("TCX = %s, want one activity with one lap", buf.String())
+	}
+	activity := database.Activities[0]
+	start := time.Date(2021, 6, 5, 7, 30, 0, 0, time.UTC)
+	if activity.Sport != tcxSportBiking || !activity.ID.Equal(start) {
+		t.Fatalf("activity = %s %v, want Biking %v", activity.Sport, activity.ID, start)
+	}
+	lap := activity.Laps[0]
+	if !lap.StartTime.Equal(start) || lap.TotalTimeSeconds != 60 || math.Abs(lap.DistanceMeters-222.39) > 0.01 {
+		t.Fatalf("lap = %v, %v s, %v m, want %v, 60 s, about 222.39 m", lap.StartTime, lap.TotalTimeSeconds, lap.DistanceMeters, start)
+	}
+
+	points := gpx.Tracks[0].Segments[0].Points
+	trackpoints := lap.Tracks[0].Points
+	if len(trackpoints) != len(points) {
+		t.Fatalf("trackpoint count = %d, want %d", len(trackpoints), len(points))
+	}
+	for i, trackpoint := range trackpoints {
+		if trackpoint.Position.Lat != points[i].Lat || trackpoint.Position.Lon != points[i].Lon || !trackpoint.Time.Equal(*points[i].Time) {
+			t.Fatalf("trackpoint %d = %#v, want %#v", i, trackpoint, points[i])
+		}
+	}
+	if trackpoints[1].AltitudeMeters == nil || *trackpoints[1].AltitudeMeters != 36 || trackpoints[2].AltitudeMeters != nil {
+		t.Fatalf("altitudes = %v, %v, want 36 and none", trackpoints[1].AltitudeMeters, trackpoints[2].AltitudeMeters)
+	}
+	if trackpoints[2].DistanceMeters != lap.DistanceMeters {
+		t.Fatalf("last trackpoint distance = %v, want lap distance %v", trackpoints[2].DistanceMeters, lap.DistanceMeters)
+	}
+}
+
+func TestWriteTCXWritesALapPerTrack(t *testing.T) {
+	start := time.Date(2021, 6, 5, 7, 30, 0, 0, time.UTC)
+	at := func(minutes int) *time.Time {
+		pointTime := start.Add(time.Duration(minutes) * time.Minute)
+		return &pointTime
+	}
+	// Two days of a merged trip, about 111.2 m each, with a gap between them
+	gpx := &GPX{Tracks: []Track{
+		{Type: "hike", Segments: []Segment{{Points: []Point{{Lat: 0, Lon: 0, Time: at(0)}, {Lat: 0.001, Lon: 0, Time: at(2)}}}}},
+		{Type: "hike", Segments: []Segment{{Points: []Point{{Lat: 1, Lon: 0, Time: at(1440)}, {Lat: 1.001, Lon: 0, Time: at(1443)}}}}},
+	}}
+
+	var buf bytes.Buffer
+	if err := writeTCX(gpx, &buf, "  "); err != nil {
+		t.Fatalf("writeTCX() error = %v", err)
+	}
+	var database tcxDatabase
+	if err := xml.Unmarshal(buf.Bytes(), &database); err != nil {
+		t.Fatalf("xml.Unmarshal() error = %v", err)
+	}
+
+	laps := database.Activities[0].Laps
+	if len(laps) != 2 {
+		t.Fatalf("lap count = %d, want one per track", len(laps))
+	}
+	if !laps[1].StartTime.Equal(*at(1440)) || laps[1].TotalTimeSeconds != 180 || math.Abs(laps[1].DistanceMeters-111.19) > 0.01 {
+		t.Fatalf("second lap = %v, %v s, %v m, want %v, 180 s, about 111.19 m", laps[1].StartTime, laps[1].TotalTimeSeconds, laps[1].DistanceMeters, *at(1440))
+	}
+	if last := laps[1].Tracks[0].Points[1]; math.Abs(last.DistanceMeters-222.39) > 0.01 {
+		t.Fatalf("last trackpoint distance = %v, want about 222.39 m from the start of the activity", last.DistanceMeters)
+	}
+}
+
+func TestWriteTCXSynthesizesMissingPointTimes(t *testing.T) {
+	start := time.Date(2021, 6, 5, 7, 30, 0, 0, time.UTC)
+	// About 1112 m apart, which takes 1000 s at 4 km/h on foot
+	gpx := &GPX{
+		Metadata: &Metadata{Time: &start},
+		Tracks:   []Track{{Type: "hike", Segments: []Segment{{Points: []Point{{Lat: 52.5, Lon: 13.4}, {Lat: 52.51, Lon: 13.4}}}}}},
+	}
+
+	var buf bytes.Buffer
+	if err := writeTCX(gpx, &buf, "  "); err != nil {
+		t.Fatalf("writeTCX() error = %v", err)
+	}
+	var database tcxDatabase
+	if err := xml.Unmarshal(buf.Bytes(), &database); err != nil {
+		t.Fatalf("xml.Unmarshal() error = %v", err)
+	}
+
+	lap := database.Activities[0].Laps[0]
+	if !lap.StartTime.Equal(start) || math.Abs(lap.TotalTimeSeconds-1000.8) > 0.1 || math.Abs(lap.DistanceMeters-1111.95) > 0.01 {
+		t.Fatalf("lap = %v, %v s, %v m, want %v, about 1000.8 s and 1111.95 m", lap.StartTime, lap.TotalTimeSeconds, lap.DistanceMeters, start)
+	}
+	if gpx.Tracks[0].Segments[0].Points[1].Time != nil {
+		t.Fatal("writeTCX() set times on the input points")
+	}
+}
+
+func TestTCXSport(t *testing.T) {
+	tests := map[string]string{
+		"touring_bicycle": tcxSportBiking,
+		"e_mtb":           tcxSportBiking,
+		"racebike":        tcxSportBiking,
+		"jogging":         tcxSportRunning,
+		"hike":            tcxSportOther,
+		"":                tcxSportOther,
+	}
+	for sport, want := range tests {
+		if got := tcxSport(sport); got != want {
+			t.Fatalf("tcxSport(%q) = %q, want %q", sport, got, want)
+		}
+	}
+}
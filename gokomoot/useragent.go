@@ -0,0 +1,26 @@
+package gokomoot
+
+import "math/rand/v2"
+
+// creator is written as the creator of every GPX document. It used to be
+// taken from the User-Agent, which may now be a browser's.
+const creator = "komootgpx"
+
+// browserUserAgents are current desktop and mobile browser User-Agents that
+// RotateUserAgent picks from
+var browserUserAgents = []string{
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.0 Safari/605.1.15",
+	"Mozilla/5.0 (X11; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:131.0) Gecko/20100101 Firefox/131.0",
+	"Mozilla/5.0 (iPhone; CPU iPhone OS 18_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.0 Mobile/15E148 Safari/604.1",
+}
+
+// userAgent returns the User-Agent for a request: the configured one, or a
+// random browser User-Agent with RotateUserAgent
+func (c *Converter) userAgent() string {
+	if c.config.RotateUserAgent {
+		return browserUserAgents[rand.N(len(browserUserAgents))]
+	}
+	return c.config.UserAgent
+}
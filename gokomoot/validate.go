@@ -0,0 +1,111 @@
+package gokomoot
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ValidationProblem is one problem ValidateGPX found in a GPX document
+type ValidationProblem struct {
+	// Line is the line of the element in the document
+	Line int
+	// Element is trkpt, rtept or wpt for a point, or gpx for the document
+	Element string
+	// Index counts the points of the same element from 0, in document order
+	Index int
+	Err   error
+}
+
+func (p ValidationProblem) String() string {
+	if p.Element == "gpx" {
+		return fmt.Sprintf("line %d: %v", p.Line, p.Err)
+	}
+	return fmt.Sprintf("line %d: %s %d: %v", p.Line, p.Element, p.Index, p.Err)
+}
+
+// ValidateGPX checks a GPX document without converting it: the root element,
+// its namespace, version and creator, and every track, route and waypoint
+// with Point.Validate. Unlike ReadGPX it doesn't stop at the first problem
+// but returns all of them. The error is for documents that aren't
+// well-formed XML, which can't be checked any further.
+func ValidateGPX(r io.Reader) ([]ValidationProblem, error) {
+	decoder := xml.NewDecoder(r)
+	var problems []ValidationProblem
+	counts := map[string]int{}
+	root := true
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return problems, fmt.Errorf("error decoding GPX: %w", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		line, _ := decoder.InputPos()
+
+		if root {
+			root = false
+			for _, err := range validateGPXRoot(start) {
+				problems = append(problems, ValidationProblem{Line: line, Element: "gpx", Err: err})
+			}
+			continue
+		}
+
+		name := start.Name.Local
+		if name != "trkpt" && name != "rtept" && name != "wpt" {
+			continue
+		}
+		index := counts[name]
+		counts[name]++
+
+		var point Point
+		err = decoder.DecodeElement(&point, &start)
+		if err == nil {
+			err = point.Validate()
+		}
+		if err != nil {
+			problems = append(problems, ValidationProblem{Line: line, Element: name, Index: index, Err: err})
+		}
+	}
+	if root {
+		return nil, errors.New("error decoding GPX: empty document")
+	}
+	return problems, nil
+}
+
+// validateGPXRoot checks the namespace and the attributes the GPX schema
+// requires on the root element
+func validateGPXRoot(start xml.StartElement) []error {
+	if start.Name.Local != "gpx" {
+		return []error{fmt.Errorf("root element is <%s>, not <gpx>", start.Name.Local)}
+	}
+
+	var version, creator string
+	for _, attr := range start.Attr {
+		switch attr.Name.Local {
+		case "version":
+			version = attr.Value
+		case "creator":
+			creator = attr.Value
+		}
+	}
+
+	var errs []error
+	switch {
+	case start.Name.Space == GPXNamespace && version != "1.1",
+		start.Name.Space == GPXNamespace10 && version != "1.0":
+		errs = append(errs, fmt.Errorf("version %q doesn't match namespace %s", version, start.Name.Space))
+	case start.Name.Space != GPXNamespace && start.Name.Space != GPXNamespace10:
+		errs = append(errs, fmt.Errorf("namespace %q is not the GPX 1.0 or 1.1 namespace", start.Name.Space))
+	}
+	if creator == "" {
+		errs = append(errs, errors.New("missing creator attribute"))
+	}
+	return errs
+}
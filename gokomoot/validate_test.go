@@ -0,0 +1,69 @@
+package gokomoot
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateGPXReportsEveryProblem(t *testing.T) {
+	content := `<?xml version="1.0"?>
+<gpx version="1.0" xmlns="http://www.topografix.com/GPX/1/1">
+  <wpt lat="46.5" lon="8.1"><name>Fine</name></wpt>
+  <trk><trkseg>
+    <trkpt lat="46.5" lon="8.1"><ele>1200</ele></trkpt>
+    <trkpt lat="95" lon="8.1"></trkpt>
+    <trkpt lat="46.5" lon="8.1"><ele>12000</ele></trkpt>
+    <trkpt lat="north" lon="8.1"></trkpt>
+  </trkseg></trk>
+</gpx>`
+
+	problems, err := ValidateGPX(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("ValidateGPX() error = %v", err)
+	}
+	want := []string{
+		`line 2: version "1.0" doesn't match namespace http://www.topografix.com/GPX/1/1`,
+		"line 2: missing creator attribute",
+		"line 6: trkpt 1: invalid latitude: 95.000000",
+		"line 7: trkpt 2: invalid elevation: 12000.000000",
+		"line 8: trkpt 3: strconv.ParseFloat",
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("ValidateGPX() = %v, want %d problems", problems, len(want))
+	}
+	for i, problem := range problems {
+		if !strings.HasPrefix(problem.String(), want[i]) {
+			t.Fatalf("problem %d = %q, want %q", i, problem, want[i])
+		}
+	}
+}
+
+func TestValidateGPXAcceptsValidDocuments(t *testing.T) {
+	for _, content := range []string{
+		`<gpx version="1.1" creator="x" xmlns="http://www.topografix.com/GPX/1/1"><trk><trkseg><trkpt lat="1" lon="2"/></trkseg></trk></gpx>`,
+		`<gpx version="1.0" creator="x" xmlns="http://www.topografix.com/GPX/1/0"><rte><rtept lat="1" lon="2"/></rte></gpx>`,
+	} {
+		if problems, err := ValidateGPX(strings.NewReader(content)); err != nil || len(problems) != 0 {
+			t.Fatalf("ValidateGPX(%s) = %v, %v, want no problems", content, problems, err)
+		}
+	}
+}
+
+func TestValidateGPXRejectsMalformedDocuments(t *testing.T) {
+	for content, want := range map[string]string{
+		"":                        "empty document",
+		`<gpx creator="x"><trk>`:  "error decoding GPX",
+		`<kml creator="x"></kml>`: "",
+	} {
+		problems, err := ValidateGPX(strings.NewReader(content))
+		if want == "" {
+			if err != nil || len(problems) != 1 || !strings.Contains(problems[0].String(), "not <gpx>") {
+				t.Fatalf("ValidateGPX(%q) = %v, %v, want a root element problem", content, problems, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("ValidateGPX(%q) error = %v, want %q", content, err, want)
+		}
+	}
+}
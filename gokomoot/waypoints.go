@@ -0,0 +1,53 @@
+package gokomoot
+
+import "strings"
+
+// DefaultWaypointSymbol is the symbol of highlights whose category isn't in
+// the symbol table
+const DefaultWaypointSymbol = "Waypoint"
+
+// highlightSymbols maps Komoot highlight categories to the standard Garmin
+// waypoint symbol names, which most other GPS devices and apps understand as
+// well. Configuration.WaypointSymbols overrides entries.
+var highlightSymbols = map[string]string{
+	"viewpoint":      "Scenic Area",
+	"waterfall":      "Scenic Area",
+	"water":          "Drinking Water",
+	"drinking_water": "Drinking Water",
+	"peak":           "Summit",
+	"summit":         "Summit",
+	"restaurant":     "Restaurant",
+	"cafe":           "Restaurant",
+	"bar":            "Bar",
+	"parking":        "Parking Area",
+	"campsite":       "Campground",
+	"accommodation":  "Lodging",
+	"hut":            "Lodging",
+	"toilet":         "Restroom",
+	"bridge":         "Bridge",
+	"museum":         "Museum",
+	"church":         "Church",
+	"beach":          "Beach",
+	"swimming":       "Swimming Area",
+	"forest":         "Forest",
+	"picnic":         "Picnic Area",
+	"train_station":  "Ground Transportation",
+	"bus_stop":       "Ground Transportation",
+}
+
+// waypointSymbol returns the symbol for a highlight category, looking it up
+// in overrides and then highlightSymbols. Highlights without a category get
+// no symbol, leaving the choice to the device.
+func waypointSymbol(category string, overrides map[string]string) string {
+	if category == "" {
+		return ""
+	}
+	category = strings.ToLower(category)
+	if symbol, ok := overrides[category]; ok {
+		return symbol
+	}
+	if symbol, ok := highlightSymbols[category]; ok {
+		return symbol
+	}
+	return DefaultWaypointSymbol
+}
@@ -0,0 +1,50 @@
+package gokomoot
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestWaypointSymbol(t *testing.T) {
+	overrides := map[string]string{"water": "Water Source", "ferry": "Anchor"}
+	tests := map[string]string{
+		"viewpoint": "Scenic Area",
+		"Viewpoint": "Scenic Area",
+		"water":     "Water Source",
+		"ferry":     "Anchor",
+		"ruin":      DefaultWaypointSymbol,
+		"":          "",
+	}
+	for category, want := range tests {
+		if got := waypointSymbol(category, overrides); got != want {
+			t.Fatalf("waypointSymbol(%q) = %q, want %q", category, got, want)
+		}
+	}
+}
+
+func TestJSONToGPXWaypointDetails(t *testing.T) {
+	payload := `{"page":{"_embedded":{"tour":{"_embedded":{
+		"coordinates":{"items":[{"lat":51.5,"lng":-0.12,"alt":35}]},
+		"highlights":{"items":[
+			{"name":"Hilltop","description":"Views over the city","category":"viewpoint","mid_point":{"lat":51.51,"lng":-0.121}}
+		]}}}}}}`
+	var response KomootResponse
+	if err := json.Unmarshal([]byte(payload), &response); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	gpx, err := NewConverter(DefaultConfig()).jsonToGPX(&response)
+	if err != nil {
+		t.Fatalf("jsonToGPX() error = %v", err)
+	}
+	var buf bytes.Buffer
+	if err := encodeGPX(gpx, &buf); err != nil {
+		t.Fatalf("encodeGPX() error = %v", err)
+	}
+	want := "<name>Hilltop</name>\n    <desc>Views over the city</desc>\n    <sym>Scenic Area</sym>\n    <type>viewpoint</type>"
+	if !strings.Contains(buf.String(), want) {
+		t.Fatalf("GPX output missing waypoint details %q:\n%s", want, buf.String())
+	}
+}
@@ -1,406 +1,1019 @@
+// Command gokomoot converts Komoot tours to GPX files.
 package main
 
 import (
+	"bufio"
 	"context"
-	"encoding/json"
-	"encoding/xml"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
-	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
+
+	"github.com/mfkd/gokomoot/gokomoot"
 )
 
-// Configuration holds application settings
-type Configuration struct {
-	UserAgent     string
-	HTTPTimeout   time.Duration
-	MaxRetries    int
-	RetryInterval time.Duration
-}
+// Exit codes. Invalid usage and a failed single tour exit with exitError;
+// when converting several tours, exitSomeFailed and exitAllFailed tell a
+// partly failed run from one where nothing was converted, and
+// exitInterrupted a batch stopped by Ctrl-C or SIGTERM, as shells report a
+// process killed by SIGINT. Code 2 is left to the flag package, which uses
+// it for flags that can't be parsed.
+const (
+	exitOK          = 0
+	exitError       = 1
+	exitSomeFailed  = 3
+	exitAllFailed   = 4
+	exitInterrupted = 130
+)
 
-// DefaultConfig returns default configuration values
-func DefaultConfig() Configuration {
-	return Configuration{
-		UserAgent:     "komootgpx",
-		HTTPTimeout:   10 * time.Second,
-		MaxRetries:    3,
-		RetryInterval: 2 * time.Second,
+// parseElevationBands parses comma-separated, strictly ascending elevations
+func parseElevationBands(value string) ([]float64, error) {
+	fields := strings.Split(value, ",")
+	bands := make([]float64, 0, len(fields))
+	for _, field := range fields {
+		band, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid elevation %q", field)
+		}
+		if len(bands) > 0 && band <= bands[len(bands)-1] {
+			return nil, fmt.Errorf("elevations must be strictly ascending")
+		}
+		bands = append(bands, band)
 	}
+	return bands, nil
 }
 
-// Models
+// parseBoundingBox parses a minLon,minLat,maxLon,maxLat bounding box
+func parseBoundingBox(value string) (*gokomoot.Bounds, error) {
+	fields := strings.Split(value, ",")
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("expected minLon,minLat,maxLon,maxLat, got %d values", len(fields))
+	}
+	coordinates := make([]float64, len(fields))
+	for i, field := range fields {
+		coordinate, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid coordinate %q", field)
+		}
+		coordinates[i] = coordinate
+	}
 
-// GPX represents the root GPX element
-type GPX struct {
-	XMLName  xml.Name  `xml:"gpx"`
-	XMLNS    string    `xml:"xmlns,attr,omitempty"`
-	Version  string    `xml:"version,attr"`
-	Creator  string    `xml:"creator,attr"`
-	Metadata *Metadata `xml:"metadata,omitempty"`
-	Tracks   []Track   `xml:"trk"`
+	bounds := &gokomoot.Bounds{MinLon: coordinates[0], MinLat: coordinates[1], MaxLon: coordinates[2], MaxLat: coordinates[3]}
+	if bounds.MinLon > bounds.MaxLon || bounds.MinLat > bounds.MaxLat {
+		return nil, fmt.Errorf("minimum coordinates must not exceed the maximum ones")
+	}
+	if bounds.MinLat < -90 || bounds.MaxLat > 90 || bounds.MinLon < -180 || bounds.MaxLon > 180 {
+		return nil, fmt.Errorf("coordinates out of range")
+	}
+	return bounds, nil
 }
 
-// Metadata represents GPX metadata
-type Metadata struct {
-	Name string `xml:"name,omitempty"`
+// byteSizeUnits maps size suffixes to their multipliers. KB, MB and GB are
+// decimal; KiB, MiB and GiB are binary.
+var byteSizeUnits = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9},
+	{"B", 1},
 }
 
-// Track represents a GPX track
-type Track struct {
-	Name     string    `xml:"name,omitempty"`
-	Segments []Segment `xml:"trkseg"`
+// parseByteSize parses a size like 1MB, 512KiB or 2048 into bytes
+func parseByteSize(value string) (int64, error) {
+	number, multiplier := strings.TrimSpace(value), 1.0
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(strings.ToUpper(number), strings.ToUpper(unit.suffix)) {
+			number, multiplier = strings.TrimSpace(number[:len(number)-len(unit.suffix)]), unit.multiplier
+			break
+		}
+	}
+
+	size, err := strconv.ParseFloat(number, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return int64(size * multiplier), nil
 }
 
-// Segment represents a track segment
-type Segment struct {
-	Points []Point `xml:"trkpt"`
+// komootHostPattern matches Komoot's own hosts, including regional domains
+// like komoot.de
+var komootHostPattern = regexp.MustCompile(`^([a-z0-9-]+\.)*komoot\.[a-z]{2,3}$`)
+
+// languagePattern matches the language tags accepted by -lang, like de or
+// de-DE
+var languagePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z]{2})?$`)
+
+// systemLanguage returns the language of the user's locale from LC_ALL,
+// LC_MESSAGES or LANG as a tag like de-DE, or en when none is set
+func systemLanguage() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		locale := os.Getenv(name)
+		if locale == "" || locale == "C" || locale == "POSIX" {
+			continue
+		}
+		locale, _, _ = strings.Cut(locale, ".")
+		locale, _, _ = strings.Cut(locale, "@")
+		locale = strings.ReplaceAll(locale, "_", "-")
+		if languagePattern.MatchString(locale) {
+			return locale
+		}
+	}
+	return "en"
 }
 
-// Point represents a track point with validation methods
-type Point struct {
-	Lat       float64 `xml:"lat,attr"`
-	Lon       float64 `xml:"lon,attr"`
-	Elevation float64 `xml:"ele"`
+// localePath returns Komoot's locale path prefix for a language tag, such as
+// /de-de for de or de-DE. English is Komoot's default and gets no prefix
+// unless a region is given.
+func localePath(language string) string {
+	language = strings.ToLower(language)
+	if language == "en" {
+		return ""
+	}
+	base, region, ok := strings.Cut(language, "-")
+	if !ok {
+		region = base
+	}
+	return "/" + base + "-" + region
 }
 
-// Validate checks if the point coordinates are valid
-func (p Point) Validate() error {
-	if p.Lat < -90 || p.Lat > 90 {
-		return fmt.Errorf("invalid latitude: %f", p.Lat)
+// normalizeTourURL turns a bare tour ID or a Komoot tour link into the
+// canonical URL to fetch. Bare IDs get the locale path prefix, if any. Tour
+// and collection pages on any Komoot domain are rewritten to
+// www.komoot.com; other Komoot links, such as short share links, are kept so
+// the redirect to the tour is followed when downloading.
+func normalizeTourURL(input, locale string) (string, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return "", fmt.Errorf("empty tour URL")
+	}
+	if _, err := strconv.ParseUint(input, 10, 64); err == nil {
+		return "https://www.komoot.com" + locale + "/tour/" + input, nil
+	}
+	if !strings.Contains(input, "://") {
+		input = "https://" + input
+	}
+
+	resolved, err := gokomoot.ResolveTourURL(input)
+	if err != nil {
+		return "", err
+	}
+	parsedURL, err := url.Parse(resolved)
+	if err != nil {
+		return "", fmt.Errorf("error parsing URL: %w", err)
+	}
+	if parsedURL.Scheme != "https" && parsedURL.Scheme != "http" {
+		return "", fmt.Errorf("%q is not a Komoot tour: unsupported scheme %q", input, parsedURL.Scheme)
+	}
+	if !komootHostPattern.MatchString(parsedURL.Hostname()) {
+		return "", fmt.Errorf("%q is not a Komoot tour or collection: expected a tour ID or a komoot.com link", input)
+	}
+
+	if kind, id, ok := gokomoot.ParseTourPath(parsedURL.Path); ok {
+		parsedURL.Scheme = "https"
+		parsedURL.Host = "www.komoot.com"
+		parsedURL.Path = "/" + kind + "/" + string(id)
+		return parsedURL.String(), nil
 	}
-	if p.Lon < -180 || p.Lon > 180 {
-		return fmt.Errorf("invalid longitude: %f", p.Lon)
+	if id, ok := gokomoot.ParseCollectionPath(parsedURL.Path); ok {
+		parsedURL.Scheme = "https"
+		parsedURL.Host = "www.komoot.com"
+		parsedURL.Path = "/collection/" + id
+		return parsedURL.String(), nil
 	}
-	return nil
+	if parsedURL.Path == "" || strings.Contains(parsedURL.Path, "/tour/") || strings.Contains(parsedURL.Path, "/smarttour/") || strings.Contains(parsedURL.Path, "/collection/") {
+		return "", fmt.Errorf("%q is not a Komoot tour or collection: no tour or collection ID in the link", input)
+	}
+	return parsedURL.String(), nil
 }
 
-// KomootResponse represents the JSON structure from Komoot
-type KomootResponse struct {
-	Page struct {
-		Embedded struct {
-			Tour struct {
-				Name     string `json:"name"`
-				Embedded struct {
-					Coordinates *struct {
-						Items []struct {
-							Lat float64 `json:"lat"`
-							Lng float64 `json:"lng"`
-							Alt float64 `json:"alt"`
-						} `json:"items"`
-					} `json:"coordinates"`
-				} `json:"_embedded"`
-			} `json:"tour"`
-		} `json:"_embedded"`
-	} `json:"page"`
+// tourArgs returns the tour arguments with the URLs listed in urlsFile added
+// and an argument of - replaced by the URLs listed on stdin
+func tourArgs(args []string, urlsFile string, stdin io.Reader) ([]string, error) {
+	var tours []string
+	for _, arg := range args {
+		if arg != "-" {
+			tours = append(tours, arg)
+			continue
+		}
+		urls, err := readURLList(stdin)
+		if err != nil {
+			return nil, fmt.Errorf("stdin: %w", err)
+		}
+		tours = append(tours, urls...)
+	}
+
+	if urlsFile != "" {
+		file, err := os.Open(urlsFile)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		urls, err := readURLList(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", urlsFile, err)
+		}
+		tours = append(tours, urls...)
+	}
+	return tours, nil
 }
 
-// GPXConverter handles the conversion process
-type GPXConverter struct {
-	config Configuration
-	client *http.Client
-	logger *log.Logger
+// readURLList reads one tour URL or ID per line, skipping blank lines and
+// comments starting with #
+func readURLList(r io.Reader) ([]string, error) {
+	var urls []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	return urls, scanner.Err()
 }
 
-// NewGPXConverter creates a new GPXConverter instance
-func NewGPXConverter(config Configuration) *GPXConverter {
-	return &GPXConverter{
-		config: config,
-		client: &http.Client{
-			Timeout: config.HTTPTimeout,
-		},
-		logger: log.New(os.Stderr, "komootgpx: ", log.LstdFlags),
+// defaultConfigFile is the config file read when -config isn't given, or ""
+// when the user's config directory is unknown
+func defaultConfigFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
 	}
+	return filepath.Join(dir, "gokomoot.toml")
 }
 
-// makeHTTPRequest makes an HTTP GET request with retries
-func (c *GPXConverter) makeHTTPRequest(ctx context.Context, url string) (string, error) {
-	var lastError error
-	attempts := c.config.MaxRetries
-	if attempts < 1 {
-		attempts = 1
+// loadConfigFile sets the flags named in the config file at path, except
+// those given on the command line. Flags sharing a variable, like -o and
+// -output, count as given together. The file holds one name = value pair
+// per line, a flat subset of TOML, with blank lines and # comments ignored.
+// A missing file is only an error when required.
+func loadConfigFile(flags *flag.FlagSet, path string, required bool) error {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return nil
 	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
 
-	for attempt := 0; attempt < attempts; attempt++ {
-		if attempt > 0 {
-			c.logger.Printf("Retry attempt %d/%d\n", attempt+1, attempts)
-			if err := sleepWithContext(ctx, c.config.RetryInterval); err != nil {
-				return "", fmt.Errorf("retry canceled: %w", err)
-			}
-		}
+	explicit := map[flag.Value]bool{}
+	flags.Visit(func(f *flag.Flag) { explicit[f.Value] = true })
 
-		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return fmt.Errorf("%s:%d: expected name = value", path, line)
+		}
+		name = strings.TrimSpace(name)
+		f := flags.Lookup(name)
+		if f == nil || name == "config" {
+			return fmt.Errorf("%s:%d: unknown setting %q", path, line, name)
+		}
+		value, err := configValue(strings.TrimSpace(value))
 		if err != nil {
-			lastError = fmt.Errorf("error creating request: %w", err)
+			return fmt.Errorf("%s:%d: %s: %w", path, line, name, err)
+		}
+		if explicit[f.Value] {
 			continue
 		}
+		if err := flags.Set(name, value); err != nil {
+			return fmt.Errorf("%s:%d: %s: %w", path, line, name, err)
+		}
+	}
+	return scanner.Err()
+}
 
-		req.Header.Set("User-Agent", c.config.UserAgent)
+// configValue returns a config file value, unquoting TOML strings and
+// dropping a trailing comment
+func configValue(value string) (string, error) {
+	var rest string
+	switch {
+	case strings.HasPrefix(value, `"`):
+		quoted, err := strconv.QuotedPrefix(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", value)
+		}
+		rest = value[len(quoted):]
+		value, _ = strconv.Unquote(quoted)
+	case strings.HasPrefix(value, "'"):
+		end := strings.IndexByte(value[1:], '\'')
+		if end == -1 {
+			return "", fmt.Errorf("unterminated string %s", value)
+		}
+		rest = value[end+2:]
+		value = value[1 : end+1]
+	default:
+		value, _, _ = strings.Cut(value, "#")
+		return strings.TrimSpace(value), nil
+	}
+	if rest = strings.TrimSpace(rest); rest != "" && !strings.HasPrefix(rest, "#") {
+		return "", fmt.Errorf("unexpected %q after the value", rest)
+	}
+	return value, nil
+}
 
-		resp, err := c.client.Do(req)
+// normalizeTourURLs normalizes each of args with normalizeTourURL
+func normalizeTourURLs(args []string, locale string) ([]string, error) {
+	urls := make([]string, len(args))
+	for i, arg := range args {
+		url, err := normalizeTourURL(arg, locale)
 		if err != nil {
-			if ctxErr := ctx.Err(); ctxErr != nil {
-				return "", fmt.Errorf("request canceled: %w", ctxErr)
-			}
-			lastError = fmt.Errorf("error making request: %w", err)
-			continue
+			return nil, err
 		}
+		urls[i] = url
+	}
+	return urls, nil
+}
 
-		body, readErr := io.ReadAll(resp.Body)
-		closeErr := resp.Body.Close()
-		if readErr != nil {
-			lastError = fmt.Errorf("error reading response body: %w", readErr)
+// expandCollections replaces the collection links among urls with the URLs
+// of the tours in each collection
+func expandCollections(ctx context.Context, converter *gokomoot.Converter, urls []string) ([]string, error) {
+	var expanded []string
+	for _, url := range urls {
+		if !gokomoot.IsCollectionURL(url) {
+			expanded = append(expanded, url)
 			continue
 		}
-		if closeErr != nil {
-			lastError = fmt.Errorf("error closing response body: %w", closeErr)
-			continue
+		tours, err := converter.CollectionTourURLs(ctx, url)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", url, err)
 		}
+		expanded = append(expanded, tours...)
+	}
+	return expanded, nil
+}
 
-		if resp.StatusCode != http.StatusOK {
-			lastError = fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-			if !shouldRetryStatus(resp.StatusCode) {
-				return "", lastError
-			}
-			continue
+// validateFiles checks each GPX file with gokomoot.ValidateGPX, printing its
+// problems and a summary line to w, and returns exitError when any file has
+// problems or can't be read
+func validateFiles(paths []string, w io.Writer) int {
+	code := exitOK
+	for _, path := range paths {
+		problems, err := validateFile(path)
+		for _, problem := range problems {
+			fmt.Fprintf(w, "%s: %s\n", path, problem)
+		}
+		switch {
+		case err != nil:
+			fmt.Fprintf(w, "%s: %v\n", path, err)
+			code = exitError
+		case len(problems) == 1:
+			fmt.Fprintf(w, "%s: 1 problem\n", path)
+			code = exitError
+		case len(problems) > 1:
+			fmt.Fprintf(w, "%s: %d problems\n", path, len(problems))
+			code = exitError
+		default:
+			fmt.Fprintf(w, "%s: valid\n", path)
 		}
-
-		return string(body), nil
 	}
-
-	return "", fmt.Errorf("all retry attempts failed: %w", lastError)
+	return code
 }
 
-func shouldRetryStatus(statusCode int) bool {
-	return statusCode == http.StatusTooManyRequests || statusCode >= 500
+// validateFile runs gokomoot.ValidateGPX on the file at path
+func validateFile(path string) ([]gokomoot.ValidationProblem, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return gokomoot.ValidateGPX(file)
 }
 
-func sleepWithContext(ctx context.Context, duration time.Duration) error {
-	if duration <= 0 {
+// tourErrors splits the error returned by ConvertBatch into the errors of
+// the individual tours that failed
+func tourErrors(err error) []error {
+	if err == nil {
 		return nil
 	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
+
+// batchExitCode is the exit code for a batch of total tours of which failed
+// tours failed
+func batchExitCode(total, failed int) int {
+	switch {
+	case failed == 0:
+		return exitOK
+	case failed < total:
+		return exitSomeFailed
+	}
+	return exitAllFailed
+}
 
-	timer := time.NewTimer(duration)
-	defer timer.Stop()
+// defaultTourDeadline is how much of the run each tour gets when -deadline
+// isn't set
+const defaultTourDeadline = 30 * time.Second
 
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case <-timer.C:
-		return nil
+// defaultDeadline is the time limit for converting the given number of tours
+// when -deadline isn't set
+func defaultDeadline(tours int) time.Duration {
+	return time.Duration(max(tours, 1)) * defaultTourDeadline
+}
+
+// errorHint points at the flag to change when err is caused by an existing
+// output file or by the overall deadline running out
+func errorHint(err error) string {
+	switch {
+	case errors.Is(err, gokomoot.ErrOutputExists):
+		return " (use -overwrite to replace it)"
+	case errors.Is(err, gokomoot.ErrRequestTimeout), errors.Is(err, gokomoot.ErrTourTimeout):
+		return ""
+	case errors.Is(err, context.DeadlineExceeded):
+		return " (the -deadline for the whole run was reached)"
+	}
+	return ""
+}
+
+// parseIndent turns the -indent value into the indentation to use, accepting
+// \t as an escape for a tab since shells pass it through literally
+func parseIndent(value string) (string, error) {
+	indent := strings.ReplaceAll(value, `\t`, "\t")
+	if strings.Trim(indent, " \t") != "" {
+		return "", fmt.Errorf("invalid -indent %q: use spaces, tabs or an empty string", value)
 	}
+	return indent, nil
 }
 
-// ConvertKomootToGPX performs the complete conversion process
-func (c *GPXConverter) ConvertKomootToGPX(ctx context.Context, url, outputPath string) error {
-	// Download and process the tour data
-	c.logger.Printf("Downloading tour data from %s\n", url)
-	html, err := c.makeHTTPRequest(ctx, url)
+// isGPXFile reports whether arg names a local GPX file rather than a tour
+func isGPXFile(arg string) bool {
+	return strings.EqualFold(filepath.Ext(arg), ".gpx") && !strings.Contains(arg, "://")
+}
+
+// parseProxyURL parses an http, https or socks5 proxy URL
+func parseProxyURL(value string) (*url.URL, error) {
+	proxyURL, err := url.Parse(value)
 	if err != nil {
-		return fmt.Errorf("failed to download tour data: %w", err)
+		return nil, err
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, expected http, https or socks5", proxyURL.Scheme)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("no host in proxy URL %q", value)
+	}
+	return proxyURL, nil
+}
+
+func main() {
+	log.SetPrefix("komootgpx: ")
+
+	var output, format string
+	flag.StringVar(&output, "o", "", "The file to create, - for stdout, or a directory for one file per tour")
+	flag.StringVar(&output, "output", "", "The file to create, - for stdout, or a directory for one file per tour")
+	flag.StringVar(&format, "f", "", "Output format: "+strings.Join(gokomoot.OutputFormats, ", ")+" (default from the -o extension, gpx for stdout)")
+	flag.StringVar(&format, "format", "", "Output format: "+strings.Join(gokomoot.OutputFormats, ", ")+" (default from the -o extension, gpx for stdout)")
+	indent := flag.String("indent", gokomoot.DefaultConfig().Indent, `Indentation of GPX, KML, TCX and GeoJSON output: spaces, "\t" for tabs, or "" for compact output`)
+	polylinePrecision := flag.Int("polyline-precision", gokomoot.PolylinePrecision5, "Coordinate decimals for -f polyline, 5 or 6")
+	leafletURL := flag.String("leaflet-url", gokomoot.DefaultConfig().LeafletURL, "Base URL serving leaflet.js and leaflet.css for -f html")
+	tileURL := flag.String("tile-url", gokomoot.DefaultConfig().TileURL, "Map tile URL template for -f html")
+	metadataTime := flag.String("metadata-time", gokomoot.MetadataTimeRecord, "Metadata time to write: record, now or none")
+	segmentBySurface := flag.Bool("segment-by-surface", false, "Start a new track segment wherever the surface changes")
+	name := flag.String("name", "", "Name for the track instead of the Komoot tour name")
+	keywords := flag.String("keywords", "", "Comma-separated keywords to add to the GPX metadata")
+	closeLoop := flag.Bool("close-loop", false, "Snap the last point onto the first when the tour is a loop")
+	loopThreshold := flag.Float64("loop-threshold", gokomoot.DefaultConfig().LoopThreshold, "Maximum start/end distance in meters for a tour to count as a loop")
+	cumulativeElevation := flag.Bool("emit-cumulative-elevation", false, "Write cumulative ascent and descent on every track point")
+	extensions := flag.Bool("extensions", false, "Write the speed of every track point as a Garmin TrackPointExtension, when the tour has times")
+	simplifyTolerance := flag.Float64("simplify", 0, "Simplify the track, dropping points within this tolerance in meters")
+	interpolateElevation := flag.Bool("interpolate-ele", false, "Fill in missing elevations by interpolating between neighboring points")
+	stripElevation := flag.Bool("no-elevation", false, "Omit all elevations from the output")
+	dedupe := flag.Bool("dedupe", false, "Drop points at the same position as the point before them")
+	every := flag.Int("every", 1, "Keep only every Nth track point, plus the last one")
+	splitKM := flag.Float64("split-km", 0, "Split the track into parts of about this many kilometers, written as numbered files")
+	elevationThreshold := flag.Float64("elevation-threshold", gokomoot.DefaultConfig().ElevationThreshold, "Minimum elevation change in meters counted as ascent or descent")
+	previewTolerance := flag.Float64("with-preview", 0, "Add a simplified preview track using this tolerance in meters")
+	localOffset := flag.Bool("local-offset", false, "Store the tour's local UTC offset in the metadata extensions")
+	verifyRoundTrip := flag.Bool("verify-roundtrip", false, "Re-read the written GPX file and check it matches the converted points")
+	setModTime := flag.Bool("set-mtime", false, "Set the output file's modification time to the tour date")
+	bbox := flag.String("bbox", "", "Keep only the points inside minLon,minLat,maxLon,maxLat")
+	elevationBands := flag.String("elevation-bands", "", "Comma-separated ascending elevations in meters; emit one track per band")
+	emitDistance := flag.Bool("emit-distance", false, "Store the track distance in the GPX metadata extensions")
+	distance3D := flag.Bool("distance-3d", false, "Include elevation changes in the track distance")
+	distanceRadius := flag.Float64("earth-radius", gokomoot.EarthRadius, "Earth radius in meters used for the track distance")
+	matchKomootDistance := flag.Bool("match-komoot-distance", false, "Scale the stored distance to Komoot's reported distance and log the scale factor")
+	strict := flag.Bool("strict", false, "Fail a tour whose track distance differs from Komoot's by more than 10%, instead of warning")
+	maxPoints := flag.Int("max-points", 0, "Simplify the track until it has at most this many points")
+	targetSize := flag.String("target-size", "", "Simplify the track until the output fits this size, e.g. 500KB or 1MB")
+	segmentSize := flag.Int("seg-size", 0, "Split tracks into segments of at most this many points")
+	retryBudget := flag.Int("retry-budget", 0, "Maximum number of retries for all requests together, after which failing requests aren't retried; 0 for no limit")
+	rate := flag.Float64("rate", 0, "Maximum number of requests per second for all requests together; 0 for no limit")
+	timeout := flag.Duration("timeout", gokomoot.DefaultConfig().HTTPTimeout, "Time limit for each HTTP request")
+	tourTimeout := flag.Duration("tour-timeout", gokomoot.DefaultConfig().TourTimeout, "Time limit for each tour with a directory output, retries included; 0 for none")
+	deadline := flag.Duration("deadline", 0, "Time limit for the whole run (default 30s per tour)")
+	concurrency := flag.Int("concurrency", gokomoot.DefaultConfig().Concurrency, "Maximum number of tours converted at a time with a directory output")
+	concurrencyPerHost := flag.Int("concurrency-per-host", 0, "Maximum number of requests to the same host at a time, such as the tour pages' or the API's; 0 for no separate limit")
+	proxy := flag.String("proxy", "", "Proxy URL for all requests, e.g. http://proxy:3128 (default from HTTP_PROXY and HTTPS_PROXY)")
+	dnsCache := flag.Bool("dns-cache", false, "Cache DNS lookups in-process")
+	dnsCacheTTL := flag.Duration("dns-cache-ttl", 5*time.Minute, "How long cached DNS lookups stay valid with -dns-cache")
+	noWaypoints := flag.Bool("no-waypoints", false, "Leave out the tour's highlights instead of writing them as waypoints")
+	fetch := flag.String("fetch", gokomoot.FetchAuto, "How to get tour data: html scrapes the tour page, api asks the Komoot API, auto tries the page and then the API")
+	lang := flag.String("lang", "", "Language for tour names and descriptions, like de or de-DE, sent as Accept-Language (default from the system locale, or en)")
+	userAgent := flag.String("user-agent", gokomoot.DefaultConfig().UserAgent, "User-Agent header sent with every request")
+	rotateUA := flag.Bool("rotate-ua", false, "Send a random common browser User-Agent with each request instead of -user-agent")
+	cookie := flag.String("cookie", "", "Komoot session cookie(s) as name=value pairs, for private tours; defaults to $GOKOMOOT_COOKIE")
+	quiet := flag.Bool("q", false, "Only print errors")
+	verbose := flag.Bool("v", false, "Also log details like response sizes and retry reasons")
+	stdinHTML := flag.Bool("stdin-html", false, "Read the Komoot tour page HTML from stdin instead of downloading it")
+	in := flag.String("in", "", "Process this local GPX file instead of downloading a tour; a single .gpx argument works too")
+	validate := flag.Bool("validate", false, "Check the GPX files given as arguments and print every problem found, instead of converting")
+	cacheDir := flag.String("cache-dir", "", "Directory to remember converted tours in, so unchanged tours are skipped on later runs")
+	overwrite := flag.Bool("overwrite", false, "Replace output files that already exist instead of failing")
+	dryRun := flag.Bool("dry-run", false, "Download and validate the tours and print a summary of each without writing files")
+	urlsFile := flag.String("urls-file", "", "Read tour URLs from this file, one per line, in addition to the arguments; an argument of - reads them from stdin")
+	appendTours := flag.Bool("append", false, "Write all tours into the single -o file, one track per tour")
+	diff := flag.Bool("diff", false, "Compare two Komoot tours and print their differences instead of converting")
+	configFile := flag.String("config", "", "Read default flag values from this file, as name = value lines (default "+defaultConfigFile()+" if it exists)")
+	flag.Parse()
+
+	configPath := *configFile
+	if configPath == "" {
+		configPath = defaultConfigFile()
+	}
+	if configPath != "" {
+		if err := loadConfigFile(flag.CommandLine, configPath, *configFile != ""); err != nil {
+			fmt.Printf("Invalid config file: %v\n", err)
+			flag.Usage()
+			os.Exit(1)
+		}
 	}
 
-	c.logger.Println("Extracting JSON data from HTML")
-	jsonData, err := extractJSONFromHTML(html)
+	args, err := tourArgs(flag.Args(), *urlsFile, os.Stdin)
 	if err != nil {
-		return fmt.Errorf("failed to extract JSON data: %w", err)
+		log.Fatalf("Error reading tour URLs: %v", err)
 	}
 
-	var komootResp KomootResponse
-	if err := json.Unmarshal(jsonData, &komootResp); err != nil {
-		return fmt.Errorf("failed to parse JSON data: %w", err)
+	inputFile := *in
+	if inputFile == "" && len(args) == 1 && isGPXFile(args[0]) {
+		inputFile = args[0]
 	}
 
-	gpx, err := c.jsonToGPX(&komootResp)
-	if err != nil {
-		return fmt.Errorf("failed to convert to GPX: %w", err)
+	if *validate {
+		if inputFile != "" && !slices.Contains(args, inputFile) {
+			args = append(args, inputFile)
+		}
+		if len(args) == 0 {
+			fmt.Println("Please provide the GPX files to validate")
+			flag.Usage()
+			os.Exit(1)
+		}
+		os.Exit(validateFiles(args, os.Stdout))
 	}
 
-	if err := writeGPX(gpx, outputPath); err != nil {
-		return fmt.Errorf("failed to write GPX file: %w", err)
+	switch {
+	case *diff && len(args) != 2:
+		fmt.Println("Please provide exactly two Komoot URLs to compare")
+		flag.Usage()
+		os.Exit(1)
+	case *diff:
+	case *appendTours && (*stdinHTML || inputFile != ""):
+		fmt.Println("Please provide Komoot URLs with -append, not -stdin-html or a GPX file")
+		flag.Usage()
+		os.Exit(1)
+	case *stdinHTML && len(args) != 0:
+		fmt.Println("Please provide either a Komoot URL or -stdin-html, not both")
+		flag.Usage()
+		os.Exit(1)
+	case *in != "" && len(args) != 0:
+		fmt.Println("Please provide either a Komoot URL or -in, not both")
+		flag.Usage()
+		os.Exit(1)
+	case inputFile != "" && *stdinHTML:
+		fmt.Println("Please provide either a GPX file or -stdin-html, not both")
+		flag.Usage()
+		os.Exit(1)
+	case !*stdinHTML && inputFile == "" && len(args) == 0:
+		fmt.Println("Please provide at least one Komoot URL")
+		flag.Usage()
+		os.Exit(1)
 	}
 
-	c.logger.Printf("Successfully created GPX file: %s\n", outputPath)
-	return nil
-}
+	collection := slices.ContainsFunc(args, gokomoot.IsCollectionURL)
+	batch := false
+	if *appendTours {
+		if info, err := os.Stat(output); err == nil && info.IsDir() {
+			fmt.Println("Please specify an output file, not a directory, with -append")
+			flag.Usage()
+			os.Exit(1)
+		}
+	} else if info, err := os.Stat(output); err == nil && info.IsDir() && !*diff && !*stdinHTML && inputFile == "" {
+		batch = true
+	} else if (len(args) > 1 || collection) && *dryRun && !*diff {
+		batch = true
+	} else if len(args) > 1 && !*diff {
+		fmt.Println("Please specify an existing directory with -o to convert several tours")
+		flag.Usage()
+		os.Exit(1)
+	} else if collection && !*diff {
+		fmt.Println("Please specify an existing directory with -o, or -append, to convert a collection")
+		flag.Usage()
+		os.Exit(1)
+	}
 
-// jsonToGPX converts JSON data to GPX format
-func (c *GPXConverter) jsonToGPX(data *KomootResponse) (*GPX, error) {
-	if data.Page.Embedded.Tour.Embedded.Coordinates == nil {
-		return nil, fmt.Errorf("coordinates missing in tour data")
+	if output == "" && !*diff && !*dryRun {
+		fmt.Println("Please specify an output file using -o or --output")
+		flag.Usage()
+		os.Exit(1)
 	}
 
-	tourName := data.Page.Embedded.Tour.Name
-	coordinates := data.Page.Embedded.Tour.Embedded.Coordinates.Items
-	if len(coordinates) == 0 {
-		return nil, fmt.Errorf("no coordinates found in tour data")
+	switch *metadataTime {
+	case gokomoot.MetadataTimeRecord, gokomoot.MetadataTimeNow, gokomoot.MetadataTimeNone:
+	default:
+		fmt.Println("Please specify -metadata-time as record, now or none")
+		flag.Usage()
+		os.Exit(1)
 	}
 
-	gpx := &GPX{
-		XMLNS:   "http://www.topografix.com/GPX/1/1",
-		Version: "1.1",
-		Creator: c.config.UserAgent,
-		Tracks: []Track{
-			{
-				Name: tourName,
-				Segments: []Segment{
-					{Points: make([]Point, 0, len(coordinates))},
-				},
-			},
-		},
+	if !slices.Contains(gokomoot.FetchModes, *fetch) {
+		fmt.Println("Please specify -fetch as " + strings.Join(gokomoot.FetchModes, ", "))
+		flag.Usage()
+		os.Exit(1)
 	}
-	if tourName != "" {
-		gpx.Metadata = &Metadata{Name: tourName}
+
+	if *simplifyTolerance < 0 {
+		fmt.Println("Please specify -simplify as a non-negative tolerance in meters")
+		flag.Usage()
+		os.Exit(1)
 	}
 
-	for _, item := range coordinates {
-		point := Point{
-			Lat:       item.Lat,
-			Lon:       item.Lng,
-			Elevation: item.Alt,
-		}
+	if *every < 1 {
+		fmt.Println("Please specify -every as a number of points of at least 1")
+		flag.Usage()
+		os.Exit(1)
+	}
 
-		if err := point.Validate(); err != nil {
-			return nil, fmt.Errorf("invalid point data: %w", err)
-		}
+	if *maxPoints < 0 {
+		fmt.Println("Please specify -max-points as a positive number of points")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *lang == "" {
+		*lang = systemLanguage()
+	} else if !languagePattern.MatchString(*lang) {
+		fmt.Println("Please specify -lang as a language like de or de-DE")
+		flag.Usage()
+		os.Exit(1)
+	}
+	locale := localePath(*lang)
 
-		gpx.Tracks[0].Segments[0].Points = append(gpx.Tracks[0].Segments[0].Points, point)
+	if *splitKM < 0 {
+		fmt.Println("Please specify -split-km as a non-negative number of kilometers")
+		flag.Usage()
+		os.Exit(1)
 	}
 
-	return gpx, nil
-}
+	if *splitKM > 0 && output == "-" {
+		fmt.Println("-split-km writes numbered files and can't write to stdout")
+		flag.Usage()
+		os.Exit(1)
+	}
 
-// extractJSONFromHTML extracts JSON data embedded in the HTML content
-func extractJSONFromHTML(htmlContent string) ([]byte, error) {
-	startMarker := `kmtBoot.setProps(`
+	if *splitKM > 0 && (*previewTolerance > 0 || *elevationBands != "") {
+		fmt.Println("-split-km can't be combined with -with-preview or -elevation-bands, whose extra tracks it would cut apart")
+		flag.Usage()
+		os.Exit(1)
+	}
 
-	startIdx := strings.Index(htmlContent, startMarker)
-	if startIdx == -1 {
-		return nil, fmt.Errorf("start marker not found in HTML content")
+	if *elevationThreshold < 0 {
+		fmt.Println("Please specify -elevation-threshold as a non-negative number of meters")
+		flag.Usage()
+		os.Exit(1)
 	}
-	startIdx += len(startMarker)
-	for startIdx < len(htmlContent) && (htmlContent[startIdx] == ' ' || htmlContent[startIdx] == '\t' || htmlContent[startIdx] == '\n' || htmlContent[startIdx] == '\r') {
-		startIdx++
+
+	if *segmentSize < 0 {
+		fmt.Println("Please specify -seg-size as a positive number of points")
+		flag.Usage()
+		os.Exit(1)
 	}
 
-	literal, err := extractJSONStringLiteral(htmlContent[startIdx:])
-	if err != nil {
-		return nil, err
+	if *quiet && *verbose {
+		fmt.Println("Please specify either -q or -v, not both")
+		flag.Usage()
+		os.Exit(1)
 	}
 
-	var jsonStr string
-	if err := json.Unmarshal([]byte(literal), &jsonStr); err != nil {
-		return nil, fmt.Errorf("failed to decode boot JSON string: %w", err)
+	if *retryBudget < 0 {
+		fmt.Println("Please specify -retry-budget as a number of retries of at least 0")
+		flag.Usage()
+		os.Exit(1)
 	}
 
-	return []byte(jsonStr), nil
-}
+	if *rate < 0 {
+		fmt.Println("Please specify -rate as a number of requests per second of at least 0")
+		flag.Usage()
+		os.Exit(1)
+	}
 
-func extractJSONStringLiteral(input string) (string, error) {
-	if input == "" || input[0] != '"' {
-		return "", fmt.Errorf("kmtBoot.setProps argument is not a JSON string literal")
+	if *concurrency < 1 {
+		fmt.Println("Please specify -concurrency as a positive number")
+		flag.Usage()
+		os.Exit(1)
 	}
 
-	escaped := false
-	for idx := 1; idx < len(input); idx++ {
-		switch {
-		case escaped:
-			escaped = false
-		case input[idx] == '\\':
-			escaped = true
-		case input[idx] == '"':
-			return input[:idx+1], nil
-		}
+	if *concurrencyPerHost < 0 {
+		fmt.Println("Please specify -concurrency-per-host as a non-negative number")
+		flag.Usage()
+		os.Exit(1)
 	}
 
-	return "", fmt.Errorf("unterminated kmtBoot.setProps JSON string literal")
-}
+	if *timeout <= 0 || *tourTimeout < 0 || *deadline < 0 {
+		fmt.Println("Please specify -timeout as a positive duration and -tour-timeout and -deadline as durations of at least 0")
+		flag.Usage()
+		os.Exit(1)
+	}
 
-// writeGPX writes GPX data to a file
-func writeGPX(gpx *GPX, filename string) (err error) {
-	file, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
-	if err != nil {
-		return fmt.Errorf("error creating temporary file: %w", err)
+	if *distanceRadius <= 0 {
+		fmt.Println("Please specify -earth-radius as a positive number of meters")
+		flag.Usage()
+		os.Exit(1)
 	}
-	tempName := file.Name()
-	defer func() {
-		if err != nil {
-			_ = file.Close()
-			_ = os.Remove(tempName)
+
+	if format == "" {
+		format = gokomoot.FormatGPX
+		if output != "" && output != "-" && output != "stdout:" && !batch && !*diff {
+			var err error
+			if format, err = gokomoot.FormatForPath(output); err != nil {
+				fmt.Printf("Can't infer the output format: %v; please specify -f\n", err)
+				flag.Usage()
+				os.Exit(1)
+			}
 		}
-	}()
+	}
 
-	encoder := xml.NewEncoder(file)
-	encoder.Indent("", "  ")
+	if !slices.Contains(gokomoot.OutputFormats, format) {
+		fmt.Printf("Unknown output format %q\n", format)
+		flag.Usage()
+		os.Exit(1)
+	}
 
-	if _, err = file.WriteString(xml.Header); err != nil {
-		return fmt.Errorf("error writing XML header: %w", err)
+	var targetBytes int64
+	if *targetSize != "" {
+		var err error
+		if targetBytes, err = parseByteSize(*targetSize); err != nil {
+			fmt.Printf("Invalid -target-size: %v\n", err)
+			flag.Usage()
+			os.Exit(1)
+		}
 	}
 
-	if err = encoder.Encode(gpx); err != nil {
-		return fmt.Errorf("error encoding GPX: %w", err)
+	if *polylinePrecision != gokomoot.PolylinePrecision5 && *polylinePrecision != gokomoot.PolylinePrecision6 {
+		fmt.Println("Please specify -polyline-precision as 5 or 6")
+		flag.Usage()
+		os.Exit(1)
 	}
 
-	if err = file.Close(); err != nil {
-		return fmt.Errorf("error closing GPX file: %w", err)
+	outputIndent, err := parseIndent(*indent)
+	if err != nil {
+		fmt.Println(err)
+		flag.Usage()
+		os.Exit(1)
 	}
 
-	if err = os.Rename(tempName, filename); err != nil {
-		return fmt.Errorf("error moving GPX file into place: %w", err)
+	if *verifyRoundTrip && format != gokomoot.FormatGPX {
+		fmt.Println("-verify-roundtrip only supports GPX output")
+		flag.Usage()
+		os.Exit(1)
 	}
 
-	return nil
-}
+	config := gokomoot.DefaultConfig()
+	config.Format = format
+	config.Indent = outputIndent
+	config.PolylinePrecision = *polylinePrecision
+	config.LeafletURL = *leafletURL
+	config.TileURL = *tileURL
+	config.MetadataTime = *metadataTime
+	config.Name = *name
+	config.CloseLoop = *closeLoop
+	config.LoopThreshold = *loopThreshold
+	config.EmitCumulativeElevation = *cumulativeElevation
+	config.EmitSpeed = *extensions
+	config.ElevationThreshold = *elevationThreshold
+	config.SimplifyTolerance = *simplifyTolerance
+	config.DedupeConsecutive = *dedupe
+	config.InterpolateElevation = *interpolateElevation
+	config.StripElevation = *stripElevation
+	config.DownsampleEvery = *every
+	config.SplitDistance = *splitKM
+	config.PreviewTolerance = *previewTolerance
+	config.SetModTime = *setModTime
+	config.EmitLocalOffset = *localOffset
+	config.SegmentSize = *segmentSize
+	config.TargetSize = targetBytes
+	config.MaxPoints = *maxPoints
+	config.EmitDistance = *emitDistance
+	config.Distance = gokomoot.DistanceOptions{EarthRadius: *distanceRadius, Elevation: *distance3D}
+	config.MatchKomootDistance = *matchKomootDistance
+	config.Strict = *strict
+	config.VerifyRoundTrip = *verifyRoundTrip
+	config.Concurrency = *concurrency
+	config.ConcurrencyPerHost = *concurrencyPerHost
+	config.HTTPTimeout = *timeout
+	config.RetryBudget = *retryBudget
+	config.RequestsPerSecond = *rate
+	config.CacheDir = *cacheDir
+	config.Fetch = *fetch
+	config.TourTimeout = *tourTimeout
+	config.SkipWaypoints = *noWaypoints
+	config.SegmentBySurface = *segmentBySurface
+	config.DryRun = *dryRun
+	config.Overwrite = *overwrite
+	switch {
+	case *quiet:
+		config.Verbosity = gokomoot.VerbosityQuiet
+	case *verbose:
+		config.Verbosity = gokomoot.VerbosityVerbose
+	}
+	config.UserAgent = *userAgent
+	config.AcceptLanguage = *lang
+	config.RotateUserAgent = *rotateUA
+	config.SessionCookie = *cookie
+	if config.SessionCookie == "" {
+		config.SessionCookie = os.Getenv("GOKOMOOT_COOKIE")
+	}
+	if *dnsCache {
+		config.DNSCacheTTL = *dnsCacheTTL
+	}
+	if *proxy != "" {
+		proxyURL, err := parseProxyURL(*proxy)
+		if err != nil {
+			fmt.Printf("Invalid -proxy: %v\n", err)
+			flag.Usage()
+			os.Exit(1)
+		}
+		config.Proxy = proxyURL
+	}
+	if *bbox != "" {
+		bounds, err := parseBoundingBox(*bbox)
+		if err != nil {
+			fmt.Printf("Invalid -bbox: %v\n", err)
+			flag.Usage()
+			os.Exit(1)
+		}
+		config.ClipBounds = bounds
+	}
+	if *elevationBands != "" {
+		bands, err := parseElevationBands(*elevationBands)
+		if err != nil {
+			fmt.Printf("Invalid -elevation-bands: %v\n", err)
+			flag.Usage()
+			os.Exit(1)
+		}
+		config.ElevationBands = bands
+	}
+	if *keywords != "" {
+		config.Keywords = strings.Split(*keywords, ",")
+	}
+	converter := gokomoot.NewConverter(config)
 
-// removeQueryParamFromURL removes query parameters from a URL
-func removeQueryParamFromURL(urlString string) (string, error) {
-	parsedURL, err := url.Parse(urlString)
-	if err != nil {
-		return "", fmt.Errorf("error parsing URL: %w", err)
+	// Ctrl-C or SIGTERM cancels the conversion so partially written files
+	// are removed. Once canceled, the default handling is restored so a
+	// second Ctrl-C exits right away.
+	interruptCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-interruptCtx.Done()
+		stop()
+	}()
+	// -deadline limits the whole run. Without it, each step gets 30 seconds
+	// per tour, counted after collections are expanded into their tours.
+	runCtx := context.Context(interruptCtx)
+	if *deadline > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(interruptCtx, *deadline)
+		defer cancel()
+	}
+	toursCtx := func(tours int) (context.Context, context.CancelFunc) {
+		if *deadline > 0 {
+			return context.WithCancel(runCtx)
+		}
+		return context.WithTimeout(runCtx, defaultDeadline(tours))
 	}
+	ctx, cancel := toursCtx(len(args))
+	defer cancel()
 
-	// Remove query parameters
-	parsedURL.RawQuery = ""
+	if *diff {
+		tours := make([]*gokomoot.GPX, 2)
+		for i := range tours {
+			url, err := normalizeTourURL(args[i], locale)
+			if err != nil {
+				log.Fatalf("Error resolving tour URL: %v", err)
+			}
+			if tours[i], err = converter.FetchGPX(ctx, url); err != nil {
+				log.Fatalf("Error fetching tour: %v", err)
+			}
+		}
+		fmt.Print(gokomoot.DiffGPX(tours[0], tours[1]))
+		return
+	}
 
-	return parsedURL.String(), nil
-}
+	if inputFile != "" {
+		file, err := os.Open(inputFile)
+		if err != nil {
+			log.Fatalf("Error opening GPX file: %v", err)
+		}
+		defer file.Close()
+		if err := converter.ConvertGPX(ctx, file, output); err != nil {
+			log.Fatalf("Error converting GPX file: %v%s", err, errorHint(err))
+		}
+		return
+	}
 
-func main() {
-	var output string
-	flag.StringVar(&output, "o", "", "The GPX file to create")
-	flag.StringVar(&output, "output", "", "The GPX file to create")
-	flag.Parse()
+	if *stdinHTML {
+		html, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatalf("Error reading HTML from stdin: %v", err)
+		}
+		if err := converter.ConvertFromHTML(ctx, string(html), output); err != nil {
+			log.Fatalf("Error converting tour: %v%s", err, errorHint(err))
+		}
+		return
+	}
 
-	if flag.NArg() != 1 {
-		fmt.Println("Please provide exactly one Komoot URL")
-		flag.Usage()
-		os.Exit(1)
+	if *appendTours {
+		urls, err := normalizeTourURLs(args, locale)
+		if err != nil {
+			log.Fatalf("Error resolving tour URL: %v", err)
+		}
+		if urls, err = expandCollections(ctx, converter, urls); err != nil {
+			log.Fatalf("Error reading collection: %v%s", err, errorHint(err))
+		}
+		ctx, cancel := toursCtx(len(urls))
+		defer cancel()
+		if err := converter.ConvertMerged(ctx, urls, output); err != nil {
+			log.Fatalf("Error converting tours: %v%s", err, errorHint(err))
+		}
+		return
 	}
 
-	if output == "" {
-		fmt.Println("Please specify an output file using -o or --output")
-		flag.Usage()
-		os.Exit(1)
+	if batch {
+		urls, err := normalizeTourURLs(args, locale)
+		if err != nil {
+			log.Fatalf("Error resolving tour URL: %v", err)
+		}
+		if urls, err = expandCollections(ctx, converter, urls); err != nil {
+			log.Fatalf("Error reading collection: %v%s", err, errorHint(err))
+		}
+		ctx, cancel := toursCtx(len(urls))
+		defer cancel()
+		written, err := converter.ConvertBatch(ctx, urls, output)
+		for _, path := range written {
+			fmt.Println(path)
+		}
+		failed := tourErrors(err)
+		interrupted := interruptCtx.Err() != nil
+		for _, err := range failed {
+			// ConvertBatch has already counted the tours the interrupt canceled
+			if interrupted && errors.Is(err, context.Canceled) {
+				continue
+			}
+			log.Printf("Error converting tour: %v%s", err, errorHint(err))
+		}
+		if interrupted {
+			os.Exit(exitInterrupted)
+		}
+		if code := batchExitCode(len(urls), len(failed)); code != exitOK {
+			os.Exit(code)
+		}
+		return
 	}
 
-	// Remove query parameters from the URL since they are not needed
-	url, err := removeQueryParamFromURL(flag.Arg(0))
+	url, err := normalizeTourURL(args[0], locale)
 	if err != nil {
-		log.Fatalf("Error removing query parameters: %v", err)
+		log.Fatalf("Error resolving tour URL: %v", err)
 	}
 
-	config := DefaultConfig()
-	converter := NewGPXConverter(config)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	if output == "-" && !*dryRun {
+		if err := converter.ConvertToWriter(ctx, url, os.Stdout); err != nil {
+			log.Fatalf("Error converting tour: %v", err)
+		}
+		return
+	}
 
-	if err := converter.ConvertKomootToGPX(ctx, url, output); err != nil {
-		converter.logger.Fatalf("Error converting tour: %v", err)
+	if err := converter.Convert(ctx, url, output); err != nil {
+		log.Fatalf("Error converting tour: %v%s", err, errorHint(err))
 	}
 }